@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/artur/solid-spoon/internal/bot"
 	"github.com/artur/solid-spoon/internal/database"
@@ -38,19 +42,87 @@ func main() {
 	userRepo := repository.NewUserRepository(db.DB)
 	statsRepo := repository.NewStatsRepository(db.DB)
 	videoRepo := repository.NewVideoRepository(db.DB)
+	jobRepo := repository.NewJobRepository(db.DB)
+	fileRepo := repository.NewFileCacheRepository(db.DB)
+	metadataRepo := repository.NewMetadataRepository(db.DB)
+	settingsRepo := repository.NewSettingsRepository(db.DB)
 
 	b, err := bot.New(token)
 	if err != nil {
 		log.Fatalf("Failed to create bot: %v", err)
 	}
 
+	// Общая обработка для всех обработчиков: язык, доступ, лимиты, пользователь и статистика
+	b.Use(
+		bot.Logging(),
+		bot.LoadLanguage(settingsRepo),
+		bot.Recover(b.ErrorReporter()),
+		bot.AccessControl(bot.AllowedUsersFromEnv()),
+		bot.RateLimit(bot.RateLimitConfigFromEnv()),
+		bot.LoadUser(userRepo),
+		bot.RecordStats(statsRepo),
+	)
+
+	// Источники видео: загрузчик и обработчик ссылок должны понимать одни и те же ID
+	sources := downloader.DefaultRegistry()
+	dlConfig := downloader.ConfigFromEnv()
+	dlConfig.Sources = sources
+	dlConfig.MetadataStore = metadataRepo
+	// Устаревшие метаданные больше не используются, их место занимают свежие
+	if deleted, err := metadataRepo.DeleteOlderThan(time.Now().Add(-dlConfig.MetadataTTL)); err != nil {
+		log.Printf("Failed to delete old video metadata: %v", err)
+	} else if deleted > 0 {
+		log.Printf("Deleted metadata of %d videos", deleted)
+	}
+
+	dl := downloader.NewYouTubeDownloaderWithConfig(dlConfig)
+	// Файлы загрузок, прерванных падением прошлого запуска, больше никому не нужны
+	dl.RemoveTempFiles()
+
 	// Регистрируем обработчики с репозиториями
-	b.RegisterHandler(handler.NewStartHandler(userRepo, statsRepo))
-	b.RegisterHandler(handler.NewYouTubeHandler(downloader.NewYouTubeDownloader(), userRepo, statsRepo, videoRepo))
+	b.RegisterHandler(handler.NewStartHandler(settingsRepo))
+	b.RegisterHandler(handler.NewSettingsHandler(settingsRepo))
+	b.RegisterHandler(handler.NewLinkHandler(dl, sources, userRepo, videoRepo, jobRepo, fileRepo, settingsRepo))
 
 	// Отправляем уведомление о запуске
 	b.SendStartupNotification()
 
-	// Запускаем бота
-	b.Run()
+	// По сигналу перестаём принимать обновления: в режиме вебхука это удаляет вебхук в Telegram
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	// stopping получает время сигнала, от него отсчитывается SHUTDOWN_TIMEOUT
+	stopping := make(chan time.Time, 1)
+	go func() {
+		<-ctx.Done()
+		log.Printf("Received stop signal, shutting down")
+		stopping <- time.Now()
+		b.Stop()
+	}()
+
+	// Запускаем бота; даже если он упал, проходим остановку до конца и закрываем базу
+	runErr := b.Run()
+	if runErr != nil {
+		log.Printf("Failed to run bot: %v", runErr)
+	}
+
+	// В SHUTDOWN_TIMEOUT входит всё с момента сигнала: остановка вебхука,
+	// ожидание загрузок и уборка за прерванными
+	stoppedAt := time.Now()
+	select {
+	case stoppedAt = <-stopping:
+	default:
+	}
+	shutdownCtx, cancel := context.WithDeadline(context.Background(), stoppedAt.Add(bot.ShutdownTimeoutFromEnv()))
+	defer cancel()
+	summary := b.Shutdown(shutdownCtx)
+
+	dl.RemoveTempFiles()
+	b.SendShutdownNotification(summary)
+
+	log.Printf("Bot stopped")
+	if runErr != nil {
+		// os.Exit не выполняет defer
+		db.Close()
+		os.Exit(1)
+	}
 }
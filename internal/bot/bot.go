@@ -1,23 +1,84 @@
 package bot
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"runtime/debug"
 	"strconv"
+	"sync"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+// Sender is the part of the Telegram Bot API handlers use. *tgbotapi.BotAPI
+// implements it, tests may point one at a fake server from package bottest.
+type Sender interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+	// UploadFiles calls a method with parameters tgbotapi configs do not
+	// support, e.g. width and height of sendVideo
+	UploadFiles(endpoint string, params tgbotapi.Params, files []tgbotapi.RequestFile) (*tgbotapi.APIResponse, error)
+}
+
 type Handler interface {
 	CanHandle(update tgbotapi.Update) bool
-	Handle(bot *tgbotapi.BotAPI, update tgbotapi.Update)
+	// Handle processes the update. ctx carries values set by middlewares,
+	// e.g. the user returned by UserFromContext.
+	Handle(ctx context.Context, bot Sender, update tgbotapi.Update)
+}
+
+// ScheduleFunc queues a background task on behalf of a user behind the
+// user's other tasks and returns its place in the queue, 0 if it starts right
+// away. If the bot stops before the task starts, onDrop is called instead.
+type ScheduleFunc func(userID int64, task, onDrop func()) (position int, err error)
+
+// Resumer is implemented by handlers that keep persistent work which has to be
+// picked up again after a restart
+type Resumer interface {
+	Resume(bot Sender, schedule ScheduleFunc)
+}
+
+// Interrupter is implemented by handlers with long-running work that has to
+// be cancelled when the bot stops and the shutdown deadline is reached
+type Interrupter interface {
+	Interrupt()
+}
+
+// interruptGrace - сколько ждём, пока прерванные задачи уберут за собой; это
+// время берётся из дедлайна Shutdown, а не добавляется к нему
+const interruptGrace = 10 * time.Second
+
+// ShutdownSummary describes what happened to the work left at shutdown
+type ShutdownSummary struct {
+	// Dropped - запросы, которые ждали в очереди и не были начаты
+	Dropped int
+	// Interrupted - задачи, не успевшие завершиться до дедлайна
+	Interrupted int
+}
+
+// ShutdownTimeoutFromEnv reads SHUTDOWN_TIMEOUT: how many seconds the whole
+// stop may take after a signal, including interrupting unfinished work
+func ShutdownTimeoutFromEnv() time.Duration {
+	return time.Duration(envInt("SHUTDOWN_TIMEOUT", 45)) * time.Second
 }
 
 type Bot struct {
-	api      *tgbotapi.BotAPI
-	handlers []Handler
+	api         *tgbotapi.BotAPI
+	handlers    []Handler
+	middlewares []Middleware
+	dispatcher  *Dispatcher
+	// updates - обработчики обновлений, которые ещё выполняются
+	updates sync.WaitGroup
+	// webhook - nil в режиме long polling
+	webhook *webhook
+	// reporter - nil, если ADMIN_CHAT_ID не задан
+	reporter *ErrorReporter
+	// stopped закрывается в Stop, чтобы Run не ждал конца long polling запроса
+	stopped  chan struct{}
+	stopOnce sync.Once
 }
 
 func New(token string) (*Bot, error) {
@@ -41,10 +102,26 @@ func New(token string) (*Bot, error) {
 
 	log.Printf("[BOT] Authorized on account %s", api.Self.UserName)
 
-	return &Bot{
-		api:      api,
-		handlers: make([]Handler, 0),
-	}, nil
+	b := &Bot{
+		api:        api,
+		handlers:   make([]Handler, 0),
+		dispatcher: NewDispatcher(DispatcherConfigFromEnv()),
+		stopped:    make(chan struct{}),
+	}
+
+	if chatID, ok := adminChatID(); ok {
+		b.reporter = NewErrorReporter(api, chatID)
+	}
+
+	if cfg := WebhookConfigFromEnv(); cfg.Enabled() {
+		b.webhook, err = newWebhook(api, cfg)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("[BOT] Using webhook mode: %s%s", cfg.URL, cfg.Path)
+	}
+
+	return b, nil
 }
 
 func (b *Bot) RegisterHandler(h Handler) {
@@ -52,24 +129,25 @@ func (b *Bot) RegisterHandler(h Handler) {
 	log.Printf("[BOT] Registered handler: %T", h)
 }
 
+// ErrorReporter returns the reporter sending panic reports to ADMIN_CHAT_ID,
+// or nil if it is not configured
+func (b *Bot) ErrorReporter() *ErrorReporter {
+	return b.reporter
+}
+
+// Use appends middlewares wrapping every handler, in the order they run
+func (b *Bot) Use(middlewares ...Middleware) {
+	b.middlewares = append(b.middlewares, middlewares...)
+}
+
 func (b *Bot) SendStartupNotification() {
-	adminChatID := os.Getenv("ADMIN_CHAT_ID")
-	if adminChatID == "" {
+	chatID, ok := adminChatID()
+	if !ok {
 		log.Printf("[BOT] ADMIN_CHAT_ID not set, skipping startup notification")
 		return
 	}
 
-	chatID, err := strconv.ParseInt(adminChatID, 10, 64)
-	if err != nil {
-		log.Printf("[BOT] Invalid ADMIN_CHAT_ID: %v", err)
-		return
-	}
-
-	hostname, _ := os.Hostname()
-	version := os.Getenv("APP_VERSION")
-	if version == "" {
-		version = "unknown"
-	}
+	hostname, version := hostInfo()
 
 	message := fmt.Sprintf(
 		"🚀 <b>Бот запущен</b>\n\n"+
@@ -92,47 +170,282 @@ func (b *Bot) SendStartupNotification() {
 	}
 }
 
-func (b *Bot) Run() {
+// SendShutdownNotification tells the admin that the bot stopped and how much
+// work was cut short
+func (b *Bot) SendShutdownNotification(summary ShutdownSummary) {
+	chatID, ok := adminChatID()
+	if !ok {
+		log.Printf("[BOT] ADMIN_CHAT_ID not set, skipping shutdown notification")
+		return
+	}
+
+	hostname, version := hostInfo()
+
+	message := fmt.Sprintf(
+		"🛑 <b>Бот остановлен</b>\n\n"+
+			"📅 Время: %s\n"+
+			"🏷 Версия: <code>%s</code>\n"+
+			"🖥 Хост: <code>%s</code>\n"+
+			"⏹ Прервано задач: %d\n"+
+			"🗑 Сброшено из очереди: %d",
+		time.Now().Format("2006-01-02 15:04:05"),
+		version,
+		hostname,
+		summary.Interrupted,
+		summary.Dropped,
+	)
+
+	msg := tgbotapi.NewMessage(chatID, message)
+	msg.ParseMode = "HTML"
+
+	if _, err := b.api.Send(msg); err != nil {
+		log.Printf("[BOT] Failed to send shutdown notification: %v", err)
+	} else {
+		log.Printf("[BOT] Shutdown notification sent to chat %d", chatID)
+	}
+}
+
+// adminChatID returns the chat for service notifications from ADMIN_CHAT_ID
+func adminChatID() (int64, bool) {
+	value := os.Getenv("ADMIN_CHAT_ID")
+	if value == "" {
+		return 0, false
+	}
+
+	chatID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		log.Printf("[BOT] Invalid ADMIN_CHAT_ID: %v", err)
+		return 0, false
+	}
+	return chatID, true
+}
+
+func hostInfo() (hostname, version string) {
+	hostname, _ = os.Hostname()
+	version = os.Getenv("APP_VERSION")
+	if version == "" {
+		version = "unknown"
+	}
+	return hostname, version
+}
+
+// Run receives updates until Stop is called
+func (b *Bot) Run() error {
 	log.Printf("[BOT] Starting bot with %d handlers", len(b.handlers))
 
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+	updates, err := b.receiveUpdates()
+	if err != nil {
+		return err
+	}
 
-	updates := b.api.GetUpdatesChan(u)
+	b.dispatcher.Start()
+	b.resumeHandlers()
 
-	for update := range updates {
-		// Логируем входящее обновление
-		if update.Message != nil {
-			log.Printf("[BOT] Message from %s (@%s): %s",
-				update.Message.From.FirstName,
-				update.Message.From.UserName,
-				update.Message.Text)
+	for {
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				log.Printf("[BOT] Stopped receiving updates")
+				return nil
+			}
+			b.handleUpdate(update)
+		case <-b.stopped:
+			// Неподтверждённые обновления Telegram пришлёт снова после перезапуска
+			log.Printf("[BOT] Stopped receiving updates")
+			return nil
 		}
-		if update.CallbackQuery != nil {
-			log.Printf("[BOT] Callback from %s (@%s): %s",
-				update.CallbackQuery.From.FirstName,
-				update.CallbackQuery.From.UserName,
-				update.CallbackQuery.Data)
+	}
+}
+
+// Stop stops receiving updates and makes Run return. Work already queued is
+// left to Shutdown.
+func (b *Bot) Stop() {
+	b.stopOnce.Do(func() {
+		if b.webhook != nil {
+			b.webhook.stop()
+			return
 		}
+		b.api.StopReceivingUpdates()
+		close(b.stopped)
+	})
+}
+
+// Shutdown drains queued work after Stop: waiting tasks are dropped with a
+// notice to their users, running ones and updates being handled get time to
+// finish and are interrupted after that. If ctx has a deadline, Shutdown
+// returns by it: the last interruptGrace of it is left to interrupted tasks.
+func (b *Bot) Shutdown(ctx context.Context) ShutdownSummary {
+	var summary ShutdownSummary
+	summary.Dropped = b.dispatcher.Close()
+
+	drainCtx, graceCtx := ctx, ctx
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		drainCtx, cancel = context.WithDeadline(ctx, deadline.Add(-interruptGrace))
+		defer cancel()
+	} else {
+		var cancel context.CancelFunc
+		graceCtx, cancel = context.WithTimeout(context.Background(), interruptGrace)
+		defer cancel()
+	}
+
+	running, _ := b.dispatcher.Stats()
+	log.Printf("[BOT] Waiting for %d running tasks", running)
+	if err := b.wait(drainCtx); err == nil {
+		log.Printf("[BOT] All tasks finished")
+		return summary
+	}
+
+	summary.Interrupted, _ = b.dispatcher.Stats()
+	log.Printf("[BOT] Shutdown deadline reached, interrupting %d tasks", summary.Interrupted)
+	for _, handler := range b.handlers {
+		if i, ok := handler.(Interrupter); ok {
+			i.Interrupt()
+		}
+	}
+
+	// Даём прерванным задачам убрать временные файлы и предупредить пользователей
+	if err := b.wait(graceCtx); err != nil {
+		log.Printf("[BOT] Some tasks did not stop in time")
+	}
+
+	return summary
+}
+
+// wait waits for updates being handled and then for tasks of the dispatcher.
+// Tasks an update schedules while the bot stops are dropped by the dispatcher.
+func (b *Bot) wait(ctx context.Context) error {
+	handled := make(chan struct{})
+	go func() {
+		b.updates.Wait()
+		close(handled)
+	}()
+
+	select {
+	case <-handled:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return b.dispatcher.Wait(ctx)
+}
+
+// receiveUpdates starts the webhook server or long polling
+func (b *Bot) receiveUpdates() (tgbotapi.UpdatesChannel, error) {
+	if b.webhook != nil {
+		return b.webhook.start()
+	}
+
+	// Telegram не отдаёт обновления через getUpdates, пока установлен вебхук,
+	// например оставшийся после аварийного завершения в режиме вебхука
+	if _, err := b.api.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		log.Printf("[BOT] Failed to delete webhook: %v", err)
+	}
+
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = 60
+
+	return b.api.GetUpdatesChan(u), nil
+}
+
+func (b *Bot) handleUpdate(update tgbotapi.Update) {
+	// Логируем входящее обновление
+	if update.Message != nil {
+		log.Printf("[BOT] Message from %s (@%s): %s",
+			update.Message.From.FirstName,
+			update.Message.From.UserName,
+			update.Message.Text)
+	}
+	if update.CallbackQuery != nil {
+		log.Printf("[BOT] Callback from %s (@%s): %s",
+			update.CallbackQuery.From.FirstName,
+			update.CallbackQuery.From.UserName,
+			update.CallbackQuery.Data)
+	}
+
+	// Пропускаем только если нет ни сообщения, ни callback
+	if update.Message == nil && update.CallbackQuery == nil {
+		log.Printf("[BOT] Skipping update: no message or callback")
+		return
+	}
 
-		// Пропускаем только если нет ни сообщения, ни callback
-		if update.Message == nil && update.CallbackQuery == nil {
-			log.Printf("[BOT] Skipping update: no message or callback")
+	b.dispatch(update)
+}
+
+// resumeHandlers lets handlers re-queue work left unfinished by a previous run
+func (b *Bot) resumeHandlers() {
+	for _, handler := range b.handlers {
+		r, ok := handler.(Resumer)
+		if !ok {
 			continue
 		}
 
-		handled := false
-		for _, handler := range b.handlers {
-			if handler.CanHandle(update) {
-				log.Printf("[BOT] Handling with: %T", handler)
-				go handler.Handle(b.api, update)
-				handled = true
-				break
+		log.Printf("[BOT] Resuming work of handler: %T", handler)
+		r.Resume(b.api, b.scheduler(handler))
+	}
+}
+
+// scheduler returns the ScheduleFunc queueing background tasks of handler on
+// the dispatcher
+func (b *Bot) scheduler(handler Handler) ScheduleFunc {
+	return func(userID int64, task, onDrop func()) (int, error) {
+		return b.dispatcher.SubmitWithDrop(userID, b.recoverTask(handler, userID, task), onDrop)
+	}
+}
+
+// recoverTask wraps a background task of handler so that its panic is
+// reported like a panic while handling an update
+func (b *Bot) recoverTask(handler Handler, userID int64, task func()) func() {
+	return func() {
+		defer func() {
+			if r := recover(); r != nil {
+				stack := debug.Stack()
+				log.Printf("[BOT] Panic in background task of %T: %v\n%s", handler, r, stack)
+				b.reporter.Report(PanicReport{
+					Handler: fmt.Sprintf("%T", handler),
+					UserID:  userID,
+					Value:   r,
+					Stack:   stack,
+				})
 			}
-		}
+		}()
+		task()
+	}
+}
+
+// dispatch finds a handler for the update and runs it right away. Only the
+// long work the handler hands to the ScheduleFunc from its context, e.g. a
+// download, waits in the dispatcher queue behind the user's other tasks.
+func (b *Bot) dispatch(update tgbotapi.Update) {
+	handler := b.findHandler(update)
+	if handler == nil {
+		log.Printf("[BOT] No handler found for update")
+		return
+	}
+
+	log.Printf("[BOT] Handling with: %T", handler)
+
+	var userID int64
+	if from := updateFrom(update); from != nil {
+		userID = from.ID
+	}
+	handle := b.recoverTask(handler, userID, func() {
+		ctx := withHandler(context.Background(), handler)
+		ctx = WithSchedule(ctx, b.scheduler(handler))
+		Chain(handler.Handle, b.middlewares...)(ctx, b.api, update)
+	})
+
+	b.updates.Add(1)
+	go func() {
+		defer b.updates.Done()
+		handle()
+	}()
+}
 
-		if !handled {
-			log.Printf("[BOT] No handler found for update")
+func (b *Bot) findHandler(update tgbotapi.Update) Handler {
+	for _, handler := range b.handlers {
+		if handler.CanHandle(update) {
+			return handler
 		}
 	}
+	return nil
 }
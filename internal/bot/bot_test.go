@@ -1,7 +1,9 @@
 package bot
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -9,7 +11,7 @@ import (
 // MockHandler implements Handler interface for testing
 type MockHandler struct {
 	canHandleFunc func(update tgbotapi.Update) bool
-	handleFunc    func(bot *tgbotapi.BotAPI, update tgbotapi.Update)
+	handleFunc    func(bot Sender, update tgbotapi.Update)
 }
 
 func (m *MockHandler) CanHandle(update tgbotapi.Update) bool {
@@ -19,7 +21,7 @@ func (m *MockHandler) CanHandle(update tgbotapi.Update) bool {
 	return false
 }
 
-func (m *MockHandler) Handle(bot *tgbotapi.BotAPI, update tgbotapi.Update) {
+func (m *MockHandler) Handle(ctx context.Context, bot Sender, update tgbotapi.Update) {
 	if m.handleFunc != nil {
 		m.handleFunc(bot, update)
 	}
@@ -73,7 +75,7 @@ func TestBot_HandlerExecution(t *testing.T) {
 		canHandleFunc: func(update tgbotapi.Update) bool {
 			return update.Message != nil && update.Message.Text == "test"
 		},
-		handleFunc: func(bot *tgbotapi.BotAPI, update tgbotapi.Update) {
+		handleFunc: func(bot Sender, update tgbotapi.Update) {
 			handlerCalled = true
 		},
 	}
@@ -92,7 +94,7 @@ func TestBot_HandlerExecution(t *testing.T) {
 	for _, h := range bot.handlers {
 		if h.CanHandle(update) {
 			canHandle = true
-			h.Handle(nil, update)
+			h.Handle(context.Background(), nil, update)
 			break
 		}
 	}
@@ -119,7 +121,7 @@ func TestBot_MultipleHandlers(t *testing.T) {
 		canHandleFunc: func(update tgbotapi.Update) bool {
 			return update.Message != nil && update.Message.Text == "command1"
 		},
-		handleFunc: func(bot *tgbotapi.BotAPI, update tgbotapi.Update) {
+		handleFunc: func(bot Sender, update tgbotapi.Update) {
 			handler1Called = true
 		},
 	}
@@ -129,7 +131,7 @@ func TestBot_MultipleHandlers(t *testing.T) {
 		canHandleFunc: func(update tgbotapi.Update) bool {
 			return update.Message != nil && update.Message.Text == "command2"
 		},
-		handleFunc: func(bot *tgbotapi.BotAPI, update tgbotapi.Update) {
+		handleFunc: func(bot Sender, update tgbotapi.Update) {
 			handler2Called = true
 		},
 	}
@@ -144,7 +146,7 @@ func TestBot_MultipleHandlers(t *testing.T) {
 
 	for _, h := range bot.handlers {
 		if h.CanHandle(update1) {
-			h.Handle(nil, update1)
+			h.Handle(context.Background(), nil, update1)
 			break
 		}
 	}
@@ -167,7 +169,7 @@ func TestBot_MultipleHandlers(t *testing.T) {
 
 	for _, h := range bot.handlers {
 		if h.CanHandle(update2) {
-			h.Handle(nil, update2)
+			h.Handle(context.Background(), nil, update2)
 			break
 		}
 	}
@@ -179,3 +181,167 @@ func TestBot_MultipleHandlers(t *testing.T) {
 		t.Error("Handler2 should have been called")
 	}
 }
+
+// interruptibleHandler implements Interrupter for shutdown tests
+type interruptibleHandler struct {
+	MockHandler
+	interrupted chan struct{}
+}
+
+func (h *interruptibleHandler) Interrupt() {
+	close(h.interrupted)
+}
+
+func TestBot_ShutdownWaitsForRunningTasks(t *testing.T) {
+	handler := &interruptibleHandler{interrupted: make(chan struct{})}
+	bot := &Bot{
+		handlers:   []Handler{handler},
+		dispatcher: NewDispatcher(DispatcherConfig{Workers: 1, PerUserLimit: 1, QueueSize: 10}),
+	}
+	bot.dispatcher.Start()
+
+	finished := make(chan struct{})
+	bot.dispatcher.Submit(1, func() {
+		time.Sleep(50 * time.Millisecond)
+		close(finished)
+	})
+	waitFor(t, func() bool { r, _ := bot.dispatcher.Stats(); return r == 1 })
+
+	summary := bot.Shutdown(context.Background())
+
+	select {
+	case <-finished:
+	default:
+		t.Fatal("Shutdown returned before the running task finished")
+	}
+	if summary != (ShutdownSummary{}) {
+		t.Errorf("Expected nothing to be interrupted, got %+v", summary)
+	}
+	select {
+	case <-handler.interrupted:
+		t.Error("Handler must not be interrupted when tasks finish in time")
+	default:
+	}
+}
+
+func TestBot_ShutdownInterruptsAfterDeadline(t *testing.T) {
+	handler := &interruptibleHandler{interrupted: make(chan struct{})}
+	bot := &Bot{
+		handlers:   []Handler{handler},
+		dispatcher: NewDispatcher(DispatcherConfig{Workers: 1, PerUserLimit: 1, QueueSize: 10}),
+	}
+	bot.dispatcher.Start()
+
+	// Задача завершается только по Interrupt, как загрузка с отменённым контекстом
+	bot.dispatcher.Submit(1, func() { <-handler.interrupted })
+	waitFor(t, func() bool { r, _ := bot.dispatcher.Stats(); return r == 1 })
+
+	dropped := make(chan struct{})
+	bot.dispatcher.SubmitWithDrop(2, func() {}, func() { close(dropped) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	summary := bot.Shutdown(ctx)
+
+	if summary.Interrupted != 1 || summary.Dropped != 1 {
+		t.Errorf("Expected 1 interrupted and 1 dropped task, got %+v", summary)
+	}
+	select {
+	case <-dropped:
+	default:
+		t.Error("Expected onDrop of the waiting task to be called")
+	}
+	if r, _ := bot.dispatcher.Stats(); r != 0 {
+		t.Errorf("Expected interrupted task to stop, %d still running", r)
+	}
+}
+
+func TestBot_ShutdownStaysWithinDeadline(t *testing.T) {
+	handler := &interruptibleHandler{interrupted: make(chan struct{})}
+	bot := &Bot{
+		handlers:   []Handler{handler},
+		dispatcher: NewDispatcher(DispatcherConfig{Workers: 1, PerUserLimit: 1, QueueSize: 10}),
+	}
+	bot.dispatcher.Start()
+
+	// Задача не реагирует на Interrupt, её время уборки тоже истекает
+	release := make(chan struct{})
+	defer close(release)
+	bot.dispatcher.Submit(1, func() { <-release })
+	waitFor(t, func() bool { r, _ := bot.dispatcher.Stats(); return r == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	summary := bot.Shutdown(ctx)
+
+	// Время на уборку берётся из дедлайна, а не добавляется к нему
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Shutdown took %v, longer than its deadline", elapsed)
+	}
+	if summary.Interrupted != 1 {
+		t.Errorf("Expected 1 interrupted task, got %+v", summary)
+	}
+	select {
+	case <-handler.interrupted:
+	default:
+		t.Error("Expected the handler to be interrupted")
+	}
+}
+
+// scheduleHandler hands every update to the ScheduleFunc from its context
+type scheduleHandler struct {
+	positions chan int
+}
+
+func (h *scheduleHandler) CanHandle(update tgbotapi.Update) bool { return true }
+
+func (h *scheduleHandler) Handle(ctx context.Context, bot Sender, update tgbotapi.Update) {
+	position, err := ScheduleFromContext(ctx)(update.Message.From.ID, func() {}, func() {})
+	if err != nil {
+		position = -1
+	}
+	h.positions <- position
+}
+
+func TestBot_UpdatesAreNotQueuedBehindTasks(t *testing.T) {
+	handler := &scheduleHandler{positions: make(chan int, 1)}
+	bot := &Bot{
+		handlers:   []Handler{handler},
+		dispatcher: NewDispatcher(DispatcherConfig{Workers: 2, PerUserLimit: 1, QueueSize: 10}),
+	}
+	bot.dispatcher.Start()
+
+	// Загрузка пользователя занимает его единственный слот
+	release := make(chan struct{})
+	bot.dispatcher.Submit(1, func() { <-release })
+	waitFor(t, func() bool { r, _ := bot.dispatcher.Stats(); return r == 1 })
+
+	bot.dispatch(tgbotapi.Update{Message: &tgbotapi.Message{From: &tgbotapi.User{ID: 1}, Text: "/settings"}})
+
+	// Обновление обработано сразу, а поставленная им задача ждёт загрузку
+	select {
+	case position := <-handler.positions:
+		if position != 1 {
+			t.Errorf("Expected the task of the update to wait at position 1, got %d", position)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Update waited behind the running task")
+	}
+
+	close(release)
+	waitFor(t, func() bool { r, w := bot.dispatcher.Stats(); return r == 0 && w == 0 })
+	bot.Shutdown(context.Background())
+}
+
+func TestShutdownTimeoutFromEnv(t *testing.T) {
+	t.Setenv("SHUTDOWN_TIMEOUT", "")
+	if got := ShutdownTimeoutFromEnv(); got != 45*time.Second {
+		t.Errorf("Expected default 45s, got %v", got)
+	}
+
+	t.Setenv("SHUTDOWN_TIMEOUT", "10")
+	if got := ShutdownTimeoutFromEnv(); got != 10*time.Second {
+		t.Errorf("Expected 10s, got %v", got)
+	}
+}
@@ -0,0 +1,294 @@
+// Package bottest provides an in-process fake of the Telegram Bot API for
+// end-to-end tests of handlers.
+package bottest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Token is the bot token clients created by Server.API use
+const Token = "test-token"
+
+// BotUser is what getMe returns
+var BotUser = tgbotapi.User{ID: 1, IsBot: true, FirstName: "Test", UserName: "test_bot"}
+
+// UploadedFile is a file sent in a multipart request
+type UploadedFile struct {
+	Name string
+	Size int64
+}
+
+// Request is a recorded Bot API call
+type Request struct {
+	Method string
+	// Params - поля запроса; файлы, отправленные по file_id, тоже здесь
+	Params map[string]string
+	// Files - загруженные файлы по имени поля (document, audio, video...)
+	Files map[string]UploadedFile
+	// MessageID - ID отправленного или отредактированного сообщения из ответа
+	MessageID int
+}
+
+// Int returns a numeric param, 0 if it is missing
+func (r Request) Int(name string) int64 {
+	n, _ := strconv.ParseInt(r.Params[name], 10, 64)
+	return n
+}
+
+type failure struct {
+	code        int
+	description string
+	retryAfter  int
+}
+
+// Server is a fake Telegram Bot API. It accepts every method, records the
+// request and answers like Telegram would: send* and edit* methods return a
+// message with a fresh ID, media gets a file_id, everything else returns true.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []Request
+	nextID   int
+	failures map[string][]failure
+}
+
+// NewServer starts a fake server that is closed when the test ends
+func NewServer(t testing.TB) *Server {
+	s := &Server{
+		nextID:   1000,
+		failures: make(map[string][]failure),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// API returns a client talking to the fake server
+func (s *Server) API(t testing.TB) *tgbotapi.BotAPI {
+	t.Helper()
+	api, err := tgbotapi.NewBotAPIWithAPIEndpoint(Token, s.URL+"/bot%s/%s")
+	if err != nil {
+		t.Fatalf("Failed to create Bot API client: %v", err)
+	}
+	return api
+}
+
+// Fail makes the next call of method return a Telegram error
+func (s *Server) Fail(method string, code int, description string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[method] = append(s.failures[method], failure{code: code, description: description})
+}
+
+// FailRetryAfter makes the next call of method return 429 Too Many Requests
+func (s *Server) FailRetryAfter(method string, seconds int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[method] = append(s.failures[method], failure{
+		code:        http.StatusTooManyRequests,
+		description: fmt.Sprintf("Too Many Requests: retry after %d", seconds),
+		retryAfter:  seconds,
+	})
+}
+
+// Requests returns all recorded calls except getMe
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []Request
+	for _, r := range s.requests {
+		if r.Method != "getMe" {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// Calls returns recorded calls of the given methods in order
+func (s *Server) Calls(methods ...string) []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []Request
+	for _, r := range s.requests {
+		for _, method := range methods {
+			if r.Method == method {
+				result = append(result, r)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// Last returns the last call of method, or nil if there was none
+func (s *Server) Last(method string) *Request {
+	calls := s.Calls(method)
+	if len(calls) == 0 {
+		return nil
+	}
+	return &calls[len(calls)-1]
+}
+
+// Messages returns sent text messages
+func (s *Server) Messages() []Request {
+	return s.Calls("sendMessage")
+}
+
+// Edits returns edits of message text and keyboards
+func (s *Server) Edits() []Request {
+	return s.Calls("editMessageText", "editMessageReplyMarkup", "editMessageCaption")
+}
+
+// Deletions returns deleted messages
+func (s *Server) Deletions() []Request {
+	return s.Calls("deleteMessage")
+}
+
+// Uploads returns calls that uploaded at least one file
+func (s *Server) Uploads() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []Request
+	for _, r := range s.requests {
+		if len(r.Files) > 0 {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// LastEditText returns the text the message was last edited to
+func (s *Server) LastEditText(messageID int) string {
+	text := ""
+	for _, r := range s.Calls("editMessageText") {
+		if r.Int("message_id") == int64(messageID) {
+			text = r.Params["text"]
+		}
+	}
+	return text
+}
+
+// Reset forgets recorded calls
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+
+	req := Request{Method: method, Params: make(map[string]string), Files: make(map[string]UploadedFile)}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for field, headers := range r.MultipartForm.File {
+			req.Files[field] = UploadedFile{Name: headers[0].Filename, Size: headers[0].Size}
+		}
+	} else if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for key, values := range r.Form {
+		req.Params[key] = values[0]
+	}
+
+	s.mu.Lock()
+	fail, failed := s.popFailure(method)
+	var result any = true
+	if !failed {
+		result = s.result(req)
+		if msg, ok := result.(tgbotapi.Message); ok {
+			req.MessageID = msg.MessageID
+		}
+	}
+	s.requests = append(s.requests, req)
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if failed {
+		resp := map[string]any{"ok": false, "error_code": fail.code, "description": fail.description}
+		if fail.retryAfter > 0 {
+			resp["parameters"] = map[string]any{"retry_after": fail.retryAfter}
+		}
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": result})
+}
+
+// popFailure must be called with mu held
+func (s *Server) popFailure(method string) (failure, bool) {
+	queue := s.failures[method]
+	if len(queue) == 0 {
+		return failure{}, false
+	}
+	s.failures[method] = queue[1:]
+	return queue[0], true
+}
+
+// result builds the answer to a successful call, must be called with mu held
+func (s *Server) result(req Request) any {
+	switch {
+	case req.Method == "getMe":
+		return BotUser
+	case strings.HasPrefix(req.Method, "send") && req.Method != "sendChatAction",
+		strings.HasPrefix(req.Method, "edit"):
+		return s.message(req)
+	}
+	return true
+}
+
+// message builds a message as Telegram returns it for a send or edit call
+func (s *Server) message(req Request) tgbotapi.Message {
+	msg := tgbotapi.Message{
+		Date:    int(time.Now().Unix()),
+		Chat:    &tgbotapi.Chat{ID: req.Int("chat_id"), Type: "private"},
+		From:    &BotUser,
+		Text:    req.Params["text"],
+		Caption: req.Params["caption"],
+	}
+
+	if strings.HasPrefix(req.Method, "edit") {
+		msg.MessageID = int(req.Int("message_id"))
+		return msg
+	}
+
+	s.nextID++
+	msg.MessageID = s.nextID
+
+	switch req.Method {
+	case "sendDocument":
+		msg.Document = &tgbotapi.Document{FileID: s.fileID(req, "document"), FileName: req.Files["document"].Name}
+	case "sendAudio":
+		msg.Audio = &tgbotapi.Audio{FileID: s.fileID(req, "audio"), Title: req.Params["title"]}
+	case "sendVideo":
+		msg.Video = &tgbotapi.Video{FileID: s.fileID(req, "video")}
+	}
+	return msg
+}
+
+// fileID returns the file_id of the media in field: a new one for uploads,
+// the same one when a file is resent by file_id
+func (s *Server) fileID(req Request, field string) string {
+	if _, ok := req.Files[field]; ok {
+		return fmt.Sprintf("file-%d", s.nextID)
+	}
+	return req.Params[field]
+}
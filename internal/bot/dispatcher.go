@@ -0,0 +1,288 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// ErrQueueFull is returned by Dispatcher.Submit when the waiting queue is at capacity
+var ErrQueueFull = errors.New("dispatcher queue is full")
+
+// ErrStopped is returned by Dispatcher.Submit after Close
+var ErrStopped = errors.New("dispatcher is stopped")
+
+// DispatcherConfig configures worker pool and queue limits
+type DispatcherConfig struct {
+	// Workers - сколько задач выполняется одновременно на весь бот
+	Workers int
+	// PerUserLimit - сколько задач одного пользователя выполняется одновременно
+	PerUserLimit int
+	// QueueSize - сколько задач может ждать своей очереди
+	QueueSize int
+}
+
+// DefaultDispatcherConfig returns limits used when nothing is configured
+func DefaultDispatcherConfig() DispatcherConfig {
+	return DispatcherConfig{
+		Workers:      4,
+		PerUserLimit: 1,
+		QueueSize:    100,
+	}
+}
+
+// DispatcherConfigFromEnv reads limits from WORKER_POOL_SIZE, USER_CONCURRENCY_LIMIT and QUEUE_SIZE
+func DispatcherConfigFromEnv() DispatcherConfig {
+	cfg := DefaultDispatcherConfig()
+	cfg.Workers = envInt("WORKER_POOL_SIZE", cfg.Workers)
+	cfg.PerUserLimit = envInt("USER_CONCURRENCY_LIMIT", cfg.PerUserLimit)
+	cfg.QueueSize = envInt("QUEUE_SIZE", cfg.QueueSize)
+	return cfg
+}
+
+func envInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("[BOT] Invalid %s=%q, using %d", name, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+type task struct {
+	userID int64
+	fn     func()
+	// onDrop вызывается вместо fn, если задача выброшена из очереди при остановке
+	onDrop func()
+}
+
+// Dispatcher runs tasks on a fixed pool of workers, limiting how many tasks
+// a single user may have in flight. Tasks that cannot start right away wait
+// in a bounded FIFO queue.
+type Dispatcher struct {
+	cfg DispatcherConfig
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	pending  []*task
+	inFlight map[int64]int
+	busy     int
+	started  bool
+	closed   bool
+	// idle закрывается, когда после Close завершается последняя задача
+	idle chan struct{}
+}
+
+// NewDispatcher creates a dispatcher, zero values in cfg fall back to defaults
+func NewDispatcher(cfg DispatcherConfig) *Dispatcher {
+	defaults := DefaultDispatcherConfig()
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaults.Workers
+	}
+	if cfg.PerUserLimit <= 0 {
+		cfg.PerUserLimit = defaults.PerUserLimit
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaults.QueueSize
+	}
+
+	d := &Dispatcher{
+		cfg:      cfg,
+		inFlight: make(map[int64]int),
+	}
+	d.cond = sync.NewCond(&d.mu)
+	return d
+}
+
+// Start launches worker goroutines. Calling it more than once has no effect.
+func (d *Dispatcher) Start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.started {
+		return
+	}
+	d.started = true
+
+	for i := 0; i < d.cfg.Workers; i++ {
+		go d.worker()
+	}
+	log.Printf("[DISPATCHER] Started %d workers (per-user limit %d, queue size %d)",
+		d.cfg.Workers, d.cfg.PerUserLimit, d.cfg.QueueSize)
+}
+
+// Submit queues fn on behalf of userID. It returns the position of the task
+// in the waiting queue (1-based), or 0 if the task will start immediately.
+func (d *Dispatcher) Submit(userID int64, fn func()) (int, error) {
+	return d.SubmitWithDrop(userID, fn, nil)
+}
+
+// SubmitWithDrop is like Submit, but if the task is still waiting when the
+// dispatcher is closed, onDrop is called instead of fn
+func (d *Dispatcher) SubmitWithDrop(userID int64, fn, onDrop func()) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return 0, ErrStopped
+	}
+	if len(d.pending) >= d.cfg.QueueSize {
+		return 0, ErrQueueFull
+	}
+
+	// Задача стартует сразу, если есть свободный воркер, который не займут
+	// уже ожидающие задачи, и пользователь не упёрся в свой лимит
+	idle := d.cfg.Workers - d.busy
+	userLoad := d.inFlight[userID] + d.pendingFor(userID)
+	startsNow := idle > d.runnable() && userLoad < d.cfg.PerUserLimit
+
+	d.pending = append(d.pending, &task{userID: userID, fn: fn, onDrop: onDrop})
+	d.cond.Signal()
+
+	if startsNow {
+		return 0, nil
+	}
+	return len(d.pending), nil
+}
+
+// Stats returns the number of running and waiting tasks
+func (d *Dispatcher) Stats() (running, waiting int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.busy, len(d.pending)
+}
+
+// Close stops accepting tasks and discards the waiting ones, calling their
+// onDrop callbacks. Running tasks are not interrupted. It returns the number
+// of discarded tasks.
+func (d *Dispatcher) Close() int {
+	d.mu.Lock()
+	d.closed = true
+	dropped := d.pending
+	d.pending = nil
+	d.mu.Unlock()
+
+	log.Printf("[DISPATCHER] Closed, dropped %d waiting tasks", len(dropped))
+
+	for _, t := range dropped {
+		if t.onDrop != nil {
+			d.call(t.userID, t.onDrop)
+		}
+	}
+	return len(dropped)
+}
+
+// Wait blocks until all running tasks finish or ctx is done. It is meant to
+// be called after Close, otherwise new tasks may start while it waits.
+func (d *Dispatcher) Wait(ctx context.Context) error {
+	d.mu.Lock()
+	if d.busy == 0 {
+		d.mu.Unlock()
+		return nil
+	}
+	if d.idle == nil {
+		d.idle = make(chan struct{})
+	}
+	idle := d.idle
+	d.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *Dispatcher) worker() {
+	for {
+		t := d.next()
+		d.run(t)
+		d.done(t)
+	}
+}
+
+func (d *Dispatcher) run(t *task) {
+	d.call(t.userID, t.fn)
+}
+
+// call runs fn recovering from panics so one task cannot take down a worker
+func (d *Dispatcher) call(userID int64, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[DISPATCHER] Task of user %d panicked: %v", userID, r)
+		}
+	}()
+	fn()
+}
+
+// next blocks until there is a task whose user is below the per-user limit
+func (d *Dispatcher) next() *task {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for {
+		for i, t := range d.pending {
+			if d.inFlight[t.userID] < d.cfg.PerUserLimit {
+				d.pending = append(d.pending[:i], d.pending[i+1:]...)
+				d.inFlight[t.userID]++
+				d.busy++
+				return t
+			}
+		}
+		d.cond.Wait()
+	}
+}
+
+func (d *Dispatcher) done(t *task) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.busy--
+	d.inFlight[t.userID]--
+	if d.inFlight[t.userID] <= 0 {
+		delete(d.inFlight, t.userID)
+	}
+	if d.busy == 0 && d.idle != nil {
+		close(d.idle)
+		d.idle = nil
+	}
+	// Освободился слот пользователя - будим всех, чтобы его задачу подхватил любой воркер
+	d.cond.Broadcast()
+}
+
+// pendingFor counts waiting tasks of a user, must be called with mu held
+func (d *Dispatcher) pendingFor(userID int64) int {
+	n := 0
+	for _, t := range d.pending {
+		if t.userID == userID {
+			n++
+		}
+	}
+	return n
+}
+
+// runnable counts waiting tasks that are not blocked by the per-user limit,
+// must be called with mu held
+func (d *Dispatcher) runnable() int {
+	load := make(map[int64]int, len(d.inFlight))
+	for userID, n := range d.inFlight {
+		load[userID] = n
+	}
+
+	n := 0
+	for _, t := range d.pending {
+		if load[t.userID] < d.cfg.PerUserLimit {
+			load[t.userID]++
+			n++
+		}
+	}
+	return n
+}
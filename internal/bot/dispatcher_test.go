@@ -0,0 +1,213 @@
+package bot
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("condition not met in time")
+}
+
+func TestDispatcher_RunsAllTasks(t *testing.T) {
+	d := NewDispatcher(DispatcherConfig{Workers: 3, PerUserLimit: 2, QueueSize: 50})
+	d.Start()
+
+	var wg sync.WaitGroup
+	var count int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		if _, err := d.Submit(int64(i%4), func() {
+			atomic.AddInt32(&count, 1)
+			wg.Done()
+		}); err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+	}
+	wg.Wait()
+
+	if count != 20 {
+		t.Errorf("Expected 20 executed tasks, got %d", count)
+	}
+}
+
+func TestDispatcher_PerUserLimit(t *testing.T) {
+	d := NewDispatcher(DispatcherConfig{Workers: 4, PerUserLimit: 1, QueueSize: 10})
+	d.Start()
+
+	release := make(chan struct{})
+	var running, maxRunning int32
+	var wg sync.WaitGroup
+
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		d.Submit(42, func() {
+			defer wg.Done()
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+					break
+				}
+			}
+			<-release
+			atomic.AddInt32(&running, -1)
+		})
+	}
+
+	// Пока первая задача не завершена, остальные две должны ждать
+	waitFor(t, func() bool { r, w := d.Stats(); return r == 1 && w == 2 })
+
+	// Другой пользователь не должен ждать
+	otherDone := make(chan struct{})
+	pos, err := d.Submit(7, func() { close(otherDone) })
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if pos != 0 {
+		t.Errorf("Expected other user's task to start immediately, got position %d", pos)
+	}
+	select {
+	case <-otherDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Other user's task was blocked by per-user limit")
+	}
+
+	close(release)
+	wg.Wait()
+
+	if maxRunning != 1 {
+		t.Errorf("Expected at most 1 concurrent task per user, got %d", maxRunning)
+	}
+}
+
+func TestDispatcher_QueuePosition(t *testing.T) {
+	d := NewDispatcher(DispatcherConfig{Workers: 1, PerUserLimit: 1, QueueSize: 10})
+	d.Start()
+
+	release := make(chan struct{})
+	pos, _ := d.Submit(1, func() { <-release })
+	if pos != 0 {
+		t.Errorf("Expected first task to start immediately, got position %d", pos)
+	}
+	waitFor(t, func() bool { r, _ := d.Stats(); return r == 1 })
+
+	pos, _ = d.Submit(2, func() {})
+	if pos != 1 {
+		t.Errorf("Expected position 1, got %d", pos)
+	}
+	pos, _ = d.Submit(3, func() {})
+	if pos != 2 {
+		t.Errorf("Expected position 2, got %d", pos)
+	}
+
+	close(release)
+	waitFor(t, func() bool { r, w := d.Stats(); return r == 0 && w == 0 })
+}
+
+func TestDispatcher_QueueFull(t *testing.T) {
+	d := NewDispatcher(DispatcherConfig{Workers: 1, PerUserLimit: 1, QueueSize: 2})
+	d.Start()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	d.Submit(1, func() { <-release })
+	waitFor(t, func() bool { r, _ := d.Stats(); return r == 1 })
+
+	if _, err := d.Submit(1, func() {}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := d.Submit(2, func() {}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := d.Submit(3, func() {}); err != ErrQueueFull {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+}
+
+func TestDispatcher_CloseDropsWaitingTasks(t *testing.T) {
+	d := NewDispatcher(DispatcherConfig{Workers: 1, PerUserLimit: 1, QueueSize: 10})
+	d.Start()
+
+	release := make(chan struct{})
+	d.Submit(1, func() { <-release })
+	waitFor(t, func() bool { r, _ := d.Stats(); return r == 1 })
+
+	var ran, dropped int32
+	d.SubmitWithDrop(2, func() { atomic.AddInt32(&ran, 1) }, func() { atomic.AddInt32(&dropped, 1) })
+	d.Submit(3, func() { atomic.AddInt32(&ran, 1) })
+
+	if n := d.Close(); n != 2 {
+		t.Errorf("Expected 2 dropped tasks, got %d", n)
+	}
+	if dropped != 1 {
+		t.Errorf("Expected onDrop to be called once, got %d", dropped)
+	}
+	if _, err := d.Submit(4, func() {}); err != ErrStopped {
+		t.Errorf("Expected ErrStopped after Close, got %v", err)
+	}
+
+	close(release)
+	if err := d.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	if ran != 0 {
+		t.Errorf("Dropped tasks must not run, %d ran", ran)
+	}
+}
+
+func TestDispatcher_WaitDeadline(t *testing.T) {
+	d := NewDispatcher(DispatcherConfig{Workers: 1, PerUserLimit: 1, QueueSize: 10})
+	d.Start()
+
+	release := make(chan struct{})
+	defer close(release)
+	d.Submit(1, func() { <-release })
+	waitFor(t, func() bool { r, _ := d.Stats(); return r == 1 })
+	d.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := d.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded while task is running, got %v", err)
+	}
+}
+
+func TestNewDispatcher_Defaults(t *testing.T) {
+	d := NewDispatcher(DispatcherConfig{})
+	defaults := DefaultDispatcherConfig()
+
+	if d.cfg != defaults {
+		t.Errorf("Expected default config %+v, got %+v", defaults, d.cfg)
+	}
+}
+
+func TestDispatcherConfigFromEnv(t *testing.T) {
+	t.Setenv("WORKER_POOL_SIZE", "8")
+	t.Setenv("USER_CONCURRENCY_LIMIT", "2")
+	t.Setenv("QUEUE_SIZE", "invalid")
+
+	cfg := DispatcherConfigFromEnv()
+
+	if cfg.Workers != 8 {
+		t.Errorf("Expected 8 workers, got %d", cfg.Workers)
+	}
+	if cfg.PerUserLimit != 2 {
+		t.Errorf("Expected per-user limit 2, got %d", cfg.PerUserLimit)
+	}
+	if cfg.QueueSize != DefaultDispatcherConfig().QueueSize {
+		t.Errorf("Expected default queue size for invalid value, got %d", cfg.QueueSize)
+	}
+}
@@ -0,0 +1,385 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/artur/solid-spoon/internal/database/models"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// HandlerFunc processes an update a handler agreed to handle
+type HandlerFunc func(ctx context.Context, bot Sender, update tgbotapi.Update)
+
+// Middleware wraps a HandlerFunc with behaviour shared by all handlers
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Chain wraps h with middlewares, the first one being the outermost
+func Chain(h HandlerFunc, middlewares ...Middleware) HandlerFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// Named is implemented by handlers whose messages are recorded in command
+// statistics under a name
+type Named interface {
+	CommandName() string
+}
+
+// UserStore resolves the Telegram user an update came from
+type UserStore interface {
+	UpsertFromTelegram(tgUser *tgbotapi.User) (*models.User, error)
+}
+
+// StatsRecorder records command statistics
+type StatsRecorder interface {
+	RecordCommand(userID int64, command string) error
+}
+
+// SettingsStore loads preferences a Telegram user chose
+type SettingsStore interface {
+	Get(telegramUserID int64) (*models.UserSettings, error)
+}
+
+type contextKey int
+
+const (
+	userKey contextKey = iota
+	handlerKey
+	scheduleKey
+	languageKey
+)
+
+// WithUser returns a copy of ctx carrying the user
+func WithUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, userKey, user)
+}
+
+// UserFromContext returns the user loaded by the LoadUser middleware, or nil
+func UserFromContext(ctx context.Context) *models.User {
+	user, _ := ctx.Value(userKey).(*models.User)
+	return user
+}
+
+func withHandler(ctx context.Context, h Handler) context.Context {
+	return context.WithValue(ctx, handlerKey, h)
+}
+
+// HandlerFromContext returns the handler the update is dispatched to
+func HandlerFromContext(ctx context.Context) Handler {
+	h, _ := ctx.Value(handlerKey).(Handler)
+	return h
+}
+
+// WithSchedule returns a copy of ctx carrying the function queueing long work
+// of the update
+func WithSchedule(ctx context.Context, schedule ScheduleFunc) context.Context {
+	return context.WithValue(ctx, scheduleKey, schedule)
+}
+
+// ScheduleFromContext returns the function queueing long work of the update
+// behind the user's other tasks, or nil outside of the bot, e.g. in tests
+func ScheduleFromContext(ctx context.Context) ScheduleFunc {
+	schedule, _ := ctx.Value(scheduleKey).(ScheduleFunc)
+	return schedule
+}
+
+// WithLanguage returns a copy of ctx carrying the interface language of the user
+func WithLanguage(ctx context.Context, lang string) context.Context {
+	return context.WithValue(ctx, languageKey, lang)
+}
+
+// LanguageFromContext returns the language loaded by the LoadLanguage
+// middleware, Russian if there is none
+func LanguageFromContext(ctx context.Context) string {
+	if lang, ok := ctx.Value(languageKey).(string); ok {
+		return lang
+	}
+	return models.LanguageRussian
+}
+
+// replyTexts - ответы middleware пользователю по языкам, недостающие берутся на русском
+var replyTexts = map[string]map[string]string{
+	models.LanguageRussian: {
+		"panic":        "⚠️ Что-то пошло не так. Мы уже разбираемся, попробуйте ещё раз позже",
+		"denied":       "⛔ Доступ к боту ограничен",
+		"rate_limited": "⏳ Слишком много запросов, подождите немного",
+	},
+	models.LanguageEnglish: {
+		"panic":        "⚠️ Something went wrong. We are looking into it, please try again later",
+		"denied":       "⛔ Access to the bot is restricted",
+		"rate_limited": "⏳ Too many requests, please wait a little",
+	},
+}
+
+// replyText returns the reply in the language of the update's user
+func replyText(ctx context.Context, key string) string {
+	if text, ok := replyTexts[LanguageFromContext(ctx)][key]; ok {
+		return text
+	}
+	return replyTexts[models.LanguageRussian][key]
+}
+
+// updateFrom returns the Telegram user who sent the update
+func updateFrom(update tgbotapi.Update) *tgbotapi.User {
+	switch {
+	case update.Message != nil:
+		return update.Message.From
+	case update.CallbackQuery != nil:
+		return update.CallbackQuery.From
+	}
+	return nil
+}
+
+// reply tells the user why the update was not processed: callbacks get a
+// popup, messages a reply in the chat
+func reply(bot Sender, update tgbotapi.Update, text string) {
+	var err error
+	switch {
+	case update.CallbackQuery != nil:
+		_, err = bot.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, text))
+	case update.Message != nil:
+		_, err = bot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, text))
+	}
+	if err != nil {
+		log.Printf("[BOT] Failed to reply: %v", err)
+	}
+}
+
+// Logging logs which handler processed an update and how long it took
+func Logging() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, bot Sender, update tgbotapi.Update) {
+			start := time.Now()
+			next(ctx, bot, update)
+			log.Printf("[BOT] %T handled update %d in %s",
+				HandlerFromContext(ctx), update.UpdateID, time.Since(start).Round(time.Millisecond))
+		}
+	}
+}
+
+// Recover stops a panic in a handler from crashing the bot: it logs the
+// stack, apologizes to the user and sends a report through reporter, which
+// may be nil
+func Recover(reporter *ErrorReporter) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, bot Sender, update tgbotapi.Update) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					return
+				}
+
+				stack := debug.Stack()
+				handler := fmt.Sprintf("%T", HandlerFromContext(ctx))
+				log.Printf("[BOT] Panic in %s on update %d: %v\n%s", handler, update.UpdateID, r, stack)
+
+				reply(bot, update, replyText(ctx, "panic"))
+
+				report := PanicReport{
+					Handler:  handler,
+					UpdateID: update.UpdateID,
+					Value:    r,
+					Stack:    stack,
+				}
+				if from := updateFrom(update); from != nil {
+					report.UserID = from.ID
+					report.Username = from.UserName
+				}
+				reporter.Report(report)
+			}()
+			next(ctx, bot, update)
+		}
+	}
+}
+
+// AccessControl lets through only users listed in allowed. An empty list
+// allows everyone.
+func AccessControl(allowed []int64) Middleware {
+	set := make(map[int64]bool, len(allowed))
+	for _, id := range allowed {
+		set[id] = true
+	}
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, bot Sender, update tgbotapi.Update) {
+			if len(set) > 0 {
+				from := updateFrom(update)
+				if from == nil || !set[from.ID] {
+					log.Printf("[BOT] Access denied for update %d", update.UpdateID)
+					reply(bot, update, replyText(ctx, "denied"))
+					return
+				}
+			}
+			next(ctx, bot, update)
+		}
+	}
+}
+
+// AllowedUsersFromEnv reads ALLOWED_USER_IDS: comma separated Telegram user IDs
+func AllowedUsersFromEnv() []int64 {
+	var ids []int64
+	for _, field := range strings.Split(os.Getenv("ALLOWED_USER_IDS"), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			log.Printf("[BOT] Invalid user ID in ALLOWED_USER_IDS: %q", field)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// RateLimitConfig configures the per-user token bucket
+type RateLimitConfig struct {
+	// Burst - сколько обновлений подряд можно прислать без ожидания
+	Burst int
+	// PerMinute - с какой скоростью восстанавливается запас
+	PerMinute int
+}
+
+// RateLimitConfigFromEnv reads RATE_LIMIT_BURST and RATE_LIMIT_PER_MINUTE
+func RateLimitConfigFromEnv() RateLimitConfig {
+	return RateLimitConfig{
+		Burst:     envInt("RATE_LIMIT_BURST", 10),
+		PerMinute: envInt("RATE_LIMIT_PER_MINUTE", 20),
+	}
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// warned - пользователя уже предупредили, повторно не пишем, пока запас не восстановится
+	warned bool
+}
+
+// rateLimiter is a per-user token bucket
+type rateLimiter struct {
+	cfg RateLimitConfig
+	now func() time.Time
+
+	mu      sync.Mutex
+	buckets map[int64]*bucket
+}
+
+func newRateLimiter(cfg RateLimitConfig) *rateLimiter {
+	return &rateLimiter{
+		cfg:     cfg,
+		now:     time.Now,
+		buckets: make(map[int64]*bucket),
+	}
+}
+
+// allow takes a token from the user's bucket. When there are none left, it
+// also reports whether the user should be warned about it.
+func (l *rateLimiter) allow(userID int64) (ok, warn bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, found := l.buckets[userID]
+	if !found {
+		b = &bucket{tokens: float64(l.cfg.Burst), updated: now}
+		l.buckets[userID] = b
+	}
+
+	refill := now.Sub(b.updated).Minutes() * float64(l.cfg.PerMinute)
+	b.tokens = min(b.tokens+refill, float64(l.cfg.Burst))
+	b.updated = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		b.warned = false
+		return true, false
+	}
+
+	warn = !b.warned
+	b.warned = true
+	return false, warn
+}
+
+// RateLimit drops updates of users that send them faster than cfg allows
+func RateLimit(cfg RateLimitConfig) Middleware {
+	limiter := newRateLimiter(cfg)
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, bot Sender, update tgbotapi.Update) {
+			if from := updateFrom(update); from != nil {
+				ok, warn := limiter.allow(from.ID)
+				if !ok {
+					log.Printf("[BOT] Rate limit exceeded by user %d", from.ID)
+					if warn || update.CallbackQuery != nil {
+						reply(bot, update, replyText(ctx, "rate_limited"))
+					}
+					return
+				}
+			}
+			next(ctx, bot, update)
+		}
+	}
+}
+
+// LoadLanguage puts the interface language the user chose in settings into
+// the request context. Replies of middlewares before it are in Russian.
+func LoadLanguage(settings SettingsStore) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, bot Sender, update tgbotapi.Update) {
+			if from := updateFrom(update); from != nil {
+				userSettings, err := settings.Get(from.ID)
+				if err != nil {
+					log.Printf("[BOT] Failed to load settings: %v", err)
+				} else {
+					ctx = WithLanguage(ctx, userSettings.Language)
+				}
+			}
+			next(ctx, bot, update)
+		}
+	}
+}
+
+// LoadUser saves the sender of the update and puts it into the request context
+func LoadUser(users UserStore) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, bot Sender, update tgbotapi.Update) {
+			if from := updateFrom(update); from != nil {
+				user, err := users.UpsertFromTelegram(from)
+				if err != nil {
+					log.Printf("[BOT] Failed to upsert user: %v", err)
+				} else {
+					ctx = WithUser(ctx, user)
+				}
+			}
+			next(ctx, bot, update)
+		}
+	}
+}
+
+// RecordStats records messages handled by Named handlers in command statistics.
+// It needs LoadUser earlier in the chain.
+func RecordStats(stats StatsRecorder) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, bot Sender, update tgbotapi.Update) {
+			named, ok := HandlerFromContext(ctx).(Named)
+			user := UserFromContext(ctx)
+			if ok && user != nil && update.Message != nil {
+				if err := stats.RecordCommand(user.ID, named.CommandName()); err != nil {
+					log.Printf("[BOT] Failed to record command: %v", err)
+				}
+			}
+			next(ctx, bot, update)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/artur/solid-spoon/internal/database/models"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+type fakeUserStore struct {
+	err error
+}
+
+func (s *fakeUserStore) UpsertFromTelegram(tgUser *tgbotapi.User) (*models.User, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &models.User{ID: tgUser.ID * 10, TelegramUserID: tgUser.ID, FirstName: tgUser.FirstName}, nil
+}
+
+type fakeStats struct {
+	commands []string
+}
+
+func (s *fakeStats) RecordCommand(userID int64, command string) error {
+	s.commands = append(s.commands, command)
+	return nil
+}
+
+type fakeSettingsStore struct {
+	languages map[int64]string
+}
+
+func (s *fakeSettingsStore) Get(telegramUserID int64) (*models.UserSettings, error) {
+	lang, ok := s.languages[telegramUserID]
+	if !ok {
+		return nil, errors.New("db is down")
+	}
+	return &models.UserSettings{TelegramUserID: telegramUserID, Language: lang}, nil
+}
+
+type namedHandler struct {
+	MockHandler
+}
+
+func (h *namedHandler) CommandName() string {
+	return "test"
+}
+
+func messageFrom(userID int64, text string) tgbotapi.Update {
+	return tgbotapi.Update{
+		Message: &tgbotapi.Message{
+			Text: text,
+			From: &tgbotapi.User{ID: userID, FirstName: "Test"},
+			Chat: &tgbotapi.Chat{ID: userID},
+		},
+	}
+}
+
+func TestChain_Order(t *testing.T) {
+	var calls []string
+	mark := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx context.Context, bot Sender, update tgbotapi.Update) {
+				calls = append(calls, name)
+				next(ctx, bot, update)
+			}
+		}
+	}
+
+	h := Chain(func(ctx context.Context, bot Sender, update tgbotapi.Update) {
+		calls = append(calls, "handler")
+	}, mark("first"), mark("second"))
+	h(context.Background(), nil, tgbotapi.Update{})
+
+	if got := strings.Join(calls, ","); got != "first,second,handler" {
+		t.Errorf("Unexpected call order: %s", got)
+	}
+}
+
+func TestLoadUserAndRecordStats(t *testing.T) {
+	stats := &fakeStats{}
+	handler := &namedHandler{}
+
+	var got *models.User
+	h := Chain(func(ctx context.Context, bot Sender, update tgbotapi.Update) {
+		got = UserFromContext(ctx)
+	}, LoadUser(&fakeUserStore{}), RecordStats(stats))
+
+	ctx := withHandler(context.Background(), handler)
+	h(ctx, nil, messageFrom(7, "hello"))
+
+	if got == nil || got.TelegramUserID != 7 || got.ID != 70 {
+		t.Fatalf("Expected user 7 in context, got %+v", got)
+	}
+	if len(stats.commands) != 1 || stats.commands[0] != "test" {
+		t.Errorf("Expected command 'test' to be recorded, got %v", stats.commands)
+	}
+
+	// Callback не считается командой
+	callback := tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{From: &tgbotapi.User{ID: 7}}}
+	h(ctx, nil, callback)
+	if len(stats.commands) != 1 {
+		t.Errorf("Callbacks must not be recorded, got %v", stats.commands)
+	}
+}
+
+func TestLoadUser_StoreError(t *testing.T) {
+	called := false
+	h := Chain(func(ctx context.Context, bot Sender, update tgbotapi.Update) {
+		called = true
+		if UserFromContext(ctx) != nil {
+			t.Error("Expected no user in context when store fails")
+		}
+	}, LoadUser(&fakeUserStore{err: errors.New("db is down")}))
+
+	h(context.Background(), nil, messageFrom(7, "hello"))
+
+	if !called {
+		t.Error("Handler should still run when the user cannot be loaded")
+	}
+}
+
+func TestAccessControl(t *testing.T) {
+	api, fake := newFakeTelegramAPI(t)
+
+	var handled []int64
+	h := Chain(func(ctx context.Context, bot Sender, update tgbotapi.Update) {
+		handled = append(handled, update.Message.From.ID)
+	}, AccessControl([]int64{1, 2}))
+
+	h(context.Background(), api, messageFrom(1, "hi"))
+	h(context.Background(), api, messageFrom(3, "hi"))
+
+	if len(handled) != 1 || handled[0] != 1 {
+		t.Errorf("Expected only user 1 to pass, got %v", handled)
+	}
+	if msg := fake.Last("sendMessage"); msg == nil || msg.Params["chat_id"] != "3" {
+		t.Errorf("Expected denied user to be notified, got %v", msg)
+	}
+
+	// Пустой список пропускает всех
+	open := Chain(func(ctx context.Context, bot Sender, update tgbotapi.Update) {
+		handled = append(handled, update.Message.From.ID)
+	}, AccessControl(nil))
+	open(context.Background(), api, messageFrom(3, "hi"))
+	if len(handled) != 2 {
+		t.Error("Expected everyone to pass with an empty allow list")
+	}
+}
+
+func TestLoadLanguage_Replies(t *testing.T) {
+	api, fake := newFakeTelegramAPI(t)
+	settings := &fakeSettingsStore{languages: map[int64]string{3: models.LanguageEnglish}}
+
+	h := Chain(func(ctx context.Context, bot Sender, update tgbotapi.Update) {
+		t.Error("Denied user must not reach the handler")
+	}, LoadLanguage(settings), AccessControl([]int64{1}))
+
+	h(context.Background(), api, messageFrom(3, "hi"))
+	if msg := fake.Last("sendMessage"); msg == nil || msg.Params["text"] != "⛔ Access to the bot is restricted" {
+		t.Errorf("Expected the refusal in English, got %v", msg)
+	}
+
+	// Без настроек отвечаем по-русски
+	h(context.Background(), api, messageFrom(4, "hi"))
+	if msg := fake.Last("sendMessage"); msg == nil || msg.Params["text"] != "⛔ Доступ к боту ограничен" {
+		t.Errorf("Expected the refusal in Russian, got %v", msg)
+	}
+}
+
+func TestAllowedUsersFromEnv(t *testing.T) {
+	t.Setenv("ALLOWED_USER_IDS", "1, 22,bad,,333")
+
+	ids := AllowedUsersFromEnv()
+	if len(ids) != 3 || ids[0] != 1 || ids[1] != 22 || ids[2] != 333 {
+		t.Errorf("Unexpected IDs: %v", ids)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := newRateLimiter(RateLimitConfig{Burst: 2, PerMinute: 6})
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := limiter.allow(1); !ok {
+			t.Fatalf("Request %d within burst was rejected", i+1)
+		}
+	}
+
+	ok, warn := limiter.allow(1)
+	if ok || !warn {
+		t.Errorf("Expected rejection with warning, got ok=%v warn=%v", ok, warn)
+	}
+	ok, warn = limiter.allow(1)
+	if ok || warn {
+		t.Errorf("Expected silent rejection, got ok=%v warn=%v", ok, warn)
+	}
+
+	// Другой пользователь не ограничен
+	if ok, _ := limiter.allow(2); !ok {
+		t.Error("Other user must not be limited")
+	}
+
+	// 6 в минуту - один запрос каждые 10 секунд
+	now = now.Add(10 * time.Second)
+	if ok, _ := limiter.allow(1); !ok {
+		t.Error("Expected a token to be refilled after 10 seconds")
+	}
+	if ok, _ := limiter.allow(1); ok {
+		t.Error("Expected only one token to be refilled")
+	}
+}
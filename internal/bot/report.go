@@ -0,0 +1,165 @@
+package bot
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// errorReportWindow - одинаковые отчёты о падениях присылаются не чаще раза за окно
+	errorReportWindow = time.Hour
+	// stackExcerptLines - сколько строк стека попадает в отчёт (две строки на кадр)
+	stackExcerptLines = 16
+)
+
+// PanicReport describes a panic recovered while processing an update
+type PanicReport struct {
+	Handler  string
+	UpdateID int
+	UserID   int64
+	Username string
+	Value    any
+	Stack    []byte
+}
+
+// ErrorReporter forwards panic reports to the admin chat. Reports of a panic
+// at the same place are sent at most once per window, so a crash loop does
+// not flood the chat.
+type ErrorReporter struct {
+	api    Sender
+	chatID int64
+	window time.Duration
+	now    func() time.Time
+
+	mu   sync.Mutex
+	seen map[string]*reportState
+}
+
+type reportState struct {
+	sentAt     time.Time
+	suppressed int
+}
+
+// NewErrorReporter creates a reporter sending to chatID
+func NewErrorReporter(api Sender, chatID int64) *ErrorReporter {
+	return &ErrorReporter{
+		api:    api,
+		chatID: chatID,
+		window: errorReportWindow,
+		now:    time.Now,
+		seen:   make(map[string]*reportState),
+	}
+}
+
+// Report sends the report unless the same panic was reported recently. It is
+// safe to call on a nil reporter, which does nothing: Recover has already
+// logged the panic.
+func (r *ErrorReporter) Report(report PanicReport) {
+	if r == nil {
+		return
+	}
+
+	suppressed, ok := r.admit(report)
+	if !ok {
+		log.Printf("[BOT] Panic report for %s suppressed as duplicate", report.Handler)
+		return
+	}
+
+	msg := tgbotapi.NewMessage(r.chatID, formatPanicReport(report, suppressed))
+	msg.ParseMode = "HTML"
+	if _, err := r.api.Send(msg); err != nil {
+		log.Printf("[BOT] Failed to send panic report: %v", err)
+	}
+}
+
+// admit decides whether the report should be sent and returns how many
+// duplicates were suppressed since the last one
+func (r *ErrorReporter) admit(report PanicReport) (int, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := report.Handler + "|" + panicLocation(report.Stack)
+	now := r.now()
+
+	state, found := r.seen[key]
+	if found && now.Sub(state.sentAt) < r.window {
+		state.suppressed++
+		return 0, false
+	}
+
+	suppressed := 0
+	if found {
+		suppressed = state.suppressed
+	}
+	r.seen[key] = &reportState{sentAt: now}
+	return suppressed, true
+}
+
+func formatPanicReport(report PanicReport, suppressed int) string {
+	user := fmt.Sprintf("%d", report.UserID)
+	if report.Username != "" {
+		user = "@" + report.Username + " (" + user + ")"
+	}
+
+	var b strings.Builder
+	b.WriteString("💥 <b>Паника в обработчике</b>\n\n")
+	fmt.Fprintf(&b, "🧩 Обработчик: <code>%s</code>\n", html.EscapeString(report.Handler))
+	fmt.Fprintf(&b, "🔢 Update: <code>%d</code>\n", report.UpdateID)
+	fmt.Fprintf(&b, "👤 Пользователь: %s\n", html.EscapeString(user))
+	fmt.Fprintf(&b, "❌ Ошибка: <code>%s</code>\n", html.EscapeString(fmt.Sprint(report.Value)))
+	if suppressed > 0 {
+		fmt.Fprintf(&b, "🔁 С прошлого отчёта повторилась ещё %d раз\n", suppressed)
+	}
+	fmt.Fprintf(&b, "\n<pre>%s</pre>", html.EscapeString(stackExcerpt(report.Stack, stackExcerptLines)))
+	return b.String()
+}
+
+// panicFrames returns stack lines below the runtime panic machinery, i.e.
+// starting with the function that panicked
+func panicFrames(stack []byte) []string {
+	lines := strings.Split(strings.TrimSpace(string(stack)), "\n")
+
+	start := 0
+	for i, line := range lines {
+		if strings.Contains(line, "runtime/panic.go") {
+			start = i + 1
+		}
+	}
+	if start == 0 && len(lines) > 0 {
+		// Нет кадров паники - пропускаем только заголовок goroutine
+		start = 1
+	}
+	if start > len(lines) {
+		return nil
+	}
+	return lines[start:]
+}
+
+// stackExcerpt returns the first lines of the stack starting at the panic
+func stackExcerpt(stack []byte, maxLines int) string {
+	frames := panicFrames(stack)
+	if len(frames) > maxLines {
+		frames = frames[:maxLines]
+	}
+	return strings.Join(frames, "\n")
+}
+
+// panicLocation returns file:line where the panic happened
+func panicLocation(stack []byte) string {
+	frames := panicFrames(stack)
+	if len(frames) < 2 {
+		return ""
+	}
+	location := strings.TrimSpace(frames[1])
+	// Отбрасываем смещение " +0x1d", оно не нужно для сравнения
+	if i := strings.LastIndex(location, " +0x"); i >= 0 {
+		location = location[:i]
+	}
+	return location
+}
@@ -0,0 +1,130 @@
+package bot
+
+import (
+	"context"
+	"runtime/debug"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// capturePanic returns the stack of a real panic for stack parsing tests
+func capturePanic() (stack []byte) {
+	defer func() {
+		recover()
+		stack = debug.Stack()
+	}()
+	var m map[string]int
+	m["boom"]++
+	return nil
+}
+
+func TestStackExcerpt_StartsAtPanic(t *testing.T) {
+	stack := capturePanic()
+
+	excerpt := stackExcerpt(stack, 4)
+	lines := strings.Split(excerpt, "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected 4 lines, got %d:\n%s", len(lines), excerpt)
+	}
+	if !strings.Contains(lines[0], "capturePanic") {
+		t.Errorf("Expected excerpt to start at the panicking function, got %q", lines[0])
+	}
+
+	location := panicLocation(stack)
+	if !strings.Contains(location, "report_test.go:") || strings.Contains(location, "+0x") {
+		t.Errorf("Unexpected panic location: %q", location)
+	}
+}
+
+func TestErrorReporter_Deduplicates(t *testing.T) {
+	api, fake := newFakeTelegramAPI(t)
+	reporter := NewErrorReporter(api, 999)
+	now := time.Now()
+	reporter.now = func() time.Time { return now }
+
+	report := PanicReport{
+		Handler:  "*handler.LinkHandler",
+		UpdateID: 42,
+		UserID:   7,
+		Username: "tester",
+		Value:    "assignment to entry in nil map",
+		Stack:    capturePanic(),
+	}
+
+	reporter.Report(report)
+	reporter.Report(report)
+	reporter.Report(report)
+
+	if n := len(fake.Messages()); n != 1 {
+		t.Fatalf("Expected 1 report during the window, got %d", n)
+	}
+	params := fake.Last("sendMessage").Params
+	if params["chat_id"] != "999" {
+		t.Errorf("Expected report in admin chat, got %q", params["chat_id"])
+	}
+	for _, want := range []string{"*handler.LinkHandler", "42", "@tester (7)", "nil map", "capturePanic"} {
+		if !strings.Contains(params["text"], want) {
+			t.Errorf("Expected report to contain %q:\n%s", want, params["text"])
+		}
+	}
+
+	// Другой обработчик - другой отчёт
+	other := report
+	other.Handler = "*handler.StartHandler"
+	reporter.Report(other)
+	if n := len(fake.Messages()); n != 2 {
+		t.Errorf("Expected a separate report for another handler, got %d", n)
+	}
+
+	// После окна отчёт приходит снова с числом пропущенных повторов
+	now = now.Add(errorReportWindow + time.Minute)
+	reporter.Report(report)
+	if n := len(fake.Messages()); n != 3 {
+		t.Fatalf("Expected report after the window, got %d", n)
+	}
+	if text := fake.Last("sendMessage").Params["text"]; !strings.Contains(text, "ещё 2 раз") {
+		t.Errorf("Expected suppressed count in report:\n%s", text)
+	}
+}
+
+func TestErrorReporter_Nil(t *testing.T) {
+	var reporter *ErrorReporter
+	reporter.Report(PanicReport{Handler: "x"})
+}
+
+func TestRecover_ReportsPanic(t *testing.T) {
+	api, fake := newFakeTelegramAPI(t)
+	reporter := NewErrorReporter(api, 999)
+
+	h := Chain(func(ctx context.Context, bot Sender, update tgbotapi.Update) {
+		var callback *tgbotapi.CallbackQuery
+		_ = callback.Message.Chat.ID
+	}, Recover(reporter))
+
+	ctx := withHandler(context.Background(), &MockHandler{})
+	update := messageFrom(7, "boom")
+	update.UpdateID = 5
+	h(ctx, api, update)
+
+	if n := len(fake.Messages()); n != 2 {
+		t.Fatalf("Expected reply to user and admin report, got %d messages", n)
+	}
+	var userNotified, adminNotified bool
+	for _, msg := range fake.Messages() {
+		switch msg.Params["chat_id"] {
+		case "7":
+			userNotified = true
+		case "999":
+			adminNotified = strings.Contains(msg.Params["text"], "*bot.MockHandler")
+		}
+	}
+	if !userNotified {
+		t.Error("Expected user to get a generic error message")
+	}
+	if !adminNotified {
+		t.Error("Expected admin report naming the handler")
+	}
+}
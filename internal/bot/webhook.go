@@ -0,0 +1,227 @@
+package bot
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// secretTokenHeader - заголовок, в котором Telegram присылает secret_token вебхука
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// webhookShutdownTimeout - сколько ждём завершения запросов при остановке сервера
+const webhookShutdownTimeout = 10 * time.Second
+
+// WebhookConfig configures receiving updates through a webhook instead of
+// long polling
+type WebhookConfig struct {
+	// URL - публичный адрес бота, например https://bot.example.com.
+	// Пустой URL означает режим long polling.
+	URL string
+	// Path - путь, на который Telegram присылает обновления
+	Path string
+	// ListenAddr - адрес встроенного HTTP сервера
+	ListenAddr string
+	// SecretToken проверяется в заголовке X-Telegram-Bot-Api-Secret-Token.
+	// Если не задан, генерируется случайный при каждом запуске.
+	SecretToken string
+	// CertFile и KeyFile включают TLS на встроенном сервере
+	CertFile string
+	KeyFile  string
+	// UploadCert отправляет CertFile в Telegram - нужно для самоподписанных сертификатов
+	UploadCert bool
+}
+
+// DefaultWebhookConfig returns settings used when no environment overrides are given
+func DefaultWebhookConfig() WebhookConfig {
+	return WebhookConfig{
+		Path:       "/webhook",
+		ListenAddr: ":8443",
+	}
+}
+
+// WebhookConfigFromEnv reads webhook settings from environment variables:
+// WEBHOOK_URL, WEBHOOK_PATH, WEBHOOK_LISTEN, WEBHOOK_SECRET, WEBHOOK_TLS_CERT,
+// WEBHOOK_TLS_KEY and WEBHOOK_UPLOAD_CERT
+func WebhookConfigFromEnv() WebhookConfig {
+	cfg := DefaultWebhookConfig()
+
+	cfg.URL = strings.TrimRight(os.Getenv("WEBHOOK_URL"), "/")
+	if path := os.Getenv("WEBHOOK_PATH"); path != "" {
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		cfg.Path = path
+	}
+	if addr := os.Getenv("WEBHOOK_LISTEN"); addr != "" {
+		cfg.ListenAddr = addr
+	}
+	cfg.SecretToken = os.Getenv("WEBHOOK_SECRET")
+	cfg.CertFile = os.Getenv("WEBHOOK_TLS_CERT")
+	cfg.KeyFile = os.Getenv("WEBHOOK_TLS_KEY")
+	cfg.UploadCert = os.Getenv("WEBHOOK_UPLOAD_CERT") == "true"
+
+	return cfg
+}
+
+// Enabled reports whether updates should be received through the webhook
+func (c WebhookConfig) Enabled() bool {
+	return c.URL != ""
+}
+
+// webhook is an embedded HTTP server receiving updates pushed by Telegram
+type webhook struct {
+	api     *tgbotapi.BotAPI
+	cfg     WebhookConfig
+	updates chan tgbotapi.Update
+	server  *http.Server
+	addr    net.Addr
+}
+
+func newWebhook(api *tgbotapi.BotAPI, cfg WebhookConfig) (*webhook, error) {
+	if cfg.SecretToken == "" {
+		token, err := randomSecretToken()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+		}
+		cfg.SecretToken = token
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, errors.New("both WEBHOOK_TLS_CERT and WEBHOOK_TLS_KEY must be set")
+	}
+
+	w := &webhook{
+		api:     api,
+		cfg:     cfg,
+		updates: make(chan tgbotapi.Update, api.Buffer),
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(cfg.Path, w)
+	w.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return w, nil
+}
+
+// randomSecretToken generates a token allowed by Telegram: 1-256 characters A-Z, a-z, 0-9, _ and -
+func randomSecretToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// start begins listening, registers the webhook in Telegram and returns the
+// channel updates are delivered to
+func (w *webhook) start() (tgbotapi.UpdatesChannel, error) {
+	listener, err := net.Listen("tcp", w.cfg.ListenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", w.cfg.ListenAddr, err)
+	}
+	w.addr = listener.Addr()
+
+	go func() {
+		var err error
+		if w.cfg.CertFile != "" {
+			err = w.server.ServeTLS(listener, w.cfg.CertFile, w.cfg.KeyFile)
+		} else {
+			err = w.server.Serve(listener)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("[WEBHOOK] Server stopped: %v", err)
+		}
+	}()
+	log.Printf("[WEBHOOK] Listening on %s%s", w.addr, w.cfg.Path)
+
+	// Регистрируем вебхук только когда сервер уже принимает соединения
+	if err := w.register(); err != nil {
+		w.server.Close()
+		return nil, err
+	}
+
+	return w.updates, nil
+}
+
+// register points Telegram at our public URL
+func (w *webhook) register() error {
+	params := make(tgbotapi.Params)
+	params["url"] = w.cfg.URL + w.cfg.Path
+	params["secret_token"] = w.cfg.SecretToken
+
+	var err error
+	if w.cfg.UploadCert {
+		files := []tgbotapi.RequestFile{{Name: "certificate", Data: tgbotapi.FilePath(w.cfg.CertFile)}}
+		_, err = w.api.UploadFiles("setWebhook", params, files)
+	} else {
+		_, err = w.api.MakeRequest("setWebhook", params)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set webhook: %w", err)
+	}
+
+	log.Printf("[WEBHOOK] Webhook registered: %s", params["url"])
+	return nil
+}
+
+// stop deletes the webhook, waits for in-flight requests and closes the updates channel
+func (w *webhook) stop() {
+	if _, err := w.api.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		log.Printf("[WEBHOOK] Failed to delete webhook: %v", err)
+	} else {
+		log.Printf("[WEBHOOK] Webhook deleted")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookShutdownTimeout)
+	defer cancel()
+	if err := w.server.Shutdown(ctx); err != nil {
+		log.Printf("[WEBHOOK] Failed to shut down server: %v", err)
+	}
+
+	// После Shutdown обработчики больше не пишут в канал
+	close(w.updates)
+}
+
+// ServeHTTP accepts an update pushed by Telegram
+func (w *webhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	secret := r.Header.Get(secretTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(w.cfg.SecretToken)) != 1 {
+		log.Printf("[WEBHOOK] Rejected request from %s: invalid secret token", r.RemoteAddr)
+		http.Error(rw, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var update tgbotapi.Update
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		log.Printf("[WEBHOOK] Failed to decode update: %v", err)
+		http.Error(rw, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case w.updates <- update:
+		rw.WriteHeader(http.StatusOK)
+	case <-r.Context().Done():
+		// Telegram повторит доставку, раз мы не ответили 200
+	}
+}
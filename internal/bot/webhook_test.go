@@ -0,0 +1,226 @@
+package bot
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/artur/solid-spoon/internal/bot/bottest"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func newFakeTelegramAPI(t *testing.T) (*tgbotapi.BotAPI, *bottest.Server) {
+	t.Helper()
+	srv := bottest.NewServer(t)
+	return srv.API(t), srv
+}
+
+// freeAddr returns a local address with a port that is free at the moment
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find free port: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func postUpdate(t *testing.T, url, secret, body string) int {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set(secretTokenHeader, secret)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to post update: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestWebhookConfigFromEnv(t *testing.T) {
+	t.Setenv("WEBHOOK_URL", "https://bot.example.com/")
+	t.Setenv("WEBHOOK_PATH", "tg/updates")
+	t.Setenv("WEBHOOK_LISTEN", ":9000")
+	t.Setenv("WEBHOOK_SECRET", "s3cret")
+	t.Setenv("WEBHOOK_TLS_CERT", "/certs/cert.pem")
+	t.Setenv("WEBHOOK_TLS_KEY", "/certs/key.pem")
+	t.Setenv("WEBHOOK_UPLOAD_CERT", "true")
+
+	cfg := WebhookConfigFromEnv()
+	want := WebhookConfig{
+		URL:         "https://bot.example.com",
+		Path:        "/tg/updates",
+		ListenAddr:  ":9000",
+		SecretToken: "s3cret",
+		CertFile:    "/certs/cert.pem",
+		KeyFile:     "/certs/key.pem",
+		UploadCert:  true,
+	}
+	if cfg != want {
+		t.Errorf("WebhookConfigFromEnv() = %+v, want %+v", cfg, want)
+	}
+	if !cfg.Enabled() {
+		t.Error("Expected webhook to be enabled")
+	}
+}
+
+func TestWebhookConfigFromEnv_Defaults(t *testing.T) {
+	t.Setenv("WEBHOOK_URL", "")
+
+	cfg := WebhookConfigFromEnv()
+	if cfg.Enabled() {
+		t.Error("Expected long polling when WEBHOOK_URL is empty")
+	}
+	if cfg.Path != "/webhook" || cfg.ListenAddr != ":8443" {
+		t.Errorf("Unexpected defaults: %+v", cfg)
+	}
+}
+
+func TestNewWebhook_GeneratesSecret(t *testing.T) {
+	api, _ := newFakeTelegramAPI(t)
+
+	w, err := newWebhook(api, WebhookConfig{URL: "https://bot.example.com", Path: "/webhook"})
+	if err != nil {
+		t.Fatalf("newWebhook failed: %v", err)
+	}
+	if len(w.cfg.SecretToken) != 64 {
+		t.Errorf("Expected generated 64 character secret, got %q", w.cfg.SecretToken)
+	}
+
+	_, err = newWebhook(api, WebhookConfig{URL: "https://bot.example.com", Path: "/webhook", CertFile: "cert.pem"})
+	if err == nil {
+		t.Error("Expected error when TLS key is missing")
+	}
+}
+
+func TestWebhook_ServeHTTP(t *testing.T) {
+	api, _ := newFakeTelegramAPI(t)
+	w, err := newWebhook(api, WebhookConfig{Path: "/webhook", SecretToken: "s3cret"})
+	if err != nil {
+		t.Fatalf("newWebhook failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		secret string
+		body   string
+		want   int
+	}{
+		{"valid update", http.MethodPost, "s3cret", `{"update_id":1,"message":{"text":"hi"}}`, http.StatusOK},
+		{"missing secret", http.MethodPost, "", `{"update_id":2}`, http.StatusForbidden},
+		{"wrong secret", http.MethodPost, "guess", `{"update_id":3}`, http.StatusForbidden},
+		{"wrong method", http.MethodGet, "s3cret", "", http.StatusMethodNotAllowed},
+		{"invalid json", http.MethodPost, "s3cret", "{", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/webhook", strings.NewReader(tt.body))
+			if tt.secret != "" {
+				req.Header.Set(secretTokenHeader, tt.secret)
+			}
+			rec := httptest.NewRecorder()
+
+			w.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+
+	select {
+	case update := <-w.updates:
+		if update.UpdateID != 1 || update.Message == nil || update.Message.Text != "hi" {
+			t.Errorf("Unexpected update: %+v", update)
+		}
+	default:
+		t.Fatal("Expected valid update to be delivered")
+	}
+	select {
+	case update := <-w.updates:
+		t.Errorf("Rejected update %d must not be delivered", update.UpdateID)
+	default:
+	}
+}
+
+func TestBot_RunWebhook(t *testing.T) {
+	api, fake := newFakeTelegramAPI(t)
+	addr := freeAddr(t)
+
+	w, err := newWebhook(api, WebhookConfig{
+		URL:         "https://bot.example.com",
+		Path:        "/tg",
+		ListenAddr:  addr,
+		SecretToken: "s3cret",
+	})
+	if err != nil {
+		t.Fatalf("newWebhook failed: %v", err)
+	}
+
+	b := &Bot{
+		api:        api,
+		handlers:   make([]Handler, 0),
+		dispatcher: NewDispatcher(DefaultDispatcherConfig()),
+		webhook:    w,
+	}
+
+	handled := make(chan string, 1)
+	b.RegisterHandler(&MockHandler{
+		canHandleFunc: func(update tgbotapi.Update) bool { return update.Message != nil },
+		handleFunc: func(bot Sender, update tgbotapi.Update) {
+			handled <- update.Message.Text
+		},
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- b.Run() }()
+
+	waitFor(t, func() bool { return fake.Last("setWebhook") != nil })
+	params := fake.Last("setWebhook").Params
+	if params["url"] != "https://bot.example.com/tg" {
+		t.Errorf("Expected webhook URL with path, got %q", params["url"])
+	}
+	if params["secret_token"] != "s3cret" {
+		t.Errorf("Expected secret token to be registered, got %q", params["secret_token"])
+	}
+
+	body := `{"update_id":10,"message":{"message_id":1,"text":"hello","from":{"id":7},"chat":{"id":7}}}`
+	if code := postUpdate(t, "http://"+addr+"/tg", "s3cret", body); code != http.StatusOK {
+		t.Fatalf("Expected 200 for valid update, got %d", code)
+	}
+	if code := postUpdate(t, "http://"+addr+"/tg", "wrong", body); code != http.StatusForbidden {
+		t.Errorf("Expected 403 for wrong secret, got %d", code)
+	}
+
+	select {
+	case text := <-handled:
+		if text != "hello" {
+			t.Errorf("Expected handler to receive 'hello', got %q", text)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Update was not dispatched to handler")
+	}
+
+	b.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after Stop")
+	}
+
+	if fake.Last("deleteWebhook") == nil {
+		t.Error("Expected webhook to be deleted on stop")
+	}
+}
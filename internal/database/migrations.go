@@ -1,6 +1,7 @@
 package database
 
 import (
+	"database/sql"
 	"fmt"
 	"log"
 )
@@ -52,6 +53,66 @@ func (db *DB) Migrate() error {
 		`CREATE INDEX IF NOT EXISTS idx_video_downloads_user_id ON video_downloads(user_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_video_downloads_video_id ON video_downloads(video_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_video_downloads_executed_at ON video_downloads(executed_at)`,
+
+		// Download jobs table
+		`CREATE TABLE IF NOT EXISTS download_jobs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			telegram_user_id INTEGER NOT NULL,
+			chat_id INTEGER NOT NULL,
+			message_id INTEGER NOT NULL,
+			video_id TEXT NOT NULL,
+			quality TEXT NOT NULL,
+			status TEXT NOT NULL,
+			error TEXT,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_download_jobs_status ON download_jobs(status)`,
+
+		// Playlist and channel downloads, each video is a download job of the batch
+		`CREATE TABLE IF NOT EXISTS download_batches (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			telegram_user_id INTEGER NOT NULL,
+			playlist_id TEXT NOT NULL,
+			title TEXT,
+			first_item INTEGER NOT NULL,
+			last_item INTEGER NOT NULL,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Telegram file_id cache table
+		`CREATE TABLE IF NOT EXISTS telegram_files (
+			video_id TEXT NOT NULL,
+			quality TEXT NOT NULL,
+			mode TEXT NOT NULL,
+			file_id TEXT NOT NULL,
+			title TEXT,
+			caption TEXT,
+			compressed BOOLEAN DEFAULT 0,
+			file_size_bytes INTEGER,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (video_id, quality, mode)
+		)`,
+
+		// yt-dlp metadata cache table, data is parsed yt-dlp -j output
+		`CREATE TABLE IF NOT EXISTS video_metadata (
+			video_id TEXT PRIMARY KEY,
+			data BLOB NOT NULL,
+			fetched_at DATETIME NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_video_metadata_fetched_at ON video_metadata(fetched_at)`,
+
+		// User preferences table, a row appears once the user changes anything
+		`CREATE TABLE IF NOT EXISTS user_settings (
+			telegram_user_id INTEGER PRIMARY KEY,
+			default_quality TEXT NOT NULL DEFAULT '',
+			delivery_mode TEXT NOT NULL DEFAULT 'document',
+			caption TEXT NOT NULL DEFAULT 'full',
+			delete_link BOOLEAN NOT NULL DEFAULT 1,
+			language TEXT NOT NULL DEFAULT 'ru',
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
 	}
 
 	for i, migration := range migrations {
@@ -60,6 +121,65 @@ func (db *DB) Migrate() error {
 		}
 	}
 
+	// Columns added to already existing tables
+	columns := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"video_downloads", "part_number", "INTEGER NOT NULL DEFAULT 1"},
+		{"video_downloads", "part_count", "INTEGER NOT NULL DEFAULT 1"},
+		{"video_downloads", "playlist_id", "TEXT"},
+		{"download_jobs", "batch_id", "INTEGER NOT NULL DEFAULT 0"},
+		{"download_jobs", "clip", "TEXT NOT NULL DEFAULT ''"},
+		{"download_jobs", "subtitles", "TEXT NOT NULL DEFAULT ''"},
+		{"video_downloads", "clip", "TEXT"},
+	}
+
+	for _, c := range columns {
+		if err := db.addColumnIfMissing(c.table, c.column, c.definition); err != nil {
+			return fmt.Errorf("migration of %s.%s failed: %w", c.table, c.column, err)
+		}
+	}
+
+	// Индексы по добавленным колонкам можно создать только после них
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_download_jobs_batch_id ON download_jobs(batch_id)`); err != nil {
+		return fmt.Errorf("migration of download_jobs.batch_id index failed: %w", err)
+	}
+
 	log.Printf("[DB] Migrations completed successfully")
 	return nil
 }
+
+// addColumnIfMissing adds a column to an existing table, SQLite has no ADD COLUMN IF NOT EXISTS
+func (db *DB) addColumnIfMissing(table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
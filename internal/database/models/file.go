@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Delivery modes a file can be sent with
+const (
+	ModeDocument = "document"
+	ModeAudio    = "audio"
+	// ModeVideo - видео через sendVideo, Telegram показывает его плеером
+	ModeVideo = "video"
+)
+
+// CachedFile represents a file already uploaded to Telegram that can be resent by file_id
+type CachedFile struct {
+	VideoID       string
+	Quality       string
+	Mode          string
+	FileID        string
+	Title         string
+	Caption       string
+	Compressed    bool
+	FileSizeBytes int64
+	CreatedAt     time.Time
+}
@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// JobStatus is a state of a download job
+type JobStatus string
+
+const (
+	// JobPending - задача ждёт, пока пользователь выберет субтитры, и не возобновляется после перезапуска
+	JobPending   JobStatus = "pending"
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobDone      JobStatus = "done"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+// DownloadJob represents a persistent video download request
+type DownloadJob struct {
+	ID             int64
+	TelegramUserID int64
+	ChatID         int64
+	MessageID      int
+	VideoID        string
+	Quality        string
+	Status         JobStatus
+	Error          string
+	Attempts       int
+	// BatchID - плейлист, частью которого является задача, 0 для одиночных видео
+	BatchID int64
+	// Clip - фрагмент видео в формате downloader.Clip.String, пусто для видео целиком
+	Clip string
+	// Subtitles - выбранные субтитры в формате downloader.Subtitles.String, пусто если без них
+	Subtitles string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// DownloadBatch is a playlist or channel download, its videos are download
+// jobs with the batch ID
+type DownloadBatch struct {
+	ID             int64
+	TelegramUserID int64
+	PlaylistID     string
+	Title          string
+	// FirstItem and LastItem are the 1-based range of playlist videos to download
+	FirstItem int
+	LastItem  int
+	CreatedAt time.Time
+}
+
+// BatchProgress counts jobs of a batch by status
+type BatchProgress struct {
+	Total     int
+	Done      int
+	Failed    int
+	Cancelled int
+}
+
+// Finished returns how many jobs of the batch are over, successfully or not
+func (p BatchProgress) Finished() int {
+	return p.Done + p.Failed + p.Cancelled
+}
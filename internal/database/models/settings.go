@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Caption verbosity of sent videos
+const (
+	// CaptionFull - название и начало описания
+	CaptionFull  = "full"
+	CaptionTitle = "title"
+	CaptionNone  = "none"
+)
+
+// Interface languages
+const (
+	LanguageRussian = "ru"
+	LanguageEnglish = "en"
+)
+
+// UserSettings represents preferences a user chooses with /settings
+type UserSettings struct {
+	TelegramUserID int64
+	// DefaultQuality - качество, в котором ссылки скачиваются сразу без выбора, пусто - спрашивать
+	DefaultQuality string
+	// DeliveryMode - ModeDocument, ModeVideo или ModeAudio (ссылки сразу скачиваются аудио)
+	DeliveryMode string
+	// Caption - подробность подписи к видео: CaptionFull, CaptionTitle или CaptionNone
+	Caption string
+	// DeleteLink - удалять сообщение пользователя со ссылкой после ответа бота
+	DeleteLink bool
+	Language   string
+	UpdatedAt  time.Time
+}
+
+// DefaultSettings returns settings of a user who has not changed anything
+func DefaultSettings(telegramUserID int64) *UserSettings {
+	return &UserSettings{
+		TelegramUserID: telegramUserID,
+		DeliveryMode:   ModeDocument,
+		Caption:        CaptionFull,
+		DeleteLink:     true,
+		Language:       LanguageRussian,
+	}
+}
@@ -12,5 +12,13 @@ type VideoDownload struct {
 	Quality       string
 	Compressed    bool
 	FileSizeBytes int64
-	ExecutedAt    time.Time
+	// PartNumber and PartCount are set when the video was sent in several parts
+	PartNumber int
+	PartCount  int
+	// PlaylistID is set when the video was downloaded as part of a playlist
+	PlaylistID string
+	// Clip holds the bounds of a downloaded fragment as "<start>-<end>" in
+	// seconds, empty when the whole video was downloaded
+	Clip       string
+	ExecutedAt time.Time
 }
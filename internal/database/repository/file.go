@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/artur/solid-spoon/internal/database/models"
+)
+
+// FileCacheRepository handles persistence of Telegram file_id cache
+type FileCacheRepository struct {
+	db *sql.DB
+}
+
+// NewFileCacheRepository creates a new FileCacheRepository
+func NewFileCacheRepository(db *sql.DB) *FileCacheRepository {
+	return &FileCacheRepository{db: db}
+}
+
+// Get returns a cached file for the video, quality and mode, nil if not cached
+func (r *FileCacheRepository) Get(videoID, quality, mode string) (*models.CachedFile, error) {
+	query := `
+		SELECT video_id, quality, mode, file_id, title, caption, compressed, file_size_bytes, created_at
+		FROM telegram_files
+		WHERE video_id = ? AND quality = ? AND mode = ?
+	`
+
+	file := &models.CachedFile{}
+	var title, caption sql.NullString
+	var size sql.NullInt64
+
+	err := r.db.QueryRow(query, videoID, quality, mode).Scan(
+		&file.VideoID,
+		&file.Quality,
+		&file.Mode,
+		&file.FileID,
+		&title,
+		&caption,
+		&file.Compressed,
+		&size,
+		&file.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cached file: %w", err)
+	}
+
+	file.Title = title.String
+	file.Caption = caption.String
+	file.FileSizeBytes = size.Int64
+
+	return file, nil
+}
+
+// Save stores or replaces a cached file
+func (r *FileCacheRepository) Save(file *models.CachedFile) error {
+	if file.CreatedAt.IsZero() {
+		file.CreatedAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO telegram_files
+		(video_id, quality, mode, file_id, title, caption, compressed, file_size_bytes, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(video_id, quality, mode) DO UPDATE SET
+			file_id = excluded.file_id,
+			title = excluded.title,
+			caption = excluded.caption,
+			compressed = excluded.compressed,
+			file_size_bytes = excluded.file_size_bytes,
+			created_at = excluded.created_at
+	`
+
+	_, err := r.db.Exec(query,
+		file.VideoID,
+		file.Quality,
+		file.Mode,
+		file.FileID,
+		file.Title,
+		file.Caption,
+		file.Compressed,
+		file.FileSizeBytes,
+		file.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save cached file: %w", err)
+	}
+	return nil
+}
+
+// Delete removes a cached file, used when Telegram rejects a stale file_id
+func (r *FileCacheRepository) Delete(videoID, quality, mode string) error {
+	query := `DELETE FROM telegram_files WHERE video_id = ? AND quality = ? AND mode = ?`
+	if _, err := r.db.Exec(query, videoID, quality, mode); err != nil {
+		return fmt.Errorf("failed to delete cached file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/artur/solid-spoon/internal/database/models"
+	"github.com/artur/solid-spoon/internal/database/repository"
+)
+
+func TestFileCacheRepository_SaveAndGet(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := repository.NewFileCacheRepository(db)
+
+	file := &models.CachedFile{
+		VideoID:       "dQw4w9WgXcQ",
+		Quality:       "720p",
+		Mode:          models.ModeDocument,
+		FileID:        "BQACAgIAAxkBAAIB",
+		Title:         "Test Video",
+		Caption:       "Test Video\n\nDescription",
+		FileSizeBytes: 1024000,
+	}
+	if err := repo.Save(file); err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+
+	cached, err := repo.Get("dQw4w9WgXcQ", "720p", models.ModeDocument)
+	if err != nil {
+		t.Fatalf("Failed to get file: %v", err)
+	}
+	if cached == nil {
+		t.Fatal("Expected cached file")
+	}
+	if cached.FileID != "BQACAgIAAxkBAAIB" || cached.Caption != file.Caption || cached.FileSizeBytes != 1024000 {
+		t.Errorf("Cached file does not match: %+v", cached)
+	}
+
+	// Другой режим или качество - промах
+	if other, _ := repo.Get("dQw4w9WgXcQ", "720p", models.ModeAudio); other != nil {
+		t.Error("Expected cache miss for another mode")
+	}
+	if other, _ := repo.Get("dQw4w9WgXcQ", "360p", models.ModeDocument); other != nil {
+		t.Error("Expected cache miss for another quality")
+	}
+}
+
+func TestFileCacheRepository_SaveReplaces(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := repository.NewFileCacheRepository(db)
+
+	repo.Save(&models.CachedFile{VideoID: "v", Quality: "720p", Mode: models.ModeDocument, FileID: "old"})
+	if err := repo.Save(&models.CachedFile{VideoID: "v", Quality: "720p", Mode: models.ModeDocument, FileID: "new"}); err != nil {
+		t.Fatalf("Failed to replace file: %v", err)
+	}
+
+	cached, _ := repo.Get("v", "720p", models.ModeDocument)
+	if cached == nil || cached.FileID != "new" {
+		t.Errorf("Expected file_id to be replaced, got %+v", cached)
+	}
+}
+
+func TestFileCacheRepository_Delete(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := repository.NewFileCacheRepository(db)
+
+	repo.Save(&models.CachedFile{VideoID: "v", Quality: "audio", Mode: models.ModeAudio, FileID: "id"})
+	if err := repo.Delete("v", "audio", models.ModeAudio); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+
+	cached, err := repo.Get("v", "audio", models.ModeAudio)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cached != nil {
+		t.Error("Expected cached file to be deleted")
+	}
+}
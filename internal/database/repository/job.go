@@ -0,0 +1,282 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/artur/solid-spoon/internal/database/models"
+)
+
+// JobRepository handles download job persistence
+type JobRepository struct {
+	db *sql.DB
+}
+
+// NewJobRepository creates a new JobRepository
+func NewJobRepository(db *sql.DB) *JobRepository {
+	return &JobRepository{db: db}
+}
+
+// Create stores a new job in queued state and fills its ID
+func (r *JobRepository) Create(job *models.DownloadJob) error {
+	now := time.Now()
+	job.Status = models.JobQueued
+	job.CreatedAt = now
+	job.UpdatedAt = now
+
+	query := `
+		INSERT INTO download_jobs
+		(telegram_user_id, chat_id, message_id, video_id, quality, status, attempts, batch_id, clip, subtitles, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	res, err := r.db.Exec(query,
+		job.TelegramUserID,
+		job.ChatID,
+		job.MessageID,
+		job.VideoID,
+		job.Quality,
+		job.Status,
+		job.Attempts,
+		job.BatchID,
+		job.Clip,
+		job.Subtitles,
+		job.CreatedAt,
+		job.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create job: %w", err)
+	}
+
+	job.ID, err = res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get job id: %w", err)
+	}
+
+	return nil
+}
+
+// MarkRunning switches a job to running state and increments its attempt counter
+func (r *JobRepository) MarkRunning(job *models.DownloadJob) error {
+	job.Status = models.JobRunning
+	job.Attempts++
+	job.UpdatedAt = time.Now()
+
+	query := `UPDATE download_jobs SET status = ?, attempts = ?, updated_at = ? WHERE id = ?`
+	if _, err := r.db.Exec(query, job.Status, job.Attempts, job.UpdatedAt, job.ID); err != nil {
+		return fmt.Errorf("failed to mark job running: %w", err)
+	}
+	return nil
+}
+
+// Finish sets a terminal or queued status with an optional error message
+func (r *JobRepository) Finish(job *models.DownloadJob, status models.JobStatus, errMsg string) error {
+	job.Status = status
+	job.Error = errMsg
+	job.UpdatedAt = time.Now()
+
+	query := `UPDATE download_jobs SET status = ?, error = ?, updated_at = ? WHERE id = ?`
+	if _, err := r.db.Exec(query, job.Status, job.Error, job.UpdatedAt, job.ID); err != nil {
+		return fmt.Errorf("failed to update job status: %w", err)
+	}
+	return nil
+}
+
+// SetSubtitles stores the subtitles chosen for the job
+func (r *JobRepository) SetSubtitles(job *models.DownloadJob, subtitles string) error {
+	job.Subtitles = subtitles
+	job.UpdatedAt = time.Now()
+
+	query := `UPDATE download_jobs SET subtitles = ?, updated_at = ? WHERE id = ?`
+	if _, err := r.db.Exec(query, job.Subtitles, job.UpdatedAt, job.ID); err != nil {
+		return fmt.Errorf("failed to set job subtitles: %w", err)
+	}
+	return nil
+}
+
+// GetByID retrieves a job by ID, returns nil if it does not exist
+func (r *JobRepository) GetByID(id int64) (*models.DownloadJob, error) {
+	query := `SELECT ` + jobColumns + ` FROM download_jobs WHERE id = ?`
+
+	job, err := scanJob(r.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	return job, nil
+}
+
+// ListUnfinished returns queued and running jobs, oldest first
+func (r *JobRepository) ListUnfinished() ([]*models.DownloadJob, error) {
+	query := `SELECT ` + jobColumns + ` FROM download_jobs WHERE status IN (?, ?) ORDER BY id`
+
+	rows, err := r.db.Query(query, models.JobQueued, models.JobRunning)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unfinished jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*models.DownloadJob
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// CreateBatch stores a new playlist download and fills its ID
+func (r *JobRepository) CreateBatch(batch *models.DownloadBatch) error {
+	batch.CreatedAt = time.Now()
+
+	query := `
+		INSERT INTO download_batches
+		(telegram_user_id, playlist_id, title, first_item, last_item, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	res, err := r.db.Exec(query,
+		batch.TelegramUserID,
+		batch.PlaylistID,
+		batch.Title,
+		batch.FirstItem,
+		batch.LastItem,
+		batch.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create batch: %w", err)
+	}
+
+	batch.ID, err = res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get batch id: %w", err)
+	}
+
+	return nil
+}
+
+// GetBatch retrieves a batch by ID, returns nil if it does not exist
+func (r *JobRepository) GetBatch(id int64) (*models.DownloadBatch, error) {
+	query := `
+		SELECT id, telegram_user_id, playlist_id, title, first_item, last_item, created_at
+		FROM download_batches
+		WHERE id = ?
+	`
+
+	batch := &models.DownloadBatch{}
+	var title sql.NullString
+	err := r.db.QueryRow(query, id).Scan(
+		&batch.ID,
+		&batch.TelegramUserID,
+		&batch.PlaylistID,
+		&title,
+		&batch.FirstItem,
+		&batch.LastItem,
+		&batch.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get batch: %w", err)
+	}
+
+	batch.Title = title.String
+	return batch, nil
+}
+
+// BatchProgress counts the jobs of a batch by status
+func (r *JobRepository) BatchProgress(batchID int64) (models.BatchProgress, error) {
+	var p models.BatchProgress
+
+	rows, err := r.db.Query(`SELECT status, COUNT(*) FROM download_jobs WHERE batch_id = ? GROUP BY status`, batchID)
+	if err != nil {
+		return p, fmt.Errorf("failed to count batch jobs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			status models.JobStatus
+			count  int
+		)
+		if err := rows.Scan(&status, &count); err != nil {
+			return p, fmt.Errorf("failed to scan batch progress: %w", err)
+		}
+		p.Total += count
+		switch status {
+		case models.JobDone:
+			p.Done = count
+		case models.JobFailed:
+			p.Failed = count
+		case models.JobCancelled:
+			p.Cancelled = count
+		}
+	}
+
+	return p, rows.Err()
+}
+
+// NextInBatch returns the oldest queued job of a batch, nil when none is left
+func (r *JobRepository) NextInBatch(batchID int64) (*models.DownloadJob, error) {
+	query := `SELECT ` + jobColumns + ` FROM download_jobs WHERE batch_id = ? AND status = ? ORDER BY id LIMIT 1`
+
+	job, err := scanJob(r.db.QueryRow(query, batchID, models.JobQueued))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get next batch job: %w", err)
+	}
+	return job, nil
+}
+
+// CancelBatch cancels the jobs of a batch that have not started yet
+func (r *JobRepository) CancelBatch(batchID int64) error {
+	query := `UPDATE download_jobs SET status = ?, updated_at = ? WHERE batch_id = ? AND status = ?`
+	if _, err := r.db.Exec(query, models.JobCancelled, time.Now(), batchID, models.JobQueued); err != nil {
+		return fmt.Errorf("failed to cancel batch: %w", err)
+	}
+	return nil
+}
+
+// jobColumns are the download_jobs columns read by scanJob
+const jobColumns = `id, telegram_user_id, chat_id, message_id, video_id, quality, status, error, attempts, batch_id, clip, subtitles, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanJob(row rowScanner) (*models.DownloadJob, error) {
+	job := &models.DownloadJob{}
+	var errMsg sql.NullString
+
+	err := row.Scan(
+		&job.ID,
+		&job.TelegramUserID,
+		&job.ChatID,
+		&job.MessageID,
+		&job.VideoID,
+		&job.Quality,
+		&job.Status,
+		&errMsg,
+		&job.Attempts,
+		&job.BatchID,
+		&job.Clip,
+		&job.Subtitles,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Error = errMsg.String
+	return job, nil
+}
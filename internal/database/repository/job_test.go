@@ -0,0 +1,233 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/artur/solid-spoon/internal/database/models"
+	"github.com/artur/solid-spoon/internal/database/repository"
+)
+
+func newTestJob() *models.DownloadJob {
+	return &models.DownloadJob{
+		TelegramUserID: 12345,
+		ChatID:         12345,
+		MessageID:      42,
+		VideoID:        "dQw4w9WgXcQ",
+		Quality:        "720p",
+	}
+}
+
+func TestJobRepository_Create(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := repository.NewJobRepository(db)
+
+	job := newTestJob()
+	job.Clip = "83-130"
+	if err := repo.Create(job); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	if job.ID == 0 {
+		t.Fatal("Expected job ID to be set")
+	}
+	if job.Status != models.JobQueued {
+		t.Errorf("Expected status queued, got %s", job.Status)
+	}
+
+	stored, err := repo.GetByID(job.ID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if stored == nil {
+		t.Fatal("Expected job to be found")
+	}
+	if stored.VideoID != "dQw4w9WgXcQ" || stored.MessageID != 42 || stored.Quality != "720p" || stored.Clip != "83-130" {
+		t.Errorf("Stored job does not match: %+v", stored)
+	}
+}
+
+func TestJobRepository_GetByID_NotFound(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := repository.NewJobRepository(db)
+
+	job, err := repo.GetByID(999)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if job != nil {
+		t.Error("Expected nil for non-existent job")
+	}
+}
+
+func TestJobRepository_StatusTransitions(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := repository.NewJobRepository(db)
+
+	job := newTestJob()
+	repo.Create(job)
+
+	if err := repo.MarkRunning(job); err != nil {
+		t.Fatalf("Failed to mark running: %v", err)
+	}
+	if err := repo.Finish(job, models.JobFailed, "boom"); err != nil {
+		t.Fatalf("Failed to finish job: %v", err)
+	}
+
+	stored, _ := repo.GetByID(job.ID)
+	if stored.Status != models.JobFailed {
+		t.Errorf("Expected status failed, got %s", stored.Status)
+	}
+	if stored.Error != "boom" {
+		t.Errorf("Expected error 'boom', got %q", stored.Error)
+	}
+	if stored.Attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", stored.Attempts)
+	}
+}
+
+func TestJobRepository_ListUnfinished(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := repository.NewJobRepository(db)
+
+	queued := newTestJob()
+	running := newTestJob()
+	done := newTestJob()
+	failed := newTestJob()
+	cancelled := newTestJob()
+	pending := newTestJob()
+	for _, job := range []*models.DownloadJob{queued, running, done, failed, cancelled, pending} {
+		repo.Create(job)
+	}
+	// Задача, ждущая выбора субтитров, не возобновляется
+	repo.Finish(pending, models.JobPending, "")
+
+	repo.MarkRunning(running)
+	repo.MarkRunning(done)
+	repo.Finish(done, models.JobDone, "")
+	repo.Finish(failed, models.JobFailed, "error")
+	repo.Finish(cancelled, models.JobCancelled, "")
+
+	jobs, err := repo.ListUnfinished()
+	if err != nil {
+		t.Fatalf("Failed to list jobs: %v", err)
+	}
+
+	if len(jobs) != 2 {
+		t.Fatalf("Expected 2 unfinished jobs, got %d", len(jobs))
+	}
+	if jobs[0].ID != queued.ID || jobs[1].ID != running.ID {
+		t.Errorf("Unexpected jobs order: %d, %d", jobs[0].ID, jobs[1].ID)
+	}
+	if jobs[1].Status != models.JobRunning {
+		t.Errorf("Expected second job to be running, got %s", jobs[1].Status)
+	}
+}
+
+func TestJobRepository_Batch(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := repository.NewJobRepository(db)
+
+	batch := &models.DownloadBatch{
+		TelegramUserID: 12345,
+		PlaylistID:     "youtube-playlist:PLtest",
+		Title:          "Test Playlist",
+		FirstItem:      1,
+		LastItem:       3,
+	}
+	if err := repo.CreateBatch(batch); err != nil {
+		t.Fatalf("Failed to create batch: %v", err)
+	}
+	if batch.ID == 0 {
+		t.Fatal("Expected batch ID to be set")
+	}
+
+	stored, err := repo.GetBatch(batch.ID)
+	if err != nil {
+		t.Fatalf("Failed to get batch: %v", err)
+	}
+	if stored == nil || stored.PlaylistID != batch.PlaylistID || stored.Title != "Test Playlist" || stored.LastItem != 3 {
+		t.Errorf("Stored batch does not match: %+v", stored)
+	}
+
+	var jobs []*models.DownloadJob
+	for range 3 {
+		job := newTestJob()
+		job.BatchID = batch.ID
+		repo.Create(job)
+		jobs = append(jobs, job)
+	}
+	// Одиночная задача не относится к плейлисту
+	repo.Create(newTestJob())
+
+	next, err := repo.NextInBatch(batch.ID)
+	if err != nil {
+		t.Fatalf("Failed to get next job: %v", err)
+	}
+	if next == nil || next.ID != jobs[0].ID || next.BatchID != batch.ID {
+		t.Fatalf("Expected first job of the batch, got %+v", next)
+	}
+
+	repo.MarkRunning(jobs[0])
+	repo.Finish(jobs[0], models.JobDone, "")
+	if next, _ := repo.NextInBatch(batch.ID); next == nil || next.ID != jobs[1].ID {
+		t.Errorf("Expected second job to be next, got %+v", next)
+	}
+
+	repo.Finish(jobs[1], models.JobFailed, "error")
+	if err := repo.CancelBatch(batch.ID); err != nil {
+		t.Fatalf("Failed to cancel batch: %v", err)
+	}
+	if next, _ := repo.NextInBatch(batch.ID); next != nil {
+		t.Errorf("Expected no queued jobs after cancel, got %+v", next)
+	}
+
+	progress, err := repo.BatchProgress(batch.ID)
+	if err != nil {
+		t.Fatalf("Failed to count progress: %v", err)
+	}
+	want := models.BatchProgress{Total: 3, Done: 1, Failed: 1, Cancelled: 1}
+	if progress != want {
+		t.Errorf("Progress = %+v, want %+v", progress, want)
+	}
+}
+
+func TestJobRepository_GetBatch_NotFound(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	batch, err := repository.NewJobRepository(db).GetBatch(999)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if batch != nil {
+		t.Errorf("Expected nil batch, got %+v", batch)
+	}
+}
+
+func TestJobRepository_SetSubtitles(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := repository.NewJobRepository(db)
+
+	job := newTestJob()
+	repo.Create(job)
+	if err := repo.SetSubtitles(job, "burn:en:auto"); err != nil {
+		t.Fatalf("Failed to set subtitles: %v", err)
+	}
+
+	stored, _ := repo.GetByID(job.ID)
+	if stored == nil || stored.Subtitles != "burn:en:auto" {
+		t.Errorf("Expected subtitles to be stored, got %+v", stored)
+	}
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// MetadataRepository stores yt-dlp metadata of videos, it backs the
+// downloader metadata cache between restarts
+type MetadataRepository struct {
+	db *sql.DB
+}
+
+// NewMetadataRepository creates a new MetadataRepository
+func NewMetadataRepository(db *sql.DB) *MetadataRepository {
+	return &MetadataRepository{db: db}
+}
+
+// Get returns stored metadata of the video and when it was fetched, nil data if not stored
+func (r *MetadataRepository) Get(videoID string) ([]byte, time.Time, error) {
+	query := `SELECT data, fetched_at FROM video_metadata WHERE video_id = ?`
+
+	var data []byte
+	var fetchedAt time.Time
+	err := r.db.QueryRow(query, videoID).Scan(&data, &fetchedAt)
+	if err == sql.ErrNoRows {
+		return nil, time.Time{}, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to get video metadata: %w", err)
+	}
+	return data, fetchedAt, nil
+}
+
+// Save stores or replaces metadata of the video
+func (r *MetadataRepository) Save(videoID string, data []byte, fetchedAt time.Time) error {
+	query := `
+		INSERT INTO video_metadata (video_id, data, fetched_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(video_id) DO UPDATE SET
+			data = excluded.data,
+			fetched_at = excluded.fetched_at
+	`
+	if _, err := r.db.Exec(query, videoID, data, fetchedAt); err != nil {
+		return fmt.Errorf("failed to save video metadata: %w", err)
+	}
+	return nil
+}
+
+// DeleteOlderThan removes metadata fetched before the given time and returns how many videos were removed
+func (r *MetadataRepository) DeleteOlderThan(before time.Time) (int64, error) {
+	res, err := r.db.Exec(`DELETE FROM video_metadata WHERE fetched_at < ?`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete old video metadata: %w", err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,63 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/artur/solid-spoon/internal/database/repository"
+)
+
+func TestMetadataRepository_SaveAndGet(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := repository.NewMetadataRepository(db)
+
+	if data, _, err := repo.Get("dQw4w9WgXcQ"); err != nil || data != nil {
+		t.Fatalf("Expected a miss for unknown video, got %q, %v", data, err)
+	}
+
+	fetchedAt := time.Now().Add(-time.Minute).Truncate(time.Second)
+	if err := repo.Save("dQw4w9WgXcQ", []byte(`{"id":"old"}`), fetchedAt); err != nil {
+		t.Fatalf("Failed to save metadata: %v", err)
+	}
+	if err := repo.Save("dQw4w9WgXcQ", []byte(`{"id":"dQw4w9WgXcQ"}`), fetchedAt); err != nil {
+		t.Fatalf("Failed to replace metadata: %v", err)
+	}
+
+	data, got, err := repo.Get("dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatalf("Failed to get metadata: %v", err)
+	}
+	if string(data) != `{"id":"dQw4w9WgXcQ"}` {
+		t.Errorf("Expected replaced metadata, got %q", data)
+	}
+	if !got.Equal(fetchedAt) {
+		t.Errorf("Expected fetched_at %v, got %v", fetchedAt, got)
+	}
+}
+
+func TestMetadataRepository_DeleteOlderThan(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := repository.NewMetadataRepository(db)
+
+	now := time.Now()
+	repo.Save("old", []byte(`{}`), now.Add(-2*time.Hour))
+	repo.Save("fresh", []byte(`{}`), now)
+
+	deleted, err := repo.DeleteOlderThan(now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to delete metadata: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("Expected 1 deleted video, got %d", deleted)
+	}
+	if data, _, _ := repo.Get("old"); data != nil {
+		t.Error("Expected old metadata to be deleted")
+	}
+	if data, _, _ := repo.Get("fresh"); data == nil {
+		t.Error("Expected fresh metadata to stay")
+	}
+}
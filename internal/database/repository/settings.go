@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/artur/solid-spoon/internal/database/models"
+)
+
+// SettingsRepository handles persistence of user preferences
+type SettingsRepository struct {
+	db *sql.DB
+}
+
+// NewSettingsRepository creates a new SettingsRepository
+func NewSettingsRepository(db *sql.DB) *SettingsRepository {
+	return &SettingsRepository{db: db}
+}
+
+// Get returns settings of the user, defaults if the user has not changed any
+func (r *SettingsRepository) Get(telegramUserID int64) (*models.UserSettings, error) {
+	query := `
+		SELECT telegram_user_id, default_quality, delivery_mode, caption, delete_link, language, updated_at
+		FROM user_settings
+		WHERE telegram_user_id = ?
+	`
+
+	settings := &models.UserSettings{}
+	err := r.db.QueryRow(query, telegramUserID).Scan(
+		&settings.TelegramUserID,
+		&settings.DefaultQuality,
+		&settings.DeliveryMode,
+		&settings.Caption,
+		&settings.DeleteLink,
+		&settings.Language,
+		&settings.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return models.DefaultSettings(telegramUserID), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user settings: %w", err)
+	}
+	return settings, nil
+}
+
+// Save stores or replaces settings of the user
+func (r *SettingsRepository) Save(settings *models.UserSettings) error {
+	settings.UpdatedAt = time.Now()
+
+	query := `
+		INSERT INTO user_settings
+		(telegram_user_id, default_quality, delivery_mode, caption, delete_link, language, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(telegram_user_id) DO UPDATE SET
+			default_quality = excluded.default_quality,
+			delivery_mode = excluded.delivery_mode,
+			caption = excluded.caption,
+			delete_link = excluded.delete_link,
+			language = excluded.language,
+			updated_at = excluded.updated_at
+	`
+
+	_, err := r.db.Exec(query,
+		settings.TelegramUserID,
+		settings.DefaultQuality,
+		settings.DeliveryMode,
+		settings.Caption,
+		settings.DeleteLink,
+		settings.Language,
+		settings.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save user settings: %w", err)
+	}
+	return nil
+}
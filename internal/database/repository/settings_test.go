@@ -0,0 +1,61 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/artur/solid-spoon/internal/database/models"
+	"github.com/artur/solid-spoon/internal/database/repository"
+)
+
+func TestSettingsRepository_Defaults(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := repository.NewSettingsRepository(db)
+
+	settings, err := repo.Get(12345)
+	if err != nil {
+		t.Fatalf("Failed to get settings: %v", err)
+	}
+	want := models.DefaultSettings(12345)
+	if *settings != *want {
+		t.Errorf("Expected defaults %+v, got %+v", want, settings)
+	}
+}
+
+func TestSettingsRepository_SaveAndGet(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := repository.NewSettingsRepository(db)
+
+	settings := models.DefaultSettings(12345)
+	settings.DefaultQuality = "720p"
+	settings.DeliveryMode = models.ModeVideo
+	settings.Caption = models.CaptionTitle
+	settings.DeleteLink = false
+	settings.Language = models.LanguageEnglish
+	if err := repo.Save(settings); err != nil {
+		t.Fatalf("Failed to save settings: %v", err)
+	}
+
+	// Повторное сохранение обновляет строку
+	settings.Caption = models.CaptionNone
+	if err := repo.Save(settings); err != nil {
+		t.Fatalf("Failed to update settings: %v", err)
+	}
+
+	got, err := repo.Get(12345)
+	if err != nil {
+		t.Fatalf("Failed to get settings: %v", err)
+	}
+	if got.DefaultQuality != "720p" || got.DeliveryMode != models.ModeVideo || got.Caption != models.CaptionNone ||
+		got.DeleteLink || got.Language != models.LanguageEnglish {
+		t.Errorf("Settings do not match: %+v", got)
+	}
+
+	// Настройки другого пользователя не затронуты
+	if other, _ := repo.Get(67890); other.DeliveryMode != models.ModeDocument {
+		t.Errorf("Expected defaults for another user, got %+v", other)
+	}
+}
@@ -148,3 +148,14 @@ func TestUserRepository_GetTotalUsers(t *testing.T) {
 		t.Errorf("Expected 2 users, got %d", count)
 	}
 }
+
+func TestMigrate_Idempotent(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	// Running migrations again must not fail on already added columns
+	dbWrapper := &database.DB{DB: db}
+	if err := dbWrapper.Migrate(); err != nil {
+		t.Fatalf("Second migration failed: %v", err)
+	}
+}
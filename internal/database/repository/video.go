@@ -17,14 +17,19 @@ func NewVideoRepository(db *sql.DB) *VideoRepository {
 	return &VideoRepository{db: db}
 }
 
-// RecordDownload records a video download
+// RecordDownload records a video download, a video sent in parts is recorded once per part
 func (r *VideoRepository) RecordDownload(download *models.VideoDownload) error {
 	query := `
 		INSERT INTO video_downloads
-		(user_id, video_id, video_url, video_title, quality, compressed, file_size_bytes, executed_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		(user_id, video_id, video_url, video_title, quality, compressed, file_size_bytes, part_number, part_count, playlist_id, clip, executed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
+	partNumber, partCount := download.PartNumber, download.PartCount
+	if partCount == 0 {
+		partNumber, partCount = 1, 1
+	}
+
 	_, err := r.db.Exec(query,
 		download.UserID,
 		download.VideoID,
@@ -33,6 +38,10 @@ func (r *VideoRepository) RecordDownload(download *models.VideoDownload) error {
 		download.Quality,
 		download.Compressed,
 		download.FileSizeBytes,
+		partNumber,
+		partCount,
+		sql.NullString{String: download.PlaylistID, Valid: download.PlaylistID != ""},
+		sql.NullString{String: download.Clip, Valid: download.Clip != ""},
 		download.ExecutedAt,
 	)
 
@@ -43,10 +52,10 @@ func (r *VideoRepository) RecordDownload(download *models.VideoDownload) error {
 	return nil
 }
 
-// GetUserDownloadCount returns total downloads for a user
+// GetUserDownloadCount returns total downloads for a user, parts of one video count once
 func (r *VideoRepository) GetUserDownloadCount(userID int64) (int64, error) {
 	var count int64
-	query := `SELECT COUNT(*) FROM video_downloads WHERE user_id = ?`
+	query := `SELECT COUNT(*) FROM video_downloads WHERE user_id = ? AND part_number = 1`
 	err := r.db.QueryRow(query, userID).Scan(&count)
 	return count, err
 }
@@ -54,7 +63,7 @@ func (r *VideoRepository) GetUserDownloadCount(userID int64) (int64, error) {
 // GetTotalDownloads returns total downloads by all users
 func (r *VideoRepository) GetTotalDownloads() (int64, error) {
 	var count int64
-	err := r.db.QueryRow("SELECT COUNT(*) FROM video_downloads").Scan(&count)
+	err := r.db.QueryRow("SELECT COUNT(*) FROM video_downloads WHERE part_number = 1").Scan(&count)
 	return count, err
 }
 
@@ -70,6 +79,7 @@ func (r *VideoRepository) GetPopularVideos(limit int) ([]PopularVideo, error) {
 	query := `
 		SELECT video_id, video_title, COUNT(*) as download_count
 		FROM video_downloads
+		WHERE part_number = 1
 		GROUP BY video_id
 		ORDER BY download_count DESC
 		LIMIT ?
@@ -149,3 +149,80 @@ func TestVideoRepository_GetPopularVideos(t *testing.T) {
 		t.Errorf("Expected 3 downloads, got %d", popular[0].DownloadCount)
 	}
 }
+
+func TestVideoRepository_RecordDownload_Parts(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	userRepo := repository.NewUserRepository(db)
+	videoRepo := repository.NewVideoRepository(db)
+
+	user, _ := userRepo.UpsertFromTelegram(&tgbotapi.User{ID: 12345, FirstName: "Test"})
+
+	// Video split into 3 parts is recorded once per part
+	for part := 1; part <= 3; part++ {
+		err := videoRepo.RecordDownload(&models.VideoDownload{
+			UserID:     user.ID,
+			VideoID:    "long",
+			VideoURL:   "https://youtube.com/watch?v=long",
+			Quality:    "1080p",
+			PartNumber: part,
+			PartCount:  3,
+			ExecutedAt: time.Now(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to record part %d: %v", part, err)
+		}
+	}
+
+	var rows int
+	db.QueryRow("SELECT COUNT(*) FROM video_downloads WHERE part_count = 3").Scan(&rows)
+	if rows != 3 {
+		t.Errorf("Expected 3 part rows, got %d", rows)
+	}
+
+	// Parts of the same video count as a single download
+	count, err := videoRepo.GetUserDownloadCount(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get count: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected count 1, got %d", count)
+	}
+
+	popular, _ := videoRepo.GetPopularVideos(1)
+	if len(popular) != 1 || popular[0].DownloadCount != 1 {
+		t.Errorf("Expected split video to count once in popular videos, got %+v", popular)
+	}
+}
+
+func TestVideoRepository_RecordDownload_Clip(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	userRepo := repository.NewUserRepository(db)
+	videoRepo := repository.NewVideoRepository(db)
+
+	user, _ := userRepo.UpsertFromTelegram(&tgbotapi.User{ID: 12345, FirstName: "Test"})
+
+	for _, clip := range []string{"83-130", ""} {
+		err := videoRepo.RecordDownload(&models.VideoDownload{
+			UserID:     user.ID,
+			VideoID:    "dQw4w9WgXcQ",
+			VideoURL:   "https://youtube.com/watch?v=dQw4w9WgXcQ",
+			Quality:    "720p",
+			Clip:       clip,
+			ExecutedAt: time.Now(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to record download: %v", err)
+		}
+	}
+
+	var clips, whole int
+	db.QueryRow(`SELECT COUNT(*) FROM video_downloads WHERE clip = '83-130'`).Scan(&clips)
+	db.QueryRow(`SELECT COUNT(*) FROM video_downloads WHERE clip IS NULL`).Scan(&whole)
+	if clips != 1 || whole != 1 {
+		t.Errorf("Expected one clip and one whole video, got %d and %d", clips, whole)
+	}
+}
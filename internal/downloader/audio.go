@@ -0,0 +1,163 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// AudioFormat is a target container for audio-only downloads
+type AudioFormat string
+
+const (
+	AudioMP3 AudioFormat = "mp3"
+	AudioM4A AudioFormat = "m4a"
+)
+
+type AudioInfo struct {
+	FilePath  string
+	Title     string
+	Performer string
+	Duration  int
+
+	dir *jobDir
+}
+
+// Cleanup removes the audio file and returns its disk space to the budget
+func (a *AudioInfo) Cleanup() {
+	removeFiles([]string{a.FilePath})
+	a.dir.release()
+}
+
+// bestAudioFormat returns a pseudo video format describing the audio-only option
+func bestAudioFormat(formats []ytdlpFormat) (VideoFormat, bool) {
+	found := false
+	var best int64
+	for _, f := range formats {
+		if f.ACodec == "none" || f.ACodec == "" {
+			continue
+		}
+		if f.VCodec != "none" && f.VCodec != "" {
+			continue
+		}
+
+		found = true
+		filesize := f.Filesize
+		if filesize == 0 {
+			filesize = f.FilesizeApprox
+		}
+		if filesize > best {
+			best = filesize
+		}
+	}
+
+	if !found {
+		return VideoFormat{}, false
+	}
+
+	description := "🎵 Аудио"
+	if sizeMB := best / (1024 * 1024); sizeMB > 0 {
+		description += fmt.Sprintf(" (~%dMB)", sizeMB)
+	}
+
+	return VideoFormat{
+		Quality:     QualityAudio,
+		Size:        best,
+		Description: description,
+	}, true
+}
+
+// DownloadAudio extracts the best audio track, converts it to the configured
+// format and embeds title, artist and cover art
+func (d *YouTubeDownloader) DownloadAudio(ctx context.Context, videoID string, opts *DownloadOptions) (*AudioInfo, error) {
+	url, err := d.videoURL(videoID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Конвертация и встраивание обложки делаются через ffmpeg
+	if !d.hasFFmpeg() {
+		return nil, ErrAudioUnsupported
+	}
+
+	dir, err := d.acquireDir(ctx, d.maxSize, opts)
+	if err != nil {
+		return nil, err
+	}
+	delivered := false
+	defer func() {
+		if !delivered {
+			dir.release()
+		}
+	}()
+	base := filepath.Join(dir.path, fmt.Sprintf("yt-%s%s-audio", fileKey(videoID), clipSuffix(opts.clip())))
+	outputPath := base + "." + string(d.audioFormat)
+
+	args := []string{
+		"--no-playlist",
+		"-f", "bestaudio/best",
+		"-x",
+		"--audio-format", string(d.audioFormat),
+		"--audio-quality", "0",
+		"--embed-metadata",
+		"--embed-thumbnail",
+		"--convert-thumbnails", "jpg",
+		"-o", base + ".%(ext)s",
+	}
+	args = append(args, d.ffmpegLocationArgs()...)
+	if clip := opts.clip(); clip != nil {
+		args = append(args, "--download-sections", clip.sectionArg(), "--force-keyframes-at-cuts")
+	}
+	args = append(args, progressArgs()...)
+	args = append(args, "--print-json", url)
+
+	// Промежуточные файлы (исходная дорожка, обложка, .part) удаляются вместе с каталогом
+	output, err := d.runYtdlp(ctx, args, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Метаданные не критичны: без них отправим файл без названия и исполнителя
+	var info ytdlpVideoInfo
+	json.Unmarshal(output, &info)
+
+	fileInfo, err := os.Stat(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("download failed: audio file not found")
+	}
+
+	if fileInfo.Size() > d.maxSize {
+		return nil, &TooLargeError{Size: fileInfo.Size(), Limit: d.maxSize}
+	}
+
+	delivered = true
+	return &AudioInfo{
+		FilePath:  outputPath,
+		Title:     audioTitle(info),
+		Performer: audioPerformer(info),
+		Duration:  int(clipDuration(opts.clip(), info.Duration)),
+		dir:       dir,
+	}, nil
+}
+
+// audioTitle prefers the track name from music metadata over the video title
+func audioTitle(info ytdlpVideoInfo) string {
+	if info.Track != "" {
+		return info.Track
+	}
+	return info.Title
+}
+
+// audioPerformer prefers the artist from music metadata over the channel name
+func audioPerformer(info ytdlpVideoInfo) string {
+	switch {
+	case info.Artist != "":
+		return info.Artist
+	case info.Uploader != "":
+		return info.Uploader
+	default:
+		return info.Channel
+	}
+}
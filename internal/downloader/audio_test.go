@@ -0,0 +1,82 @@
+package downloader
+
+import "testing"
+
+func TestBestAudioFormat(t *testing.T) {
+	formats := []ytdlpFormat{
+		{FormatID: "18", Ext: "mp4", Height: 360, VCodec: "avc1", ACodec: "mp4a", Filesize: 10 * 1024 * 1024},
+		{FormatID: "139", Ext: "m4a", VCodec: "none", ACodec: "mp4a.40.5", Filesize: 2 * 1024 * 1024},
+		{FormatID: "251", Ext: "webm", VCodec: "none", ACodec: "opus", FilesizeApprox: 5 * 1024 * 1024},
+		{FormatID: "137", Ext: "mp4", Height: 1080, VCodec: "avc1", ACodec: "none", Filesize: 90 * 1024 * 1024},
+	}
+
+	audio, ok := bestAudioFormat(formats)
+	if !ok {
+		t.Fatal("expected audio format to be found")
+	}
+	if audio.Quality != QualityAudio {
+		t.Errorf("expected quality %q, got %q", QualityAudio, audio.Quality)
+	}
+	if audio.Size != 5*1024*1024 {
+		t.Errorf("expected size of the best audio track, got %d", audio.Size)
+	}
+	if audio.Description != "🎵 Аудио (~5MB)" {
+		t.Errorf("unexpected description %q", audio.Description)
+	}
+
+	// Только форматы с видео - аудио-варианта нет
+	if _, ok := bestAudioFormat(formats[:1]); ok {
+		t.Error("expected no audio option without audio-only formats")
+	}
+}
+
+func TestAudioMetadata(t *testing.T) {
+	tests := []struct {
+		name          string
+		info          ytdlpVideoInfo
+		wantTitle     string
+		wantPerformer string
+	}{
+		{
+			name:          "music metadata wins",
+			info:          ytdlpVideoInfo{Title: "Artist - Song (Official Video)", Track: "Song", Artist: "Artist", Uploader: "ArtistVEVO"},
+			wantTitle:     "Song",
+			wantPerformer: "Artist",
+		},
+		{
+			name:          "falls back to video title and uploader",
+			info:          ytdlpVideoInfo{Title: "Podcast #42", Uploader: "Podcaster", Channel: "Podcast Channel"},
+			wantTitle:     "Podcast #42",
+			wantPerformer: "Podcaster",
+		},
+		{
+			name:          "falls back to channel",
+			info:          ytdlpVideoInfo{Title: "Talk", Channel: "Conference"},
+			wantTitle:     "Talk",
+			wantPerformer: "Conference",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := audioTitle(tt.info); got != tt.wantTitle {
+				t.Errorf("audioTitle() = %q, want %q", got, tt.wantTitle)
+			}
+			if got := audioPerformer(tt.info); got != tt.wantPerformer {
+				t.Errorf("audioPerformer() = %q, want %q", got, tt.wantPerformer)
+			}
+		})
+	}
+}
+
+func TestConfigFromEnv_AudioFormat(t *testing.T) {
+	t.Setenv("AUDIO_FORMAT", "m4a")
+	if cfg := ConfigFromEnv(); cfg.AudioFormat != AudioM4A {
+		t.Errorf("expected m4a, got %q", cfg.AudioFormat)
+	}
+
+	t.Setenv("AUDIO_FORMAT", "flac")
+	if cfg := ConfigFromEnv(); cfg.AudioFormat != AudioMP3 {
+		t.Errorf("expected fallback to mp3 for unsupported format, got %q", cfg.AudioFormat)
+	}
+}
@@ -0,0 +1,120 @@
+package downloader
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Clip is a fragment of a video to download instead of the whole video
+type Clip struct {
+	Start time.Duration
+	// End - конец фрагмента, 0 означает до конца видео
+	End time.Duration
+}
+
+// String returns the clip as "<start>-<end>" in seconds, the end is omitted
+// for clips up to the end of the video. ParseClip reads it back.
+func (c Clip) String() string {
+	s := strconv.Itoa(int(c.Start.Seconds())) + "-"
+	if c.End > 0 {
+		s += strconv.Itoa(int(c.End.Seconds()))
+	}
+	return s
+}
+
+// ParseClip parses a clip formatted by Clip.String
+func ParseClip(s string) (Clip, bool) {
+	rawStart, rawEnd, ok := strings.Cut(s, "-")
+	if !ok {
+		return Clip{}, false
+	}
+	start, err := strconv.Atoi(rawStart)
+	if err != nil || start < 0 {
+		return Clip{}, false
+	}
+	c := Clip{Start: time.Duration(start) * time.Second}
+	if rawEnd != "" {
+		end, err := strconv.Atoi(rawEnd)
+		if err != nil || end <= start {
+			return Clip{}, false
+		}
+		c.End = time.Duration(end) * time.Second
+	}
+	return c, true
+}
+
+// sectionArg returns the value of yt-dlp --download-sections
+func (c Clip) sectionArg() string {
+	end := "inf"
+	if c.End > 0 {
+		end = strconv.Itoa(int(c.End.Seconds()))
+	}
+	return fmt.Sprintf("*%d-%s", int(c.Start.Seconds()), end)
+}
+
+// clipDuration returns the duration of the clip of a video of the given
+// duration, the whole duration if there is no clip
+func clipDuration(c *Clip, duration float64) float64 {
+	if c == nil {
+		return duration
+	}
+	end := c.End.Seconds()
+	if end == 0 || (duration > 0 && end > duration) {
+		end = duration
+	}
+	return max(end-c.Start.Seconds(), 0)
+}
+
+// clipArgs returns yt-dlp arguments that download only the clip. Cutting is
+// done by ffmpeg, cuts are re-encoded to start exactly at the requested time.
+func (d *YouTubeDownloader) clipArgs(c *Clip) []string {
+	if c == nil {
+		return nil
+	}
+	return []string{"--download-sections", c.sectionArg(), "--force-keyframes-at-cuts"}
+}
+
+// clipSuffix distinguishes file names of clips from the whole video
+func clipSuffix(c *Clip) string {
+	if c == nil {
+		return ""
+	}
+	return "-clip-" + strings.TrimSuffix(c.String(), "-")
+}
+
+// timestampPattern matches "1:23", "01:02:03" and YouTube's "1h2m3s", "83s", "83"
+var timestampPattern = regexp.MustCompile(`^(?:(?:(\d+):)?(\d{1,2}):(\d{2})|(?:(\d+)h)?(?:(\d+)m)?(?:(\d+)s?)?)$`)
+
+// ParseTimestamp parses a position in a video as written by people or in the
+// t= parameter of YouTube links
+func ParseTimestamp(s string) (time.Duration, bool) {
+	m := timestampPattern.FindStringSubmatch(s)
+	if m == nil || s == "" {
+		return 0, false
+	}
+
+	num := func(s string) time.Duration {
+		n, _ := strconv.Atoi(s)
+		return time.Duration(n)
+	}
+	if m[3] != "" {
+		if num(m[3]) >= 60 || (m[1] != "" && num(m[2]) >= 60) {
+			return 0, false
+		}
+		return num(m[1])*time.Hour + num(m[2])*time.Minute + num(m[3])*time.Second, true
+	}
+	return num(m[4])*time.Hour + num(m[5])*time.Minute + num(m[6])*time.Second, true
+}
+
+// FormatTimestamp formats a position in a video as "1:23" or "1:02:03"
+func FormatTimestamp(d time.Duration) string {
+	total := int(d.Seconds())
+	h, m, s := total/3600, total/60%60, total%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
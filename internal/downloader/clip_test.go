@@ -0,0 +1,123 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/artur/solid-spoon/internal/downloader/ytdlptest"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		input string
+		want  time.Duration
+		ok    bool
+	}{
+		{"1:23", 83 * time.Second, true},
+		{"01:02:03", time.Hour + 2*time.Minute + 3*time.Second, true},
+		{"0:05", 5 * time.Second, true},
+		{"83", 83 * time.Second, true},
+		{"83s", 83 * time.Second, true},
+		{"1m23s", 83 * time.Second, true},
+		{"1h2m3s", time.Hour + 2*time.Minute + 3*time.Second, true},
+		{"1:75", 0, false},
+		{"1:60:00", 0, false},
+		{"", 0, false},
+		{"abc", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParseTimestamp(tt.input)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseTimestamp(%q) = %v, %v, want %v, %v", tt.input, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestFormatTimestamp(t *testing.T) {
+	if got := FormatTimestamp(83 * time.Second); got != "1:23" {
+		t.Errorf("Expected 1:23, got %q", got)
+	}
+	if got := FormatTimestamp(time.Hour + 2*time.Minute + 3*time.Second); got != "1:02:03" {
+		t.Errorf("Expected 1:02:03, got %q", got)
+	}
+}
+
+func TestClipString(t *testing.T) {
+	clips := []Clip{
+		{Start: 83 * time.Second, End: 130 * time.Second},
+		{Start: 83 * time.Second},
+		{End: 10 * time.Second},
+	}
+	for _, c := range clips {
+		parsed, ok := ParseClip(c.String())
+		if !ok || parsed != c {
+			t.Errorf("ParseClip(%q) = %+v, %v, want %+v", c.String(), parsed, ok, c)
+		}
+	}
+
+	for _, s := range []string{"", "83", "130-83", "a-b", "-5-10"} {
+		if _, ok := ParseClip(s); ok {
+			t.Errorf("Expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestClipDuration(t *testing.T) {
+	if got := clipDuration(nil, 212); got != 212 {
+		t.Errorf("Expected whole duration without clip, got %v", got)
+	}
+	if got := clipDuration(&Clip{Start: 83 * time.Second, End: 130 * time.Second}, 212); got != 47 {
+		t.Errorf("Expected 47s clip, got %v", got)
+	}
+	if got := clipDuration(&Clip{Start: 200 * time.Second}, 212); got != 12 {
+		t.Errorf("Expected clip up to the end to be 12s, got %v", got)
+	}
+	if got := clipDuration(&Clip{Start: 200 * time.Second, End: 300 * time.Second}, 212); got != 12 {
+		t.Errorf("Expected clip end to be capped by duration, got %v", got)
+	}
+}
+
+func TestDownloadWithQualityInfo_Clip(t *testing.T) {
+	ffmpeg, err := filepath.Abs(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, fake, tmp := newFakeDownloader(t, ytdlptest.Scenario{Info: fixtureVideo, FileSize: 1024}, Config{FfmpegPath: ffmpeg})
+
+	clip := &Clip{Start: 83 * time.Second, End: 130 * time.Second}
+	info, err := d.DownloadWithQualityInfo(context.Background(), "dQw4w9WgXcQ", QualityHigh, &DownloadOptions{Clip: clip})
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	defer info.Cleanup()
+
+	assertJobFile(t, tmp, info.FilePath, "yt-dQw4w9WgXcQ-clip-83-130.mp4")
+	if info.Duration != 47 {
+		t.Errorf("Expected clip duration 47s, got %d", info.Duration)
+	}
+
+	args := fake.LastCall(t)
+	if got := ytdlptest.Arg(args, "--download-sections"); got != "*83-130" {
+		t.Errorf("Expected section *83-130, got %q", got)
+	}
+	if got := ytdlptest.Arg(args, "--ffmpeg-location"); got != ffmpeg {
+		t.Errorf("Expected ffmpeg location %q, got %q", ffmpeg, got)
+	}
+}
+
+func TestDownloadWithQualityInfo_ClipRequiresFFmpeg(t *testing.T) {
+	d, fake, _ := newFakeDownloader(t, ytdlptest.Scenario{Info: fixtureVideo, FileSize: 1024}, Config{})
+
+	_, err := d.DownloadWithQualityInfo(context.Background(), "dQw4w9WgXcQ", QualityHigh, &DownloadOptions{Clip: &Clip{Start: time.Second}})
+	if !errors.Is(err, ErrClipUnsupported) {
+		t.Errorf("Expected ErrClipUnsupported, got %v", err)
+	}
+	if calls := fake.Calls(t); len(calls) != 0 {
+		t.Errorf("yt-dlp must not run without ffmpeg, got %v", calls)
+	}
+}
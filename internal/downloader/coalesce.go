@@ -0,0 +1,259 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// flightGroup lets concurrent identical downloads share one yt-dlp run. The
+// download keeps going while at least one caller waits for it, every caller
+// gets the same files and they are removed by the last Cleanup.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight is a download in progress shared by its callers
+type flight struct {
+	done   chan struct{}
+	cancel context.CancelFunc
+	// waiters - сколько вызывающих ждут результата, при нуле загрузка прерывается
+	waiters   int
+	listeners map[int]*progressListener
+	nextID    int
+	finished  bool
+	// last - последний прогресс, его сразу получает присоединившийся
+	last *Progress
+
+	info   *VideoInfo
+	err    error
+	shared *sharedFiles
+}
+
+// sharedFiles counts callers holding files of a shared download
+type sharedFiles struct {
+	refs atomic.Int32
+}
+
+// release drops one reference and reports whether it was the last one
+func (s *sharedFiles) release() bool {
+	return s.refs.Add(-1) == 0
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{flights: make(map[string]*flight)}
+}
+
+// flightKey identifies downloads producing the same files
+func flightKey(videoID string, quality Quality, opts *DownloadOptions) string {
+	key := fmt.Sprintf("%s|%s", videoID, quality)
+	if clip := opts.clip(); clip != nil {
+		key += "|clip=" + clip.String()
+	}
+	if subs := opts.subtitles(); subs != nil {
+		key += "|subs=" + subs.String()
+	}
+	if opts.thumbnail() {
+		key += "|thumbnail"
+	}
+	return key
+}
+
+// do runs download or joins the identical one already running. Progress of
+// the shared download is reported to every caller's OnProgress.
+func (g *flightGroup) do(ctx context.Context, key string, opts *DownloadOptions, download func(context.Context, *DownloadOptions) (*VideoInfo, error)) (*VideoInfo, error) {
+	g.mu.Lock()
+	f, ok := g.flights[key]
+	// Загрузку, которую все бросили, уже прерывают - к ней не присоединяемся
+	if ok && f.waiters > 0 {
+		log.Printf("[DOWNLOADER] Joining download %s already in progress", key)
+	} else {
+		f = g.start(ctx, key, opts, download)
+	}
+	f.waiters++
+	listenerID := f.nextID
+	f.nextID++
+	var listener *progressListener
+	if opts != nil && opts.OnProgress != nil {
+		listener = newProgressListener(opts.OnProgress)
+		f.listeners[listenerID] = listener
+		if f.last != nil {
+			listener.send(*f.last)
+		}
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		// Прогресс этому вызывающему доходит до возврата, как у обычной загрузки
+		listener.close(true)
+		if f.err != nil {
+			return nil, f.err
+		}
+		info := *f.info
+		info.shared = f.shared
+		return &info, nil
+
+	case <-ctx.Done():
+		g.mu.Lock()
+		delete(f.listeners, listenerID)
+		g.mu.Unlock()
+		listener.close(false)
+
+		g.mu.Lock()
+		if f.finished {
+			g.mu.Unlock()
+			// Результат уже готов, но этому вызывающему он не нужен
+			if f.err == nil {
+				info := *f.info
+				info.shared = f.shared
+				info.Cleanup()
+			}
+			return nil, ctx.Err()
+		}
+		f.waiters--
+		last := f.waiters == 0
+		g.mu.Unlock()
+		if last {
+			// Как и у обычной загрузки, после возврата недокачанных файлов уже нет
+			log.Printf("[DOWNLOADER] All callers of download %s left, stopping it", key)
+			f.cancel()
+			<-f.done
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// start launches a shared download, must be called with g.mu held
+func (g *flightGroup) start(ctx context.Context, key string, opts *DownloadOptions, download func(context.Context, *DownloadOptions) (*VideoInfo, error)) *flight {
+	// Загрузка не должна прерываться, когда уходит начавший её вызывающий
+	flightCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	f := &flight{
+		done:      make(chan struct{}),
+		cancel:    cancel,
+		listeners: make(map[int]*progressListener),
+		shared:    &sharedFiles{},
+	}
+	g.flights[key] = f
+
+	flightOpts := &DownloadOptions{OnProgress: func(p Progress) { g.report(f, p) }}
+	if opts != nil {
+		flightOpts.Clip = opts.Clip
+		flightOpts.Subtitles = opts.Subtitles
+		flightOpts.Thumbnail = opts.Thumbnail
+	}
+
+	go func() {
+		defer cancel()
+		info, err := download(flightCtx, flightOpts)
+
+		g.mu.Lock()
+		if g.flights[key] == f {
+			delete(g.flights, key)
+		}
+		f.finished = true
+		f.info, f.err = info, err
+		if err == nil {
+			f.shared.refs.Store(int32(f.waiters))
+		}
+		waiters := f.waiters
+		g.mu.Unlock()
+
+		// Все ушли, пока загрузка заканчивалась - файлы никому не нужны
+		if err == nil && waiters == 0 {
+			info.Cleanup()
+		}
+		close(f.done)
+	}()
+	return f
+}
+
+// report passes progress of a shared download to all its callers. It never
+// waits for them: it runs on the path reading the yt-dlp output.
+func (g *flightGroup) report(f *flight, p Progress) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	f.last = &p
+	for _, l := range f.listeners {
+		l.send(p)
+	}
+}
+
+// progressListener calls one caller's OnProgress from a goroutine of its own.
+// Progress arriving while the caller is busy replaces the pending one, so a
+// slow caller sees fewer updates instead of holding up the others.
+type progressListener struct {
+	fn ProgressFunc
+
+	mu      sync.Mutex
+	pending *Progress
+	closed  bool
+	wake    chan struct{}
+	done    chan struct{}
+}
+
+func newProgressListener(fn ProgressFunc) *progressListener {
+	l := &progressListener{
+		fn:   fn,
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// send queues progress for the caller without waiting for it
+func (l *progressListener) send(p Progress) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return
+	}
+	l.pending = &p
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// close stops the listener and waits for its goroutine. With flush the
+// pending progress is delivered first, otherwise it is dropped.
+func (l *progressListener) close(flush bool) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return
+	}
+	l.closed = true
+	if !flush {
+		l.pending = nil
+	}
+	close(l.wake)
+	l.mu.Unlock()
+
+	<-l.done
+}
+
+func (l *progressListener) run() {
+	defer close(l.done)
+
+	for range l.wake {
+		l.mu.Lock()
+		p := l.pending
+		l.pending = nil
+		l.mu.Unlock()
+
+		if p != nil {
+			l.fn(*p)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/artur/solid-spoon/internal/downloader/ytdlptest"
+)
+
+func TestFlightKey(t *testing.T) {
+	clip := &Clip{Start: 83 * time.Second, End: 130 * time.Second}
+	keys := map[string]string{
+		"plain":     flightKey("dQw4w9WgXcQ", QualityHigh, nil),
+		"quality":   flightKey("dQw4w9WgXcQ", QualityLow, nil),
+		"clip":      flightKey("dQw4w9WgXcQ", QualityHigh, &DownloadOptions{Clip: clip}),
+		"subtitles": flightKey("dQw4w9WgXcQ", QualityHigh, &DownloadOptions{Subtitles: &Subtitles{Lang: "en", Mode: SubtitlesFile}}),
+		"thumbnail": flightKey("dQw4w9WgXcQ", QualityHigh, &DownloadOptions{Thumbnail: true}),
+	}
+	seen := make(map[string]string)
+	for name, key := range keys {
+		if other, ok := seen[key]; ok {
+			t.Errorf("Downloads %q and %q must not share key %q", name, other, key)
+		}
+		seen[key] = name
+	}
+
+	// Прогресс у каждого свой, на файлы он не влияет
+	withProgress := flightKey("dQw4w9WgXcQ", QualityHigh, &DownloadOptions{OnProgress: func(Progress) {}})
+	if withProgress != keys["plain"] {
+		t.Errorf("Expected progress callback not to change the key, got %q", withProgress)
+	}
+}
+
+// waitForWaiters waits until n callers wait for the download with key
+func waitForWaiters(t *testing.T, g *flightGroup, key string, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		g.mu.Lock()
+		f, ok := g.flights[key]
+		joined := ok && f.waiters == n
+		g.mu.Unlock()
+		if joined {
+			return
+		}
+	}
+	t.Fatalf("Expected %d callers to wait for download %s", n, key)
+}
+
+func TestDownloadWithQualityInfo_SharesIdenticalDownloads(t *testing.T) {
+	d, fake, tmp := newFakeDownloader(t, ytdlptest.Scenario{Info: fixtureVideo, FileSize: 1024, Hold: true}, Config{})
+	key := flightKey("dQw4w9WgXcQ", QualityHigh, nil)
+
+	const callers = 3
+	infos := make([]*VideoInfo, callers)
+	var progress [callers]int
+	var wg sync.WaitGroup
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			opts := &DownloadOptions{OnProgress: func(Progress) { progress[i]++ }}
+			info, err := d.DownloadWithQualityInfo(context.Background(), "dQw4w9WgXcQ", QualityHigh, opts)
+			if err != nil {
+				t.Errorf("Download %d failed: %v", i, err)
+			}
+			infos[i] = info
+		}()
+		// Загрузка держится, пока к ней не присоединятся все
+		waitForWaiters(t, d.flights, key, i+1)
+	}
+	fake.Release(t)
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+
+	if calls := fake.Calls(t); len(calls) != 1 {
+		t.Fatalf("Expected one yt-dlp run for identical downloads, got %d", len(calls))
+	}
+	for i, info := range infos {
+		if info.FilePath != infos[0].FilePath {
+			t.Errorf("Expected caller %d to get the shared file, got %q", i, info.FilePath)
+		}
+		if progress[i] == 0 {
+			t.Errorf("Expected caller %d to see progress", i)
+		}
+	}
+
+	// Файл живёт, пока его не освободит последний получатель
+	for _, info := range infos[:callers-1] {
+		info.Cleanup()
+		if _, err := os.Stat(infos[0].FilePath); err != nil {
+			t.Fatalf("Shared file removed before the last caller finished: %v", err)
+		}
+	}
+	infos[callers-1].Cleanup()
+	assertEmptyDir(t, tmp)
+}
+
+func TestDownloadWithQualityInfo_SharedDownloadSurvivesCancel(t *testing.T) {
+	d, fake, tmp := newFakeDownloader(t, ytdlptest.Scenario{Info: fixtureVideo, FileSize: 1024, Hold: true}, Config{})
+	key := flightKey("dQw4w9WgXcQ", QualityHigh, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error)
+	go func() {
+		_, err := d.DownloadWithQualityInfo(ctx, "dQw4w9WgXcQ", QualityHigh, nil)
+		firstErr <- err
+	}()
+	waitForWaiters(t, d.flights, key, 1)
+
+	secondInfo := make(chan *VideoInfo)
+	go func() {
+		info, err := d.DownloadWithQualityInfo(context.Background(), "dQw4w9WgXcQ", QualityHigh, nil)
+		if err != nil {
+			t.Errorf("Second download failed: %v", err)
+		}
+		secondInfo <- info
+	}()
+	waitForWaiters(t, d.flights, key, 2)
+
+	// Начавший загрузку передумал - второй всё равно получает файл
+	cancel()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the cancelled caller to get context.Canceled, got %v", err)
+	}
+	fake.Release(t)
+	info := <-secondInfo
+	if info == nil {
+		t.FailNow()
+	}
+	if _, err := os.Stat(info.FilePath); err != nil {
+		t.Errorf("Expected the remaining caller to get the file: %v", err)
+	}
+	if calls := fake.Calls(t); len(calls) != 1 {
+		t.Errorf("Expected one yt-dlp run, got %d", len(calls))
+	}
+
+	info.Cleanup()
+	assertEmptyDir(t, tmp)
+}
+
+func TestFlightGroup_SlowListenerDoesNotBlock(t *testing.T) {
+	g := newFlightGroup()
+	start := make(chan struct{})
+	reported := make(chan struct{})
+	download := func(ctx context.Context, opts *DownloadOptions) (*VideoInfo, error) {
+		<-start
+		for _, percent := range []float64{10, 50, 100} {
+			opts.OnProgress(Progress{Stage: StageDownload, Percent: percent})
+		}
+		close(reported)
+		return &VideoInfo{}, nil
+	}
+
+	release := make(chan struct{})
+	slowDone := make(chan struct{})
+	go func() {
+		defer close(slowDone)
+		opts := &DownloadOptions{OnProgress: func(Progress) { <-release }}
+		if _, err := g.do(context.Background(), "key", opts, download); err != nil {
+			t.Errorf("Slow caller failed: %v", err)
+		}
+	}()
+	waitForWaiters(t, g, "key", 1)
+
+	var mu sync.Mutex
+	var last float64
+	fastDone := make(chan struct{})
+	go func() {
+		defer close(fastDone)
+		opts := &DownloadOptions{OnProgress: func(p Progress) {
+			mu.Lock()
+			last = p.Percent
+			mu.Unlock()
+		}}
+		if _, err := g.do(context.Background(), "key", opts, download); err != nil {
+			t.Errorf("Fast caller failed: %v", err)
+		}
+	}()
+	waitForWaiters(t, g, "key", 2)
+	close(start)
+
+	// Зависший получатель прогресса не держит ни загрузку, ни остальных
+	for name, done := range map[string]chan struct{}{"download": reported, "fast caller": fastDone} {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("The slow listener blocked the %s", name)
+		}
+	}
+	mu.Lock()
+	if last != 100 {
+		t.Errorf("Expected the fast caller to see the final progress, got %v", last)
+	}
+	mu.Unlock()
+
+	close(release)
+	<-slowDone
+}
@@ -0,0 +1,149 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// containerOverhead - доля бюджета, которую оставляем под заголовки контейнера
+	containerOverhead = 0.95
+	// minVideoBitrate - ниже этого битрейта (кбит/с) видео становится бесполезным
+	minVideoBitrate = 100
+	// maxCompressAttempts - сколько раз пробуем пережать, если не попали в бюджет
+	maxCompressAttempts = 2
+)
+
+// compressionBitrates calculates video and audio bitrates (kbit/s) so that
+// a video of the given duration fits into maxSize bytes
+func compressionBitrates(maxSize int64, duration float64) (videoKbps, audioKbps int, err error) {
+	if duration <= 0 {
+		return 0, 0, fmt.Errorf("unknown video duration")
+	}
+
+	totalKbps := int(float64(maxSize) * 8 * containerOverhead / duration / 1000)
+
+	audioKbps = 128
+	if totalKbps < 512 {
+		audioKbps = 64
+	}
+
+	videoKbps = totalKbps - audioKbps
+	if videoKbps < minVideoBitrate {
+		return 0, 0, fmt.Errorf("video is too long to fit into %d MB", maxSize/(1024*1024))
+	}
+
+	return videoKbps, audioKbps, nil
+}
+
+// hasFFmpeg reports whether ffmpeg is configured and available
+func (d *YouTubeDownloader) hasFFmpeg() bool {
+	if d.ffmpegPath == "" {
+		return false
+	}
+	_, err := exec.LookPath(d.ffmpegPath)
+	return err == nil
+}
+
+// ffmpegLocationArgs tells yt-dlp where ffmpeg is if it is configured by path
+// rather than by a name from PATH
+func (d *YouTubeDownloader) ffmpegLocationArgs() []string {
+	if filepath.Base(d.ffmpegPath) != d.ffmpegPath {
+		return []string{"--ffmpeg-location", d.ffmpegPath}
+	}
+	return nil
+}
+
+// compress re-encodes the file at path in place so that it fits into maxSize
+func (d *YouTubeDownloader) compress(ctx context.Context, path string, duration float64, maxSize int64) error {
+	videoKbps, audioKbps, err := compressionBitrates(maxSize, duration)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := siblingPath(path, "-compressed")
+	defer os.Remove(tmpPath)
+
+	for attempt := 1; attempt <= maxCompressAttempts; attempt++ {
+		log.Printf("[DOWNLOADER] Compressing %s: video %dk, audio %dk (attempt %d)",
+			path, videoKbps, audioKbps, attempt)
+
+		if err := d.transcode(ctx, path, tmpPath, videoKbps, audioKbps); err != nil {
+			return err
+		}
+
+		fileInfo, err := os.Stat(tmpPath)
+		if err != nil {
+			return fmt.Errorf("failed to stat compressed file: %w", err)
+		}
+
+		if fileInfo.Size() <= maxSize {
+			log.Printf("[DOWNLOADER] Compressed to %.1f MB", float64(fileInfo.Size())/(1024*1024))
+			return os.Rename(tmpPath, path)
+		}
+
+		// Не попали в бюджет - уменьшаем битрейт пропорционально перебору
+		ratio := float64(maxSize) / float64(fileInfo.Size())
+		videoKbps = int(float64(videoKbps) * ratio * containerOverhead)
+		if videoKbps < minVideoBitrate {
+			break
+		}
+	}
+
+	return fmt.Errorf("compressed file still exceeds %d MB", maxSize/(1024*1024))
+}
+
+func (d *YouTubeDownloader) transcode(ctx context.Context, inputPath, outputPath string, videoKbps, audioKbps int) error {
+	args := []string{
+		"-y",
+		"-i", inputPath,
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-b:v", fmt.Sprintf("%dk", videoKbps),
+		"-maxrate", fmt.Sprintf("%dk", videoKbps),
+		"-bufsize", fmt.Sprintf("%dk", videoKbps*2),
+		"-c:a", "aac",
+		"-b:a", fmt.Sprintf("%dk", audioKbps),
+	}
+	args = append(args, faststartArgs(outputPath)...)
+	args = append(args, outputPath)
+
+	cmd := d.command(ctx, d.ffmpegPath, args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("ffmpeg error: %w: %s", err, lastLines(string(output), 5))
+	}
+	return nil
+}
+
+// siblingPath returns a path for an intermediate file next to path with the
+// same extension, ffmpeg picks the container by it
+func siblingPath(path, suffix string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + suffix + ext
+}
+
+// faststartArgs moves the MP4 index to the start of the file, so Telegram
+// plays the video before it is fully loaded. Other containers have no such option.
+func faststartArgs(path string) []string {
+	if filepath.Ext(path) != "."+containerMP4 {
+		return nil
+	}
+	return []string{"-movflags", "+faststart"}
+}
+
+// lastLines returns the last n lines of s, ffmpeg puts the actual error at the end
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
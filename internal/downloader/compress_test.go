@@ -0,0 +1,67 @@
+package downloader
+
+import "testing"
+
+func TestCompressionBitrates(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxSize   int64
+		duration  float64
+		wantVideo int
+		wantAudio int
+		wantErr   bool
+	}{
+		{"short video into 50MB", 50 * 1024 * 1024, 60, 6512, 128, false},
+		{"long video into 50MB", 50 * 1024 * 1024, 3600, 52, 64, true},
+		{"hour into 2GB", 2000 * 1024 * 1024, 3600, 4299, 128, false},
+		{"medium video gets low audio", 50 * 1024 * 1024, 1000, 334, 64, false},
+		{"unknown duration", 50 * 1024 * 1024, 0, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			video, audio, err := compressionBitrates(tt.maxSize, tt.duration)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got video=%d audio=%d", video, audio)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if video != tt.wantVideo || audio != tt.wantAudio {
+				t.Errorf("compressionBitrates() = (%d, %d), want (%d, %d)",
+					video, audio, tt.wantVideo, tt.wantAudio)
+			}
+
+			// Итоговый размер должен укладываться в бюджет
+			estimated := int64(float64(video+audio) * 1000 / 8 * tt.duration)
+			if estimated > tt.maxSize {
+				t.Errorf("estimated size %d exceeds budget %d", estimated, tt.maxSize)
+			}
+		})
+	}
+}
+
+func TestHasFFmpeg(t *testing.T) {
+	d := NewYouTubeDownloaderWithConfig(Config{FfmpegPath: ""})
+	if d.hasFFmpeg() {
+		t.Error("expected compression to be disabled without ffmpeg path")
+	}
+
+	d = NewYouTubeDownloaderWithConfig(Config{FfmpegPath: "/nonexistent/ffmpeg"})
+	if d.hasFFmpeg() {
+		t.Error("expected compression to be disabled for missing binary")
+	}
+}
+
+func TestLastLines(t *testing.T) {
+	output := "line1\nline2\nline3\nline4\n"
+	if got := lastLines(output, 2); got != "line3\nline4" {
+		t.Errorf("lastLines() = %q, want %q", got, "line3\nline4")
+	}
+	if got := lastLines("single", 5); got != "single" {
+		t.Errorf("lastLines() = %q, want %q", got, "single")
+	}
+}
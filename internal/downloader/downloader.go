@@ -1,9 +1,15 @@
 package downloader
 
-// Downloader interface for downloading videos from various sources
+import "context"
+
+// Downloader interface for downloading videos from various sources.
+// videoID is a source-qualified ID as returned by Link.VideoID.
+// Cancelling ctx stops external processes and removes partially downloaded files.
 type Downloader interface {
-	Download(videoID string) (filePath string, err error)
-	DownloadWithQuality(videoID string, quality Quality) (filePath string, err error)
-	DownloadWithQualityInfo(videoID string, quality Quality) (*VideoInfo, error)
-	GetAvailableFormats(videoID string) ([]VideoFormat, error)
+	// Download returns ErrSplit if the video had to be split into parts
+	Download(ctx context.Context, videoID string) (filePath string, cleanup func(), err error)
+	// DownloadWithQualityInfo and DownloadAudio report progress through opts.OnProgress, opts may be nil
+	DownloadWithQualityInfo(ctx context.Context, videoID string, quality Quality, opts *DownloadOptions) (*VideoInfo, error)
+	DownloadAudio(ctx context.Context, videoID string, opts *DownloadOptions) (*AudioInfo, error)
+	GetAvailableFormats(ctx context.Context, videoID string) ([]VideoFormat, error)
 }
@@ -0,0 +1,110 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Reasons a video cannot be downloaded. yt-dlp failures are classified into
+// one of them by stderr, callers check with errors.Is.
+var (
+	ErrUnavailable     = errors.New("video unavailable")
+	ErrPrivate         = errors.New("video is private")
+	ErrAgeRestricted   = errors.New("video is age-restricted")
+	ErrGeoBlocked      = errors.New("video is not available in this country")
+	ErrLiveNotFinished = errors.New("live stream has not finished")
+	ErrMembersOnly     = errors.New("video is for channel members only")
+	ErrCopyright       = errors.New("video is blocked on copyright grounds")
+	ErrRateLimited     = errors.New("rate limited by YouTube")
+	ErrTooLarge        = errors.New("file is too large")
+	ErrNoFormats       = errors.New("no suitable formats found")
+	ErrEmptyPlaylist   = errors.New("playlist has no videos")
+	// ErrAudioUnsupported - без ffmpeg аудио не извлечь
+	ErrAudioUnsupported = errors.New("audio extraction requires ffmpeg")
+	// ErrClipUnsupported - фрагменты вырезает ffmpeg
+	ErrClipUnsupported = errors.New("clipping requires ffmpeg")
+	// ErrSubtitlesUnsupported - вшивать субтитры без ffmpeg нечем
+	ErrSubtitlesUnsupported = errors.New("burning subtitles requires ffmpeg")
+	ErrNoSubtitles          = errors.New("subtitles in this language are not available")
+	// ErrSplit - видео разрезано на части, а вызывающий ждёт один файл
+	ErrSplit = errors.New("video was split into parts")
+)
+
+// stderrPatterns maps yt-dlp messages to reasons. Order matters: YouTube
+// prefixes many specific reasons with "Video unavailable", so the generic
+// pattern goes last.
+var stderrPatterns = []struct {
+	kind     error
+	patterns []string
+}{
+	{ErrPrivate, []string{"private video", "video is private"}},
+	{ErrMembersOnly, []string{"members-only", "members only", "join this channel to get access"}},
+	{ErrAgeRestricted, []string{"confirm your age", "age-restricted", "age restricted", "inappropriate for some users"}},
+	{ErrGeoBlocked, []string{"not available in your country", "not made this video available in your country", "geo restriction", "geo-restricted"}},
+	{ErrCopyright, []string{"copyright"}},
+	{ErrLiveNotFinished, []string{"live event will begin", "premieres in", "live stream recording is not available", "is currently live", "this live event"}},
+	{ErrRateLimited, []string{"http error 429", "too many requests", "not a bot", "rate-limited", "rate limited"}},
+	{ErrUnavailable, []string{"video unavailable", "video is unavailable", "no longer available", "has been removed", "does not exist", "has been terminated", "incomplete youtube id"}},
+}
+
+// Error is a failed yt-dlp run. Kind is one of the Err* reasons or nil if
+// the failure was not recognized; Stderr is meant for logs, not for users.
+type Error struct {
+	Kind   error
+	Stderr string
+}
+
+func (e *Error) Error() string {
+	return "yt-dlp error: " + e.Stderr
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// ytdlpError classifies yt-dlp stderr
+func ytdlpError(stderr string) *Error {
+	return &Error{Kind: classifyStderr(stderr), Stderr: strings.TrimSpace(stderr)}
+}
+
+func classifyStderr(stderr string) error {
+	lower := strings.ToLower(stderr)
+	for _, p := range stderrPatterns {
+		for _, pattern := range p.patterns {
+			if strings.Contains(lower, pattern) {
+				return p.kind
+			}
+		}
+	}
+	return nil
+}
+
+// TooLargeError reports a file that does not fit into the size budget and
+// could not be compressed or split
+type TooLargeError struct {
+	Size  int64
+	Limit int64
+	// Err - почему не удалось сжать или разрезать, nil если ffmpeg недоступен
+	Err error
+}
+
+func (e *TooLargeError) Error() string {
+	msg := fmt.Sprintf("file is too large (%.1f MB, limit %.0f MB)", megabytes(e.Size), megabytes(e.Limit))
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *TooLargeError) Is(target error) bool {
+	return target == ErrTooLarge
+}
+
+func (e *TooLargeError) Unwrap() error {
+	return e.Err
+}
+
+func megabytes(n int64) float64 {
+	return float64(n) / (1024 * 1024)
+}
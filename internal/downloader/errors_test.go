@@ -0,0 +1,56 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestClassifyStderr(t *testing.T) {
+	tests := []struct {
+		stderr string
+		want   error
+	}{
+		{"ERROR: [youtube] abc: Video unavailable", ErrUnavailable},
+		{"ERROR: [youtube] abc: Video unavailable. This video has been removed by the uploader", ErrUnavailable},
+		{"ERROR: [youtube] abc: Private video. Sign in if you've been granted access to this video", ErrPrivate},
+		{"ERROR: [youtube] abc: Sign in to confirm your age. This video may be inappropriate for some users.", ErrAgeRestricted},
+		{"ERROR: [youtube] abc: Video unavailable. The uploader has not made this video available in your country", ErrGeoBlocked},
+		{"ERROR: [youtube] abc: This live event will begin in 3 hours.", ErrLiveNotFinished},
+		{"ERROR: [youtube] abc: Premieres in 2 days", ErrLiveNotFinished},
+		{"ERROR: [youtube] abc: Join this channel to get access to members-only content like this video", ErrMembersOnly},
+		{"ERROR: [youtube] abc: Video unavailable. This video is no longer available due to a copyright claim by Label", ErrCopyright},
+		{"ERROR: unable to download video data: HTTP Error 429: Too Many Requests", ErrRateLimited},
+		{"ERROR: [youtube] abc: Sign in to confirm you’re not a bot", ErrRateLimited},
+		{"ERROR: unable to download video data: HTTP Error 403: Forbidden", nil},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.stderr, func(t *testing.T) {
+			if got := classifyStderr(tt.stderr); got != tt.want {
+				t.Errorf("classifyStderr() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestError_Wrapping(t *testing.T) {
+	err := fmt.Errorf("download: %w", ytdlpError("ERROR: Private video\n"))
+
+	if !errors.Is(err, ErrPrivate) {
+		t.Error("Expected error to match ErrPrivate")
+	}
+	var ytErr *Error
+	if !errors.As(err, &ytErr) || ytErr.Stderr != "ERROR: Private video" {
+		t.Errorf("Expected stderr to be kept for logs, got %+v", ytErr)
+	}
+
+	tooLarge := &TooLargeError{Size: 3 << 20, Limit: 1 << 20, Err: errors.New("ffmpeg error")}
+	if !errors.Is(tooLarge, ErrTooLarge) {
+		t.Error("Expected TooLargeError to match ErrTooLarge")
+	}
+	if tooLarge.Error() != "file is too large (3.0 MB, limit 1 MB): ffmpeg error" {
+		t.Errorf("Unexpected message: %q", tooLarge.Error())
+	}
+}
@@ -0,0 +1,180 @@
+package downloader
+
+import (
+	"os"
+	"strings"
+)
+
+// Containers merged downloads are written to
+const (
+	containerMP4 = "mp4"
+	// containerMKV - для кодеков, которые не кладутся в MP4 (VP9, Opus)
+	containerMKV = "mkv"
+)
+
+// formatChoice is what is downloaded for one height: a format with audio or
+// a video-only format merged with a separate audio track
+type formatChoice struct {
+	video ytdlpFormat
+	// audio - дорожка для склейки, nil если звук уже в video
+	audio *ytdlpFormat
+	size  int64
+}
+
+// formatID returns the yt-dlp format selector of the choice, e.g. 137+140
+func (c formatChoice) formatID() string {
+	if c.audio == nil {
+		return c.video.FormatID
+	}
+	return c.video.FormatID + "+" + c.audio.FormatID
+}
+
+// container returns the extension the downloaded file gets
+func (c formatChoice) container() string {
+	if c.audio == nil {
+		return c.video.Ext
+	}
+	if mp4Video(c.video.VCodec) && mp4Audio(c.audio.ACodec) {
+		return containerMP4
+	}
+	return containerMKV
+}
+
+// codecRank orders video codecs by how well Telegram clients play them:
+// H.264 everywhere, VP9 and AV1 not on older devices
+func codecRank(vcodec string) int {
+	switch {
+	case strings.HasPrefix(vcodec, "avc1"), strings.HasPrefix(vcodec, "h264"):
+		return 0
+	case strings.HasPrefix(vcodec, "vp09"), strings.HasPrefix(vcodec, "vp9"):
+		return 1
+	case strings.HasPrefix(vcodec, "av01"):
+		return 2
+	default:
+		return 3
+	}
+}
+
+// mp4Video reports whether the video codec can be stored in MP4 as is
+func mp4Video(vcodec string) bool {
+	return strings.HasPrefix(vcodec, "avc1") || strings.HasPrefix(vcodec, "h264") || strings.HasPrefix(vcodec, "av01")
+}
+
+// mp4Audio reports whether the audio codec can be stored in MP4 as is
+func mp4Audio(acodec string) bool {
+	return strings.HasPrefix(acodec, "mp4a") || acodec == "aac"
+}
+
+func hasVideo(f ytdlpFormat) bool {
+	return f.VCodec != "none" && f.VCodec != ""
+}
+
+func hasAudio(f ytdlpFormat) bool {
+	return f.ACodec != "none" && f.ACodec != ""
+}
+
+// formatSize returns the exact size of the format or yt-dlp's estimate
+func formatSize(f ytdlpFormat) int64 {
+	if f.Filesize > 0 {
+		return f.Filesize
+	}
+	return f.FilesizeApprox
+}
+
+// mergeAudio picks the audio track for video-only formats: AAC goes into MP4
+// without conversion, among tracks of one codec the larger one is better
+func mergeAudio(formats []ytdlpFormat) *ytdlpFormat {
+	var best *ytdlpFormat
+	for i, f := range formats {
+		if !hasAudio(f) || hasVideo(f) || f.FormatID == "" {
+			continue
+		}
+		if best == nil {
+			best = &formats[i]
+			continue
+		}
+		if aac, bestAAC := mp4Audio(f.ACodec), mp4Audio(best.ACodec); aac != bestAAC {
+			if aac {
+				best = &formats[i]
+			}
+			continue
+		}
+		if formatSize(f) > formatSize(*best) {
+			best = &formats[i]
+		}
+	}
+	return best
+}
+
+// betterChoice reports whether a is preferred over b: first the codec, then
+// the higher frame rate and bitrate, then a format with audio over merging.
+// The smaller file only breaks ties.
+func betterChoice(a, b formatChoice) bool {
+	if ra, rb := codecRank(a.video.VCodec), codecRank(b.video.VCodec); ra != rb {
+		return ra < rb
+	}
+	if a.video.FPS != b.video.FPS {
+		return a.video.FPS > b.video.FPS
+	}
+	if a.video.TBR != b.video.TBR {
+		return a.video.TBR > b.video.TBR
+	}
+	if (a.audio == nil) != (b.audio == nil) {
+		return a.audio == nil
+	}
+	return a.size > 0 && (b.size == 0 || a.size < b.size)
+}
+
+// chooseFormats picks what to download for every available height. Without
+// ffmpeg only MP4 formats with audio are offered, yt-dlp cannot merge tracks.
+func (d *YouTubeDownloader) chooseFormats(formats []ytdlpFormat) map[int]formatChoice {
+	// И склейка, и сжатие делаются через ffmpeg
+	withFFmpeg := d.hasFFmpeg()
+	var audio *ytdlpFormat
+	if withFFmpeg {
+		audio = mergeAudio(formats)
+	}
+
+	choices := make(map[int]formatChoice)
+	for _, f := range formats {
+		if !hasVideo(f) || f.Height == 0 || f.FormatID == "" {
+			continue
+		}
+
+		c := formatChoice{video: f, size: formatSize(f)}
+		switch {
+		case hasAudio(f):
+			// Готовые форматы со звуком берём только в MP4
+			if f.Ext != containerMP4 {
+				continue
+			}
+		case audio != nil:
+			c.audio = audio
+			if c.size > 0 {
+				c.size += formatSize(*audio)
+			}
+		default:
+			continue
+		}
+
+		// Пропускаем файлы больше лимита, если их нельзя сжать
+		if c.size > d.maxSize && !withFFmpeg {
+			continue
+		}
+
+		if existing, ok := choices[f.Height]; !ok || betterChoice(c, existing) {
+			choices[f.Height] = c
+		}
+	}
+	return choices
+}
+
+// findVideo returns the file yt-dlp downloaded to base.%(ext)s, empty if there is none
+func findVideo(base string) string {
+	for _, ext := range []string{containerMP4, containerMKV, "webm"} {
+		if _, err := os.Stat(base + "." + ext); err == nil {
+			return base + "." + ext
+		}
+	}
+	return ""
+}
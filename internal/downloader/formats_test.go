@@ -0,0 +1,229 @@
+package downloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/artur/solid-spoon/internal/downloader/ytdlptest"
+)
+
+// testFFmpeg returns the test binary, which acts as ffmpeg for the fake
+func testFFmpeg(t *testing.T) string {
+	t.Helper()
+	ffmpeg, err := filepath.Abs(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ffmpeg
+}
+
+func TestChooseFormats(t *testing.T) {
+	aac := ytdlpFormat{FormatID: "140", Ext: "m4a", VCodec: "none", ACodec: "mp4a.40.2", Filesize: 3 << 20}
+	opus := ytdlpFormat{FormatID: "251", Ext: "webm", VCodec: "none", ACodec: "opus", Filesize: 4 << 20}
+
+	tests := []struct {
+		name      string
+		formats   []ytdlpFormat
+		ffmpeg    bool
+		height    int
+		id        string
+		container string
+	}{
+		{
+			name: "progressive preferred to merging",
+			formats: []ytdlpFormat{aac,
+				{FormatID: "18", Ext: "mp4", Height: 360, VCodec: "avc1.42001E", ACodec: "mp4a.40.2", Filesize: 10 << 20},
+				{FormatID: "134", Ext: "mp4", Height: 360, VCodec: "avc1.4d401e", ACodec: "none", Filesize: 5 << 20},
+			},
+			ffmpeg: true, height: 360, id: "18", container: "mp4",
+		},
+		{
+			name: "h264 over smaller vp9 and av1",
+			formats: []ytdlpFormat{aac,
+				{FormatID: "399", Ext: "mp4", Height: 1080, VCodec: "av01.0.08M.08", ACodec: "none", Filesize: 40 << 20},
+				{FormatID: "248", Ext: "webm", Height: 1080, VCodec: "vp9", ACodec: "none", Filesize: 50 << 20},
+				{FormatID: "137", Ext: "mp4", Height: 1080, VCodec: "avc1.640028", ACodec: "none", Filesize: 80 << 20},
+			},
+			ffmpeg: true, height: 1080, id: "137+140", container: "mp4",
+		},
+		{
+			name: "vp9 over av1 goes to mkv",
+			formats: []ytdlpFormat{aac,
+				{FormatID: "401", Ext: "mp4", Height: 2160, VCodec: "av01.0.12M.08", ACodec: "none", Filesize: 200 << 20},
+				{FormatID: "313", Ext: "webm", Height: 2160, VCodec: "vp09.00.51.08", ACodec: "none", Filesize: 300 << 20},
+			},
+			ffmpeg: true, height: 2160, id: "313+140", container: "mkv",
+		},
+		{
+			name:    "av1 with aac stays mp4",
+			formats: []ytdlpFormat{aac, opus, {FormatID: "398", Ext: "mp4", Height: 720, VCodec: "av01.0.05M.08", ACodec: "none"}},
+			ffmpeg:  true, height: 720, id: "398+140", container: "mp4",
+		},
+		{
+			name:    "opus only goes to mkv",
+			formats: []ytdlpFormat{opus, {FormatID: "136", Ext: "mp4", Height: 720, VCodec: "avc1.4d401f", ACodec: "none"}},
+			ffmpeg:  true, height: 720, id: "136+251", container: "mkv",
+		},
+		{
+			name: "60fps over smaller 30fps",
+			formats: []ytdlpFormat{aac,
+				{FormatID: "136", Ext: "mp4", Height: 720, FPS: 30, TBR: 1500, VCodec: "avc1.4d401f", ACodec: "none", Filesize: 20 << 20},
+				{FormatID: "298", Ext: "mp4", Height: 720, FPS: 60, TBR: 2500, VCodec: "avc1.4d4020", ACodec: "none", Filesize: 35 << 20},
+			},
+			ffmpeg: true, height: 720, id: "298+140", container: "mp4",
+		},
+		{
+			name: "higher bitrate over smaller file",
+			formats: []ytdlpFormat{aac,
+				{FormatID: "137", Ext: "mp4", Height: 1080, FPS: 30, TBR: 2500, VCodec: "avc1.640028", ACodec: "none", Filesize: 50 << 20},
+				{FormatID: "137-drc", Ext: "mp4", Height: 1080, FPS: 30, TBR: 4000, VCodec: "avc1.640028", ACodec: "none", Filesize: 80 << 20},
+			},
+			ffmpeg: true, height: 1080, id: "137-drc+140", container: "mp4",
+		},
+		{
+			name: "smaller file breaks ties",
+			formats: []ytdlpFormat{aac,
+				{FormatID: "136", Ext: "mp4", Height: 720, FPS: 30, VCodec: "avc1.4d401f", ACodec: "none", Filesize: 30 << 20},
+				{FormatID: "136-1", Ext: "mp4", Height: 720, FPS: 30, VCodec: "avc1.4d401f", ACodec: "none", Filesize: 20 << 20},
+			},
+			ffmpeg: true, height: 720, id: "136-1+140", container: "mp4",
+		},
+		{
+			name:    "no merging without ffmpeg",
+			formats: []ytdlpFormat{aac, {FormatID: "137", Ext: "mp4", Height: 1080, VCodec: "avc1.640028", ACodec: "none"}},
+			height:  1080,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{}
+			if tt.ffmpeg {
+				cfg.FfmpegPath = testFFmpeg(t)
+			}
+			d := NewYouTubeDownloaderWithConfig(cfg)
+
+			c, ok := d.chooseFormats(tt.formats)[tt.height]
+			if tt.id == "" {
+				if ok {
+					t.Errorf("Expected no format for %dp, got %s", tt.height, c.formatID())
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("Expected a format for %dp", tt.height)
+			}
+			if c.formatID() != tt.id || c.container() != tt.container {
+				t.Errorf("Got %s in %s, want %s in %s", c.formatID(), c.container(), tt.id, tt.container)
+			}
+		})
+	}
+}
+
+func TestGetAvailableFormats_Merged(t *testing.T) {
+	d, _, _ := newFakeDownloader(t, ytdlptest.Scenario{Info: fixtureVideo}, Config{FfmpegPath: testFFmpeg(t)})
+
+	formats, err := d.GetAvailableFormats(context.Background(), "dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatalf("GetAvailableFormats failed: %v", err)
+	}
+
+	var got []string
+	for _, f := range formats {
+		got = append(got, f.Description)
+	}
+	// 1080p без звука склеивается с аудиодорожкой, размер - сумма обоих
+	want := []string{"360p (~10MB)", "720p (~40MB)", "1080p (~83MB)", "🎵 Аудио (~3MB)"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Formats = %v, want %v", got, want)
+	}
+}
+
+func TestDownloadWithQualityInfo_Merged(t *testing.T) {
+	ffmpeg := testFFmpeg(t)
+
+	t.Run("cached format", func(t *testing.T) {
+		d, fake, tmp := newFakeDownloader(t, ytdlptest.Scenario{Info: fixtureVideo, FileSize: 1024}, Config{FfmpegPath: ffmpeg, MetadataTTL: time.Minute})
+		if _, err := d.GetAvailableFormats(context.Background(), "dQw4w9WgXcQ"); err != nil {
+			t.Fatalf("GetAvailableFormats failed: %v", err)
+		}
+
+		info, err := d.DownloadWithQualityInfo(context.Background(), "dQw4w9WgXcQ", QualityFull, nil)
+		if err != nil {
+			t.Fatalf("Download failed: %v", err)
+		}
+		defer info.Cleanup()
+
+		assertJobFile(t, tmp, info.FilePath, "yt-dQw4w9WgXcQ.mp4")
+		args := fake.LastCall(t)
+		if format := ytdlptest.Arg(args, "-f"); !strings.HasPrefix(format, "137+140/bv[height<=1080][vcodec^=avc1]+ba[acodec^=mp4a]/") {
+			t.Errorf("Expected the cached H.264 format merged with audio, got %q", format)
+		}
+		if got := ytdlptest.Arg(args, "--merge-output-format"); got != "mp4" {
+			t.Errorf("Expected merging into mp4, got %q", got)
+		}
+		if got := ytdlptest.Arg(args, "--ffmpeg-location"); got != ffmpeg {
+			t.Errorf("Expected ffmpeg location %q for merging, got %q", ffmpeg, got)
+		}
+	})
+
+	t.Run("container chosen by yt-dlp", func(t *testing.T) {
+		d, fake, _ := newFakeDownloader(t, ytdlptest.Scenario{Info: fixtureVideo, FileSize: 1024}, Config{FfmpegPath: ffmpeg})
+
+		info, err := d.DownloadWithQualityInfo(context.Background(), "dQw4w9WgXcQ", QualityFull, nil)
+		if err != nil {
+			t.Fatalf("Download failed: %v", err)
+		}
+		defer info.Cleanup()
+
+		args := fake.LastCall(t)
+		if format := ytdlptest.Arg(args, "-f"); !strings.HasPrefix(format, "bv[height<=1080][vcodec^=avc1]+ba[acodec^=mp4a]/") {
+			t.Errorf("Expected H.264 to be preferred, got %q", format)
+		}
+		if got := ytdlptest.Arg(args, "--merge-output-format"); got != "mp4/mkv" {
+			t.Errorf("Expected mp4 with mkv fallback, got %q", got)
+		}
+	})
+}
+
+func TestDownloadWithQualityInfo_MKV(t *testing.T) {
+	// VP9 без H.264 и только Opus - склеивается в MKV
+	fixture := filepath.Join(t.TempDir(), "vp9.json")
+	os.WriteFile(fixture, []byte(`{"id": "dQw4w9WgXcQ", "title": "Test Video", "duration": 212, "formats": [
+		{"format_id": "251", "ext": "webm", "vcodec": "none", "acodec": "opus", "filesize": 3407872},
+		{"format_id": "303", "ext": "webm", "width": 1920, "height": 1080, "vcodec": "vp9", "acodec": "none", "filesize": 73400320}
+	]}`), 0644)
+
+	d, fake, tmp := newFakeDownloader(t, ytdlptest.Scenario{Info: fixture, FileSize: 1024}, Config{FfmpegPath: testFFmpeg(t), MetadataTTL: time.Minute})
+	if _, err := d.GetAvailableFormats(context.Background(), "dQw4w9WgXcQ"); err != nil {
+		t.Fatalf("GetAvailableFormats failed: %v", err)
+	}
+
+	info, err := d.DownloadWithQualityInfo(context.Background(), "dQw4w9WgXcQ", QualityFull, &DownloadOptions{Thumbnail: true})
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	defer info.Cleanup()
+
+	assertJobFile(t, tmp, info.FilePath, "yt-dQw4w9WgXcQ.mkv")
+	assertJobFile(t, tmp, info.Thumbnail, "yt-dQw4w9WgXcQ.jpg")
+	if got := ytdlptest.Arg(fake.Calls(t)[1], "--merge-output-format"); got != "mkv" {
+		t.Errorf("Expected merging into mkv, got %q", got)
+	}
+}
+
+func TestFaststartArgs(t *testing.T) {
+	if args := faststartArgs("/tmp/yt-video.mp4"); len(args) != 2 {
+		t.Errorf("Expected faststart for mp4, got %v", args)
+	}
+	if args := faststartArgs("/tmp/yt-video.mkv"); args != nil {
+		t.Errorf("Expected no mp4 options for mkv, got %v", args)
+	}
+	if got := siblingPath("/tmp/yt-video.mkv", "-subs"); got != "/tmp/yt-video-subs.mkv" {
+		t.Errorf("Expected the intermediate file to keep the container, got %q", got)
+	}
+}
@@ -0,0 +1,136 @@
+package downloader
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// metadataCacheSize - сколько видео держим в памяти, лишние вытесняются
+const metadataCacheSize = 500
+
+// MetadataStore persists video metadata so the cache survives restarts
+type MetadataStore interface {
+	// Get returns stored metadata and when it was fetched, nil data if there is none
+	Get(videoID string) (data []byte, fetchedAt time.Time, err error)
+	Save(videoID string, data []byte, fetchedAt time.Time) error
+}
+
+// metadataCache keeps parsed yt-dlp metadata of recently seen videos for ttl,
+// so the quality keyboard and the download do not run yt-dlp -j again. A nil
+// cache caches nothing.
+type metadataCache struct {
+	ttl   time.Duration
+	store MetadataStore
+	now   func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]metadataEntry
+}
+
+type metadataEntry struct {
+	info    *ytdlpVideoInfo
+	expires time.Time
+}
+
+// newMetadataCache returns nil when ttl disables caching, store may be nil
+func newMetadataCache(ttl time.Duration, store MetadataStore) *metadataCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &metadataCache{
+		ttl:     ttl,
+		store:   store,
+		now:     time.Now,
+		entries: make(map[string]metadataEntry),
+	}
+}
+
+// get returns fresh metadata of the video, nil on a miss. The result is shared
+// between callers and must not be modified.
+func (c *metadataCache) get(videoID string) *ytdlpVideoInfo {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[videoID]
+	if ok && c.now().After(entry.expires) {
+		delete(c.entries, videoID)
+		ok = false
+	}
+	c.mu.Unlock()
+	if ok {
+		return entry.info
+	}
+
+	if c.store == nil {
+		return nil
+	}
+	data, fetchedAt, err := c.store.Get(videoID)
+	if err != nil {
+		log.Printf("[DOWNLOADER] Failed to load cached metadata of %s: %v", videoID, err)
+		return nil
+	}
+	if data == nil || c.now().Sub(fetchedAt) > c.ttl {
+		return nil
+	}
+	var info ytdlpVideoInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		log.Printf("[DOWNLOADER] Failed to parse cached metadata of %s: %v", videoID, err)
+		return nil
+	}
+
+	c.mu.Lock()
+	c.add(videoID, metadataEntry{info: &info, expires: fetchedAt.Add(c.ttl)})
+	c.mu.Unlock()
+	return &info
+}
+
+// put caches freshly fetched metadata in memory and in the store
+func (c *metadataCache) put(videoID string, info *ytdlpVideoInfo) {
+	if c == nil {
+		return
+	}
+
+	now := c.now()
+	c.mu.Lock()
+	c.add(videoID, metadataEntry{info: info, expires: now.Add(c.ttl)})
+	c.mu.Unlock()
+
+	if c.store == nil {
+		return
+	}
+	// Сохраняем только разобранные поля: сырой вывод yt-dlp в разы больше
+	data, err := json.Marshal(info)
+	if err != nil {
+		log.Printf("[DOWNLOADER] Failed to encode metadata of %s: %v", videoID, err)
+		return
+	}
+	if err := c.store.Save(videoID, data, now); err != nil {
+		log.Printf("[DOWNLOADER] Failed to save metadata of %s: %v", videoID, err)
+	}
+}
+
+// add stores an entry evicting expired ones and then the oldest when the cache
+// is full, must be called with c.mu held
+func (c *metadataCache) add(videoID string, entry metadataEntry) {
+	if _, ok := c.entries[videoID]; !ok && len(c.entries) >= metadataCacheSize {
+		now := c.now()
+		oldest := ""
+		for id, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, id)
+				continue
+			}
+			if oldest == "" || e.expires.Before(c.entries[oldest].expires) {
+				oldest = id
+			}
+		}
+		if len(c.entries) >= metadataCacheSize {
+			delete(c.entries, oldest)
+		}
+	}
+	c.entries[videoID] = entry
+}
@@ -0,0 +1,145 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/artur/solid-spoon/internal/downloader/ytdlptest"
+)
+
+// memoryStore is a MetadataStore standing in for the database
+type memoryStore struct {
+	data      map[string][]byte
+	fetchedAt map[string]time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{data: make(map[string][]byte), fetchedAt: make(map[string]time.Time)}
+}
+
+func (s *memoryStore) Get(videoID string) ([]byte, time.Time, error) {
+	return s.data[videoID], s.fetchedAt[videoID], nil
+}
+
+func (s *memoryStore) Save(videoID string, data []byte, fetchedAt time.Time) error {
+	s.data[videoID] = data
+	s.fetchedAt[videoID] = fetchedAt
+	return nil
+}
+
+func TestGetAvailableFormats_CachesMetadata(t *testing.T) {
+	d, fake, _ := newFakeDownloader(t, ytdlptest.Scenario{Info: fixtureVideo}, Config{MetadataTTL: time.Minute})
+
+	first, err := d.GetAvailableFormats(context.Background(), "dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatalf("GetAvailableFormats failed: %v", err)
+	}
+	second, err := d.GetAvailableFormats(context.Background(), "dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatalf("GetAvailableFormats failed: %v", err)
+	}
+	if len(first) != len(second) {
+		t.Errorf("Expected the same formats from the cache, got %d and %d", len(first), len(second))
+	}
+	// Субтитры берутся из тех же метаданных
+	if _, err := d.GetSubtitles(context.Background(), "dQw4w9WgXcQ"); err != nil {
+		t.Fatalf("GetSubtitles failed: %v", err)
+	}
+	if calls := fake.Calls(t); len(calls) != 1 {
+		t.Fatalf("Expected one yt-dlp -j run, got %d", len(calls))
+	}
+
+	// После TTL метаданные запрашиваются заново
+	d.metadata.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if _, err := d.GetAvailableFormats(context.Background(), "dQw4w9WgXcQ"); err != nil {
+		t.Fatalf("GetAvailableFormats failed: %v", err)
+	}
+	if calls := fake.Calls(t); len(calls) != 2 {
+		t.Errorf("Expected expired metadata to be fetched again, got %d runs", len(calls))
+	}
+}
+
+func TestGetAvailableFormats_MetadataStore(t *testing.T) {
+	store := newMemoryStore()
+	d, fake, _ := newFakeDownloader(t, ytdlptest.Scenario{Info: fixtureVideo}, Config{MetadataTTL: time.Minute, MetadataStore: store})
+
+	want, err := d.GetAvailableFormats(context.Background(), "dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatalf("GetAvailableFormats failed: %v", err)
+	}
+	if store.data["dQw4w9WgXcQ"] == nil {
+		t.Fatal("Expected metadata to be saved to the store")
+	}
+
+	// Новый загрузчик, как после перезапуска, берёт метаданные из хранилища
+	restarted := NewYouTubeDownloaderWithConfig(Config{YtdlpPath: fake.Path, MetadataTTL: time.Minute, MetadataStore: store})
+	got, err := restarted.GetAvailableFormats(context.Background(), "dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatalf("GetAvailableFormats failed: %v", err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected stored formats %v, got %v", want, got)
+	}
+	if calls := fake.Calls(t); len(calls) != 1 {
+		t.Fatalf("Expected stored metadata to be used, got %d yt-dlp runs", len(calls))
+	}
+
+	// Устаревшие записи хранилища не используются
+	store.fetchedAt["dQw4w9WgXcQ"] = time.Now().Add(-time.Hour)
+	restarted = NewYouTubeDownloaderWithConfig(Config{YtdlpPath: fake.Path, MetadataTTL: time.Minute, MetadataStore: store})
+	if _, err := restarted.GetAvailableFormats(context.Background(), "dQw4w9WgXcQ"); err != nil {
+		t.Fatalf("GetAvailableFormats failed: %v", err)
+	}
+	if calls := fake.Calls(t); len(calls) != 2 {
+		t.Errorf("Expected expired stored metadata to be fetched again, got %d runs", len(calls))
+	}
+}
+
+func TestDownloadWithQualityInfo_CachedFormatID(t *testing.T) {
+	d, fake, _ := newFakeDownloader(t, ytdlptest.Scenario{Info: fixtureVideo, FileSize: 1024}, Config{MetadataTTL: time.Minute})
+
+	if _, err := d.GetAvailableFormats(context.Background(), "dQw4w9WgXcQ"); err != nil {
+		t.Fatalf("GetAvailableFormats failed: %v", err)
+	}
+
+	tests := []struct {
+		quality Quality
+		prefix  string
+	}{
+		{QualityLow, "18/best[height<=360]"},
+		{QualityHigh, "22/best[height<=720]"},
+		// Для 1080p нет формата со звуком - остаются только фильтры
+		{QualityFull, "best[height<=1080]"},
+	}
+	for _, tt := range tests {
+		info, err := d.DownloadWithQualityInfo(context.Background(), "dQw4w9WgXcQ", tt.quality, nil)
+		if err != nil {
+			t.Fatalf("Download of %s failed: %v", tt.quality, err)
+		}
+		info.Cleanup()
+
+		if format := ytdlptest.Arg(fake.LastCall(t), "-f"); !strings.HasPrefix(format, tt.prefix) {
+			t.Errorf("Expected %s to be downloaded with %q..., got %q", tt.quality, tt.prefix, format)
+		}
+	}
+}
+
+func TestMetadataCache_Evicts(t *testing.T) {
+	c := newMetadataCache(time.Minute, nil)
+	for i := range metadataCacheSize + 1 {
+		c.put(fmt.Sprintf("video%d", i), &ytdlpVideoInfo{})
+	}
+	if len(c.entries) != metadataCacheSize {
+		t.Errorf("Expected the cache to stay at %d videos, got %d", metadataCacheSize, len(c.entries))
+	}
+	if c.get(fmt.Sprintf("video%d", metadataCacheSize)) == nil {
+		t.Error("Expected the newest video to stay cached")
+	}
+
+	if newMetadataCache(0, nil).get("video0") != nil {
+		t.Error("Expected a disabled cache to miss")
+	}
+}
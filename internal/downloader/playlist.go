@@ -0,0 +1,78 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// PlaylistEntry is a video of a playlist or a channel
+type PlaylistEntry struct {
+	// VideoID - ID видео в том же виде, что возвращает Link.VideoID
+	VideoID  string
+	Title    string
+	Duration int
+}
+
+// Playlist is a list of videos: a playlist or channel uploads
+type Playlist struct {
+	Title   string
+	Entries []PlaylistEntry
+}
+
+// PlaylistFetcher lists videos of a playlist or a channel without
+// downloading them. Downloaders that support playlists implement it.
+type PlaylistFetcher interface {
+	GetPlaylist(ctx context.Context, playlistID string) (*Playlist, error)
+}
+
+// ytdlpPlaylist represents the JSON output of yt-dlp --flat-playlist -J
+type ytdlpPlaylist struct {
+	Title   string `json:"title"`
+	Entries []struct {
+		ID       string  `json:"id"`
+		Title    string  `json:"title"`
+		Duration float64 `json:"duration"`
+		IEKey    string  `json:"ie_key"`
+	} `json:"entries"`
+}
+
+// GetPlaylist lists the videos of a playlist or channel ID from the registry
+func (d *YouTubeDownloader) GetPlaylist(ctx context.Context, playlistID string) (*Playlist, error) {
+	url, err := d.videoURL(playlistID)
+	if err != nil {
+		return nil, err
+	}
+
+	// --flat-playlist не заходит в каждое видео: список из сотен видео приходит за секунды
+	output, err := d.lookup(ctx, "--flat-playlist", "-J", url)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw ytdlpPlaylist
+	if err := json.Unmarshal(output, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse yt-dlp output: %w", err)
+	}
+
+	playlist := &Playlist{Title: raw.Title}
+	for _, e := range raw.Entries {
+		// Пропускаем вложенные плейлисты и вкладки канала - только видео YouTube
+		if e.IEKey != "" && e.IEKey != "Youtube" {
+			continue
+		}
+		if len(e.ID) != 11 {
+			continue
+		}
+		playlist.Entries = append(playlist.Entries, PlaylistEntry{
+			VideoID:  e.ID,
+			Title:    e.Title,
+			Duration: int(e.Duration),
+		})
+	}
+
+	if len(playlist.Entries) == 0 {
+		return nil, ErrEmptyPlaylist
+	}
+	return playlist, nil
+}
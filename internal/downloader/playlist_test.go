@@ -0,0 +1,53 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/artur/solid-spoon/internal/downloader/ytdlptest"
+)
+
+func TestGetPlaylist_Fake(t *testing.T) {
+	d, fake, _ := newFakeDownloader(t, ytdlptest.Scenario{Info: "testdata/playlist.json"}, Config{})
+
+	playlist, err := d.GetPlaylist(context.Background(), "youtube-playlist:PLtest")
+	if err != nil {
+		t.Fatalf("GetPlaylist failed: %v", err)
+	}
+
+	if playlist.Title != "Test Playlist" {
+		t.Errorf("Unexpected title %q", playlist.Title)
+	}
+	// Вложенный плейлист пропускается
+	if len(playlist.Entries) != 3 {
+		t.Fatalf("Expected 3 videos, got %+v", playlist.Entries)
+	}
+	if e := playlist.Entries[1]; e.VideoID != "bbbbbbbbbbb" || e.Title != "Second" || e.Duration != 122 {
+		t.Errorf("Unexpected entry: %+v", e)
+	}
+
+	args := fake.LastCall(t)
+	want := []string{"--flat-playlist", "-J", "https://www.youtube.com/playlist?list=PLtest"}
+	if len(args) != len(want) || args[0] != want[0] || args[1] != want[1] || args[2] != want[2] {
+		t.Errorf("yt-dlp arguments = %v, want %v", args, want)
+	}
+}
+
+func TestGetPlaylist_Errors(t *testing.T) {
+	d, fake, _ := newFakeDownloader(t, ytdlptest.Scenario{
+		ExitCode: 1,
+		Stderr:   "ERROR: [youtube:tab] PLtest: The playlist does not exist.",
+	}, Config{})
+
+	_, err := d.GetPlaylist(context.Background(), "youtube-playlist:PLtest")
+	if !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Expected ErrUnavailable, got %v", err)
+	}
+
+	// Плейлист без видео
+	fake.Set(t, ytdlptest.Scenario{Info: "testdata/video.json"})
+	if _, err := d.GetPlaylist(context.Background(), "youtube-playlist:PLtest"); !errors.Is(err, ErrEmptyPlaylist) {
+		t.Errorf("Expected ErrEmptyPlaylist, got %v", err)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package downloader
+
+import "os/exec"
+
+// killProcessTree falls back to killing only the direct child process
+func killProcessTree(cmd *exec.Cmd) {}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package downloader
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killProcessTree makes cmd run in its own process group and kills the whole
+// group on context cancellation, so ffmpeg started by yt-dlp dies too
+func killProcessTree(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
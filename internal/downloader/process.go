@@ -0,0 +1,17 @@
+package downloader
+
+import (
+	"context"
+	"os/exec"
+	"time"
+)
+
+// command creates a process bound to ctx: on cancellation the whole process
+// tree is killed
+func (d *YouTubeDownloader) command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	killProcessTree(cmd)
+	// Не ждём вечно дочерние процессы, унаследовавшие stdout/stderr
+	cmd.WaitDelay = 5 * time.Second
+	return cmd
+}
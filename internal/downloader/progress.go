@@ -0,0 +1,201 @@
+package downloader
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stage is a phase of a download reported through progress callbacks
+type Stage string
+
+const (
+	StageDownload Stage = "download"
+	StageCompress Stage = "compress"
+	StageSplit    Stage = "split"
+	// StageBurn - субтитры вшиваются в видео
+	StageBurn Stage = "burn"
+	// StageWait - загрузка ждёт, пока освободится место на диске
+	StageWait Stage = "wait"
+)
+
+// Progress describes the state of a running download
+type Progress struct {
+	Stage           Stage
+	Percent         float64
+	DownloadedBytes int64
+	TotalBytes      int64
+	// Speed - скорость в байтах в секунду, 0 если неизвестна
+	Speed float64
+	// ETA - оставшееся время, 0 если неизвестно
+	ETA time.Duration
+}
+
+// ProgressFunc receives progress updates. It is called from the goroutines
+// reading yt-dlp output, possibly concurrently, and must not block for long.
+type ProgressFunc func(Progress)
+
+// DownloadOptions holds optional parameters of a download
+type DownloadOptions struct {
+	OnProgress ProgressFunc
+	// Clip - скачать только фрагмент видео, nil означает видео целиком
+	Clip *Clip
+	// Subtitles - скачать субтитры вместе с видео, nil означает без субтитров
+	Subtitles *Subtitles
+	// Thumbnail - подготовить превью для отправки через sendVideo
+	Thumbnail bool
+}
+
+func (o *DownloadOptions) clip() *Clip {
+	if o == nil {
+		return nil
+	}
+	return o.Clip
+}
+
+func (o *DownloadOptions) subtitles() *Subtitles {
+	if o == nil {
+		return nil
+	}
+	return o.Subtitles
+}
+
+func (o *DownloadOptions) thumbnail() bool {
+	return o != nil && o.Thumbnail
+}
+
+func (o *DownloadOptions) report(p Progress) {
+	if o != nil && o.OnProgress != nil {
+		o.OnProgress(p)
+	}
+}
+
+// progressPrefix marks machine-readable progress lines in yt-dlp output
+const progressPrefix = "[progress]"
+
+// progressArgs makes yt-dlp print one parseable progress line per update:
+// downloaded bytes, total bytes, estimated total bytes, speed and ETA
+func progressArgs() []string {
+	return []string{
+		"--progress",
+		"--newline",
+		"--progress-template",
+		"download:" + progressPrefix + " %(progress.downloaded_bytes)s %(progress.total_bytes)s %(progress.total_bytes_estimate)s %(progress.speed)s %(progress.eta)s",
+	}
+}
+
+// parseProgressLine parses a line produced by progressArgs template
+func parseProgressLine(line string) (Progress, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, progressPrefix) {
+		return Progress{}, false
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(line, progressPrefix))
+	if len(fields) != 5 {
+		return Progress{}, false
+	}
+
+	downloaded := parseNumber(fields[0])
+	total := parseNumber(fields[1])
+	if total <= 0 {
+		total = parseNumber(fields[2])
+	}
+
+	p := Progress{
+		Stage:           StageDownload,
+		DownloadedBytes: int64(downloaded),
+		TotalBytes:      int64(total),
+		Speed:           parseNumber(fields[3]),
+		ETA:             time.Duration(parseNumber(fields[4])) * time.Second,
+	}
+	if total > 0 {
+		p.Percent = downloaded / total * 100
+		if p.Percent > 100 {
+			p.Percent = 100
+		}
+	}
+
+	return p, true
+}
+
+// parseNumber parses a yt-dlp numeric field, "NA" and "None" become 0
+func parseNumber(s string) float64 {
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// runYtdlp runs yt-dlp, forwards progress lines to opts and returns the rest
+// of stdout. On failure the error contains yt-dlp stderr.
+func (d *YouTubeDownloader) runYtdlp(ctx context.Context, args []string, opts *DownloadOptions) ([]byte, error) {
+	cmd := d.command(ctx, d.ytdlpPath, args...)
+
+	stdoutPipe, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run yt-dlp: %w", err)
+	}
+	stderrPipe, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run yt-dlp: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to run yt-dlp: %w", err)
+	}
+
+	// Прогресс может прийти как в stdout, так и в stderr (зависит от --quiet)
+	var stdout, stderr bytes.Buffer
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		scanOutput(stdoutPipe, &stdout, opts)
+	}()
+	go func() {
+		defer wg.Done()
+		scanOutput(stderrPipe, &stderr, opts)
+	}()
+	wg.Wait()
+
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if _, ok := err.(*exec.ExitError); ok {
+			return nil, ytdlpError(stderr.String())
+		}
+		return nil, fmt.Errorf("failed to run yt-dlp: %w", err)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// scanOutput copies r into buf line by line, diverting progress lines to opts
+func scanOutput(r io.Reader, buf *bytes.Buffer, opts *DownloadOptions) {
+	scanner := bufio.NewScanner(r)
+	// JSON с метаданными может быть очень длинной строкой
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if p, ok := parseProgressLine(line); ok {
+			opts.report(p)
+			continue
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+
+	// Если строка не влезла в буфер, дочитываем вывод, чтобы процесс не завис на записи
+	io.Copy(io.Discard, r)
+}
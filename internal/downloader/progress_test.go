@@ -0,0 +1,90 @@
+package downloader
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseProgressLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		ok      bool
+		want    Progress
+		percent float64
+	}{
+		{
+			name: "full progress",
+			line: "[progress] 5242880 10485760 NA 1048576.5 5",
+			ok:   true,
+			want: Progress{Stage: StageDownload, DownloadedBytes: 5242880, TotalBytes: 10485760, Speed: 1048576.5, ETA: 5 * time.Second, Percent: 50},
+		},
+		{
+			name: "estimated total",
+			line: "[progress] 2500 NA 10000 NA NA",
+			ok:   true,
+			want: Progress{Stage: StageDownload, DownloadedBytes: 2500, TotalBytes: 10000, Percent: 25},
+		},
+		{
+			name: "unknown total",
+			line: "[progress] 2500 NA NA 100 NA",
+			ok:   true,
+			want: Progress{Stage: StageDownload, DownloadedBytes: 2500, Speed: 100},
+		},
+		{
+			name: "float downloaded bytes",
+			line: "  [progress] 100.0 100 NA None 0",
+			ok:   true,
+			want: Progress{Stage: StageDownload, DownloadedBytes: 100, TotalBytes: 100, Percent: 100},
+		},
+		{name: "regular output", line: "[youtube] dQw4w9WgXcQ: Downloading webpage", ok: false},
+		{name: "json", line: `{"id": "dQw4w9WgXcQ"}`, ok: false},
+		{name: "broken progress", line: "[progress] 1 2", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseProgressLine(tt.line)
+			if ok != tt.ok {
+				t.Fatalf("parseProgressLine() ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && got != tt.want {
+				t.Errorf("parseProgressLine() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanOutput(t *testing.T) {
+	output := strings.Join([]string{
+		"[progress] 10 100 NA NA NA",
+		`{"id": "test123", "title": "Test"}`,
+		"[progress] 100 100 NA NA NA",
+		"",
+	}, "\n")
+
+	var reports []Progress
+	opts := &DownloadOptions{OnProgress: func(p Progress) { reports = append(reports, p) }}
+
+	var buf bytes.Buffer
+	scanOutput(strings.NewReader(output), &buf, opts)
+
+	if len(reports) != 2 {
+		t.Fatalf("expected 2 progress reports, got %d", len(reports))
+	}
+	if reports[1].Percent != 100 {
+		t.Errorf("expected last report to be 100%%, got %f", reports[1].Percent)
+	}
+	if strings.TrimSpace(buf.String()) != `{"id": "test123", "title": "Test"}` {
+		t.Errorf("expected only JSON to remain in output, got %q", buf.String())
+	}
+}
+
+func TestDownloadOptionsReport_Nil(t *testing.T) {
+	// Отчёт о прогрессе без опций не должен паниковать
+	var opts *DownloadOptions
+	opts.report(Progress{Percent: 50})
+	(&DownloadOptions{}).report(Progress{Percent: 50})
+}
@@ -0,0 +1,254 @@
+package downloader
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Provider is a video source supported through yt-dlp extractors
+type Provider struct {
+	// Name - короткое имя источника, префикс ID его видео
+	Name string
+	// Title - название источника для пользователя
+	Title string
+	// Patterns - регулярные выражения ссылок на видео
+	Patterns []*regexp.Regexp
+	// Normalize builds the canonical video ID from a pattern match. nil means
+	// the first non-empty group is the ID as is.
+	Normalize func(match []string) string
+	// URL builds the link yt-dlp downloads from a canonical ID
+	URL func(id string) string
+	// Playlist - ссылки ведут на список видео (плейлист или канал), а не на одно видео
+	Playlist bool
+}
+
+// match returns the canonical ID of the first link of the provider in text
+func (p *Provider) match(text string) string {
+	for _, re := range p.Patterns {
+		m := re.FindStringSubmatch(text)
+		if m == nil {
+			continue
+		}
+		if p.Normalize != nil {
+			return p.Normalize(m)
+		}
+		return firstGroup(m)
+	}
+	return ""
+}
+
+func firstGroup(match []string) string {
+	for _, group := range match[1:] {
+		if group != "" {
+			return group
+		}
+	}
+	return ""
+}
+
+// Link is a video recognized by a provider
+type Link struct {
+	Provider *Provider
+	// ID - канонический ID видео внутри источника
+	ID string
+}
+
+// VideoID returns the ID the video is known by across the bot: in jobs, the
+// file cache and download stats. YouTube IDs are kept bare, as they were
+// stored before other sources were added; the rest are "<source>:<id>".
+func (l Link) VideoID() string {
+	if l.Provider.Name == SourceYouTube {
+		return l.ID
+	}
+	return l.Provider.Name + ":" + l.ID
+}
+
+// URL returns the link to download the video from
+func (l Link) URL() string {
+	return l.Provider.URL(l.ID)
+}
+
+// Registry routes links to providers
+type Registry struct {
+	providers []*Provider
+}
+
+// NewRegistry creates a registry checking providers in the given order
+func NewRegistry(providers ...*Provider) *Registry {
+	return &Registry{providers: providers}
+}
+
+// DefaultRegistry returns a registry with all built-in providers
+func DefaultRegistry() *Registry {
+	return NewRegistry(YouTube, YouTubePlaylist, YouTubeChannel, TikTok, Vimeo, Instagram, Twitter, Reddit)
+}
+
+// Register adds a provider, it is checked after the existing ones
+func (r *Registry) Register(p *Provider) {
+	r.providers = append(r.providers, p)
+}
+
+// Match finds the first supported link in text
+func (r *Registry) Match(text string) (Link, bool) {
+	for _, p := range r.providers {
+		if id := p.match(text); id != "" {
+			return Link{Provider: p, ID: id}, true
+		}
+	}
+	return Link{}, false
+}
+
+// Resolve turns a video ID produced by Link.VideoID back into a link
+func (r *Registry) Resolve(videoID string) (Link, bool) {
+	if name, id, ok := strings.Cut(videoID, ":"); ok {
+		for _, p := range r.providers {
+			if p.Name == name {
+				return Link{Provider: p, ID: id}, true
+			}
+		}
+		return Link{}, false
+	}
+	for _, p := range r.providers {
+		if p.Name == SourceYouTube {
+			return Link{Provider: p, ID: videoID}, true
+		}
+	}
+	return Link{}, false
+}
+
+// URL returns the download link of a video ID, "" if its source is unknown
+func (r *Registry) URL(videoID string) string {
+	link, ok := r.Resolve(videoID)
+	if !ok {
+		return ""
+	}
+	return link.URL()
+}
+
+// Source names of built-in providers
+const (
+	SourceYouTube         = "youtube"
+	SourceYouTubePlaylist = "youtube-playlist"
+	SourceYouTubeChannel  = "youtube-channel"
+	SourceTikTok          = "tiktok"
+	SourceVimeo           = "vimeo"
+	SourceInstagram       = "instagram"
+	SourceTwitter         = "twitter"
+	SourceReddit          = "reddit"
+)
+
+var YouTube = &Provider{
+	Name:  SourceYouTube,
+	Title: "YouTube",
+	Patterns: []*regexp.Regexp{
+		regexp.MustCompile(`(?:youtube\.com/watch\?v=|youtu\.be/|youtube\.com/shorts/)([a-zA-Z0-9_-]{11})`),
+	},
+	URL: func(id string) string {
+		return "https://www.youtube.com/watch?v=" + id
+	},
+}
+
+// YouTubePlaylist matches playlist pages. A video opened from a playlist
+// (watch?v=...&list=...) is still a single video.
+var YouTubePlaylist = &Provider{
+	Name:     SourceYouTubePlaylist,
+	Title:    "YouTube",
+	Playlist: true,
+	Patterns: []*regexp.Regexp{
+		regexp.MustCompile(`youtube\.com/playlist\?(?:\S*?&)?list=([\w-]+)`),
+	},
+	Normalize: func(m []string) string {
+		// Миксы (RD...) YouTube генерирует бесконечными
+		if strings.HasPrefix(m[1], "RD") {
+			return ""
+		}
+		return m[1]
+	},
+	URL: func(id string) string {
+		return "https://www.youtube.com/playlist?list=" + id
+	},
+}
+
+// YouTubeChannel matches channel pages, their videos are downloaded as a playlist
+var YouTubeChannel = &Provider{
+	Name:     SourceYouTubeChannel,
+	Title:    "YouTube",
+	Playlist: true,
+	Patterns: []*regexp.Regexp{
+		regexp.MustCompile(`youtube\.com/(@[\w.-]+|channel/UC[\w-]{22}|c/[\w.-]+)(?:/(?:videos|featured))?/?(?:[?#\s]|$)`),
+	},
+	URL: func(id string) string {
+		return "https://www.youtube.com/" + id + "/videos"
+	},
+}
+
+var TikTok = &Provider{
+	Name:  SourceTikTok,
+	Title: "TikTok",
+	Patterns: []*regexp.Regexp{
+		regexp.MustCompile(`tiktok\.com/(?:@[\w.-]*/video|embed(?:/v2)?)/(\d+)`),
+		// Короткие ссылки из приложения раскрывает сам yt-dlp
+		regexp.MustCompile(`(vm|vt)\.tiktok\.com/([a-zA-Z0-9]+)`),
+	},
+	Normalize: func(m []string) string {
+		if len(m) == 3 {
+			return m[1] + "-" + m[2]
+		}
+		return m[1]
+	},
+	URL: func(id string) string {
+		if host, code, ok := strings.Cut(id, "-"); ok {
+			return "https://" + host + ".tiktok.com/" + code + "/"
+		}
+		return "https://www.tiktok.com/@/video/" + id
+	},
+}
+
+var Vimeo = &Provider{
+	Name:  SourceVimeo,
+	Title: "Vimeo",
+	Patterns: []*regexp.Regexp{
+		regexp.MustCompile(`player\.vimeo\.com/video/(\d+)`),
+		regexp.MustCompile(`vimeo\.com/(?:channels/[\w-]+/|groups/[\w-]+/videos/|video/)?(\d+)`),
+	},
+	URL: func(id string) string {
+		return "https://vimeo.com/" + id
+	},
+}
+
+var Instagram = &Provider{
+	Name:  SourceInstagram,
+	Title: "Instagram",
+	Patterns: []*regexp.Regexp{
+		regexp.MustCompile(`instagram\.com/(?:[\w.]+/)?(?:reels?|p|tv)/([a-zA-Z0-9_-]+)`),
+	},
+	URL: func(id string) string {
+		return "https://www.instagram.com/reel/" + id + "/"
+	},
+}
+
+var Twitter = &Provider{
+	Name:  SourceTwitter,
+	Title: "Twitter / X",
+	Patterns: []*regexp.Regexp{
+		regexp.MustCompile(`(?:^|[^\w.])(?:(?:www|mobile)\.)?(?:twitter|x)\.com/(?:\w+|i/web)/status/(\d+)`),
+	},
+	URL: func(id string) string {
+		return "https://twitter.com/i/status/" + id
+	},
+}
+
+var Reddit = &Provider{
+	Name:  SourceReddit,
+	Title: "Reddit",
+	Patterns: []*regexp.Regexp{
+		regexp.MustCompile(`reddit\.com/(?:r/\w+/)?comments/([a-zA-Z0-9]+)`),
+		regexp.MustCompile(`(?:^|[^\w.])redd\.it/([a-zA-Z0-9]+)`),
+	},
+	Normalize: func(m []string) string {
+		return strings.ToLower(m[1])
+	},
+	URL: func(id string) string {
+		return "https://www.reddit.com/comments/" + id + "/"
+	},
+}
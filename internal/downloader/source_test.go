@@ -0,0 +1,246 @@
+package downloader
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestRegistryMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		source  string
+		videoID string
+		url     string
+	}{
+		{
+			name:    "youtube.com/watch",
+			text:    "https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+			source:  SourceYouTube,
+			videoID: "dQw4w9WgXcQ",
+			url:     "https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+		},
+		{
+			name:    "youtu.be",
+			text:    "https://youtu.be/dQw4w9WgXcQ",
+			source:  SourceYouTube,
+			videoID: "dQw4w9WgXcQ",
+			url:     "https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+		},
+		{
+			name:    "youtube.com/shorts",
+			text:    "https://youtube.com/shorts/dQw4w9WgXcQ",
+			source:  SourceYouTube,
+			videoID: "dQw4w9WgXcQ",
+			url:     "https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+		},
+		{
+			name:    "tiktok video",
+			text:    "https://www.tiktok.com/@some.user/video/7301234567890123456?is_from_webapp=1",
+			source:  SourceTikTok,
+			videoID: "tiktok:7301234567890123456",
+			url:     "https://www.tiktok.com/@/video/7301234567890123456",
+		},
+		{
+			name:    "tiktok short link",
+			text:    "смотри https://vm.tiktok.com/ZMabc123/",
+			source:  SourceTikTok,
+			videoID: "tiktok:vm-ZMabc123",
+			url:     "https://vm.tiktok.com/ZMabc123/",
+		},
+		{
+			name:    "vimeo",
+			text:    "https://vimeo.com/76979871",
+			source:  SourceVimeo,
+			videoID: "vimeo:76979871",
+			url:     "https://vimeo.com/76979871",
+		},
+		{
+			name:    "vimeo player",
+			text:    "https://player.vimeo.com/video/76979871?h=8272103f6e",
+			source:  SourceVimeo,
+			videoID: "vimeo:76979871",
+			url:     "https://vimeo.com/76979871",
+		},
+		{
+			name:    "vimeo channel",
+			text:    "https://vimeo.com/channels/staffpicks/76979871",
+			source:  SourceVimeo,
+			videoID: "vimeo:76979871",
+			url:     "https://vimeo.com/76979871",
+		},
+		{
+			name:    "instagram reel",
+			text:    "https://www.instagram.com/reel/C1a2B3c4D5e/?igsh=abc",
+			source:  SourceInstagram,
+			videoID: "instagram:C1a2B3c4D5e",
+			url:     "https://www.instagram.com/reel/C1a2B3c4D5e/",
+		},
+		{
+			name:    "instagram reels",
+			text:    "https://instagram.com/reels/C1a2B3c4D5e",
+			source:  SourceInstagram,
+			videoID: "instagram:C1a2B3c4D5e",
+			url:     "https://www.instagram.com/reel/C1a2B3c4D5e/",
+		},
+		{
+			name:    "twitter",
+			text:    "https://twitter.com/someone/status/1712345678901234567",
+			source:  SourceTwitter,
+			videoID: "twitter:1712345678901234567",
+			url:     "https://twitter.com/i/status/1712345678901234567",
+		},
+		{
+			name:    "x.com",
+			text:    "https://x.com/someone/status/1712345678901234567?s=20",
+			source:  SourceTwitter,
+			videoID: "twitter:1712345678901234567",
+			url:     "https://twitter.com/i/status/1712345678901234567",
+		},
+		{
+			name:    "reddit",
+			text:    "https://www.reddit.com/r/videos/comments/1AbC2d/some_title/",
+			source:  SourceReddit,
+			videoID: "reddit:1abc2d",
+			url:     "https://www.reddit.com/comments/1abc2d/",
+		},
+		{
+			name:    "reddit short link",
+			text:    "https://redd.it/1abc2d",
+			source:  SourceReddit,
+			videoID: "reddit:1abc2d",
+			url:     "https://www.reddit.com/comments/1abc2d/",
+		},
+	}
+
+	registry := DefaultRegistry()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link, ok := registry.Match(tt.text)
+			if !ok {
+				t.Fatalf("Match(%q) found nothing", tt.text)
+			}
+			if link.Provider.Name != tt.source || link.VideoID() != tt.videoID || link.URL() != tt.url {
+				t.Errorf("Match(%q) = %s %q %q, want %s %q %q",
+					tt.text, link.Provider.Name, link.VideoID(), link.URL(), tt.source, tt.videoID, tt.url)
+			}
+
+			// ID из задачи или кнопки должен вести на ту же ссылку
+			if url := registry.URL(link.VideoID()); url != tt.url {
+				t.Errorf("URL(%q) = %q, want %q", link.VideoID(), url, tt.url)
+			}
+		})
+	}
+}
+
+func TestRegistryMatch_Unsupported(t *testing.T) {
+	registry := DefaultRegistry()
+	for _, text := range []string{
+		"",
+		"https://example.com/video",
+		"https://www.youtube.com/watch?v=short",
+		"https://notx.com/someone/status/1712345678901234567",
+		"https://v.redd.it/abc123",
+	} {
+		if link, ok := registry.Match(text); ok {
+			t.Errorf("Match(%q) = %s %q, want no match", text, link.Provider.Name, link.ID)
+		}
+	}
+}
+
+func TestRegistryResolve_Unknown(t *testing.T) {
+	registry := DefaultRegistry()
+	if url := registry.URL("dailymotion:x7tgad0"); url != "" {
+		t.Errorf("Expected no URL for unknown source, got %q", url)
+	}
+}
+
+func TestRegistryRegister(t *testing.T) {
+	registry := NewRegistry(YouTube)
+	registry.Register(&Provider{
+		Name:     "rutube",
+		Title:    "Rutube",
+		Patterns: []*regexp.Regexp{regexp.MustCompile(`rutube\.ru/video/([0-9a-f]{32})`)},
+		URL:      func(id string) string { return "https://rutube.ru/video/" + id + "/" },
+	})
+
+	link, ok := registry.Match("https://rutube.ru/video/0123456789abcdef0123456789abcdef/")
+	if !ok || link.VideoID() != "rutube:0123456789abcdef0123456789abcdef" {
+		t.Fatalf("Expected custom provider to match, got %+v %v", link, ok)
+	}
+	if _, ok := registry.Match("https://vimeo.com/76979871"); ok {
+		t.Error("Providers that were not registered must not match")
+	}
+}
+
+func TestFileKey(t *testing.T) {
+	if got := fileKey("tiktok:vm-ZMabc123"); got != "tiktok-vm-ZMabc123" {
+		t.Errorf("fileKey() = %q", got)
+	}
+	if got := fileKey("dQw4w9WgXcQ"); got != "dQw4w9WgXcQ" {
+		t.Errorf("fileKey() = %q", got)
+	}
+}
+
+func TestRegistryMatch_Playlists(t *testing.T) {
+	tests := []struct {
+		text    string
+		source  string
+		videoID string
+		url     string
+	}{
+		{
+			"https://www.youtube.com/playlist?list=PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf",
+			SourceYouTubePlaylist,
+			"youtube-playlist:PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf",
+			"https://www.youtube.com/playlist?list=PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf",
+		},
+		{
+			"https://youtube.com/playlist?si=abc&list=OLAK5uy_abc-123 1-10",
+			SourceYouTubePlaylist,
+			"youtube-playlist:OLAK5uy_abc-123",
+			"https://www.youtube.com/playlist?list=OLAK5uy_abc-123",
+		},
+		{
+			"https://www.youtube.com/@SomeChannel/videos",
+			SourceYouTubeChannel,
+			"youtube-channel:@SomeChannel",
+			"https://www.youtube.com/@SomeChannel/videos",
+		},
+		{
+			"https://www.youtube.com/channel/UC1234567890123456789012",
+			SourceYouTubeChannel,
+			"youtube-channel:channel/UC1234567890123456789012",
+			"https://www.youtube.com/channel/UC1234567890123456789012/videos",
+		},
+		{
+			// Видео, открытое из плейлиста, остаётся одним видео
+			"https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf",
+			SourceYouTube,
+			"dQw4w9WgXcQ",
+			"https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+		},
+	}
+
+	registry := DefaultRegistry()
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			link, ok := registry.Match(tt.text)
+			if !ok {
+				t.Fatalf("Match(%q) found nothing", tt.text)
+			}
+			if link.Provider.Name != tt.source || link.VideoID() != tt.videoID || registry.URL(link.VideoID()) != tt.url {
+				t.Errorf("Match(%q) = %s %q %q, want %s %q %q",
+					tt.text, link.Provider.Name, link.VideoID(), link.URL(), tt.source, tt.videoID, tt.url)
+			}
+			if link.Provider.Playlist != (tt.source != SourceYouTube) {
+				t.Errorf("Unexpected Playlist flag for %s", link.Provider.Name)
+			}
+		})
+	}
+
+	// Бесконечные миксы не скачиваем
+	if _, ok := registry.Match("https://www.youtube.com/playlist?list=RDdQw4w9WgXcQ"); ok {
+		t.Error("Mixes must not be matched as playlists")
+	}
+}
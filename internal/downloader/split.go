@@ -0,0 +1,122 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// splitHeadroom - доля лимита, на которую целимся при нарезке: части режутся
+	// по ключевым кадрам и получаются неравными
+	splitHeadroom = 0.9
+	// maxSplitAttempts - сколько раз пробуем нарезать мельче, если часть не влезла
+	maxSplitAttempts = 3
+)
+
+// splitPlan returns how many parts a file of the given size needs and how long
+// (in seconds) every part should be
+func splitPlan(size, maxSize int64, duration float64) (count int, segmentTime float64, err error) {
+	if duration <= 0 {
+		return 0, 0, fmt.Errorf("unknown video duration")
+	}
+
+	count = int(math.Ceil(float64(size) / (float64(maxSize) * splitHeadroom)))
+	if count < 2 {
+		count = 2
+	}
+	return count, duration / float64(count), nil
+}
+
+// split cuts the file at path into playable parts no larger than maxSize using
+// stream copy. The original file is left in place.
+func (d *YouTubeDownloader) split(ctx context.Context, path string, duration float64, size, maxSize int64) ([]string, error) {
+	count, segmentTime, err := splitPlan(size, maxSize, duration)
+	if err != nil {
+		return nil, err
+	}
+
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	pattern := base + "-part%03d" + filepath.Ext(path)
+
+	for attempt := 1; attempt <= maxSplitAttempts; attempt++ {
+		log.Printf("[DOWNLOADER] Splitting %s into ~%d parts of %.0fs (attempt %d)",
+			path, count, segmentTime, attempt)
+
+		parts, err := d.segment(ctx, path, pattern, segmentTime)
+		if err != nil {
+			removeFiles(parts)
+			return nil, err
+		}
+
+		oversized := firstOversized(parts, maxSize)
+		if oversized == "" {
+			log.Printf("[DOWNLOADER] Split into %d parts", len(parts))
+			return parts, nil
+		}
+
+		log.Printf("[DOWNLOADER] Part %s exceeds limit, splitting finer", oversized)
+		removeFiles(parts)
+		count++
+		segmentTime = duration / float64(count)
+	}
+
+	return nil, fmt.Errorf("could not split video into parts under %d MB", maxSize/(1024*1024))
+}
+
+// segment runs ffmpeg segment muxer and returns produced files in order
+func (d *YouTubeDownloader) segment(ctx context.Context, inputPath, pattern string, segmentTime float64) ([]string, error) {
+	args := []string{
+		"-y",
+		"-i", inputPath,
+		"-map", "0",
+		"-c", "copy",
+		"-f", "segment",
+		"-segment_time", fmt.Sprintf("%.2f", segmentTime),
+		"-reset_timestamps", "1",
+		pattern,
+	}
+
+	cmd := d.command(ctx, d.ffmpegPath, args...)
+	output, err := cmd.CombinedOutput()
+
+	parts, globErr := filepath.Glob(strings.Replace(pattern, "%03d", "[0-9][0-9][0-9]", 1))
+	if globErr != nil {
+		return nil, globErr
+	}
+	sort.Strings(parts)
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return parts, ctx.Err()
+		}
+		return parts, fmt.Errorf("ffmpeg error: %w: %s", err, lastLines(string(output), 5))
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("ffmpeg produced no parts")
+	}
+	return parts, nil
+}
+
+func firstOversized(paths []string, maxSize int64) string {
+	for _, path := range paths {
+		fileInfo, err := os.Stat(path)
+		if err != nil || fileInfo.Size() > maxSize {
+			return path
+		}
+	}
+	return ""
+}
+
+func removeFiles(paths []string) {
+	for _, path := range paths {
+		if path != "" {
+			os.Remove(path)
+		}
+	}
+}
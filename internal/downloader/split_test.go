@@ -0,0 +1,78 @@
+package downloader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitPlan(t *testing.T) {
+	const mb = 1024 * 1024
+
+	tests := []struct {
+		name      string
+		size      int64
+		maxSize   int64
+		duration  float64
+		wantCount int
+		wantTime  float64
+		wantErr   bool
+	}{
+		{"slightly oversized", 60 * mb, 50 * mb, 600, 2, 300, false},
+		{"four parts", 170 * mb, 50 * mb, 800, 4, 200, false},
+		{"headroom adds a part", 90 * mb, 50 * mb, 300, 2, 150, false},
+		{"headroom boundary", 91 * mb, 50 * mb, 300, 3, 100, false},
+		{"unknown duration", 100 * mb, 50 * mb, 0, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, segmentTime, err := splitPlan(tt.size, tt.maxSize, tt.duration)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if count != tt.wantCount {
+				t.Errorf("count = %d, want %d", count, tt.wantCount)
+			}
+			if segmentTime != tt.wantTime {
+				t.Errorf("segmentTime = %f, want %f", segmentTime, tt.wantTime)
+			}
+		})
+	}
+}
+
+func TestFirstOversized(t *testing.T) {
+	dir := t.TempDir()
+	small := filepath.Join(dir, "small.mp4")
+	big := filepath.Join(dir, "big.mp4")
+	os.WriteFile(small, make([]byte, 10), 0644)
+	os.WriteFile(big, make([]byte, 100), 0644)
+
+	if got := firstOversized([]string{small}, 50); got != "" {
+		t.Errorf("expected no oversized parts, got %s", got)
+	}
+	if got := firstOversized([]string{small, big}, 50); got != big {
+		t.Errorf("expected %s to be oversized, got %q", big, got)
+	}
+	if got := firstOversized([]string{filepath.Join(dir, "missing.mp4")}, 50); got == "" {
+		t.Error("expected missing part to be reported")
+	}
+}
+
+func TestVideoInfoFiles(t *testing.T) {
+	single := &VideoInfo{FilePath: "/tmp/video.mp4"}
+	if files := single.Files(); len(files) != 1 || files[0] != "/tmp/video.mp4" {
+		t.Errorf("unexpected files for single video: %v", files)
+	}
+
+	split := &VideoInfo{Parts: []string{"/tmp/a.mp4", "/tmp/b.mp4"}}
+	if files := split.Files(); len(files) != 2 || files[1] != "/tmp/b.mp4" {
+		t.Errorf("unexpected files for split video: %v", files)
+	}
+}
@@ -0,0 +1,227 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SubtitleTrack is a subtitle language available for a video
+type SubtitleTrack struct {
+	// Lang - код языка, как его понимает yt-dlp --sub-langs
+	Lang string
+	Name string
+	// Auto - автоматически сгенерированные субтитры
+	Auto bool
+}
+
+// SubtitleMode is how subtitles are delivered
+type SubtitleMode string
+
+const (
+	// SubtitlesFile - отдельный файл .srt (или .vtt без ffmpeg)
+	SubtitlesFile SubtitleMode = "file"
+	// SubtitlesBurn - субтитры вшиваются в изображение, требует ffmpeg
+	SubtitlesBurn SubtitleMode = "burn"
+)
+
+// Subtitles selects the subtitles to download with a video
+type Subtitles struct {
+	Lang string
+	Auto bool
+	Mode SubtitleMode
+}
+
+// String returns the selection as "<mode>:<lang>[:auto]", ParseSubtitles reads it back
+func (s Subtitles) String() string {
+	str := string(s.Mode) + ":" + s.Lang
+	if s.Auto {
+		str += ":auto"
+	}
+	return str
+}
+
+// ParseSubtitles parses a selection formatted by Subtitles.String
+func ParseSubtitles(str string) (Subtitles, bool) {
+	parts := strings.Split(str, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[1] == "" {
+		return Subtitles{}, false
+	}
+	s := Subtitles{Mode: SubtitleMode(parts[0]), Lang: parts[1]}
+	if s.Mode != SubtitlesFile && s.Mode != SubtitlesBurn {
+		return Subtitles{}, false
+	}
+	if len(parts) == 3 {
+		if parts[2] != "auto" {
+			return Subtitles{}, false
+		}
+		s.Auto = true
+	}
+	return s, true
+}
+
+// SubtitleLister lists subtitles of a video. Downloaders that can download
+// subtitles with DownloadOptions.Subtitles implement it.
+type SubtitleLister interface {
+	GetSubtitles(ctx context.Context, videoID string) ([]SubtitleTrack, error)
+}
+
+// ytdlpSubtitle is one format of a subtitle track in yt-dlp metadata
+type ytdlpSubtitle struct {
+	Ext  string `json:"ext"`
+	URL  string `json:"url"`
+	Name string `json:"name"`
+}
+
+// autoCaptionLangs - автоматические субтитры YouTube переводит на сотни языков,
+// предлагаем только оригинальную дорожку и эти языки
+var autoCaptionLangs = []string{"ru", "en"}
+
+// GetSubtitles lists manual subtitles of the video followed by auto-generated ones
+func (d *YouTubeDownloader) GetSubtitles(ctx context.Context, videoID string) ([]SubtitleTrack, error) {
+	info, err := d.videoInfo(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+	return subtitleTracks(info), nil
+}
+
+// subtitleTracks extracts subtitle languages from yt-dlp metadata
+func subtitleTracks(info *ytdlpVideoInfo) []SubtitleTrack {
+	var manual []SubtitleTrack
+	for lang, formats := range info.Subtitles {
+		// Чат трансляции yt-dlp тоже отдаёт как субтитры
+		if lang == "live_chat" || len(formats) == 0 {
+			continue
+		}
+		manual = append(manual, SubtitleTrack{Lang: lang, Name: subtitleName(lang, formats)})
+	}
+	sort.Slice(manual, func(i, j int) bool { return manual[i].Lang < manual[j].Lang })
+
+	var auto []SubtitleTrack
+	for lang, formats := range info.AutomaticCaptions {
+		if len(formats) == 0 {
+			continue
+		}
+		if !strings.HasSuffix(lang, "-orig") && !containsString(autoCaptionLangs, lang) {
+			continue
+		}
+		auto = append(auto, SubtitleTrack{Lang: lang, Name: subtitleName(lang, formats), Auto: true})
+	}
+	sort.Slice(auto, func(i, j int) bool { return auto[i].Lang < auto[j].Lang })
+
+	return append(manual, auto...)
+}
+
+func subtitleName(lang string, formats []ytdlpSubtitle) string {
+	for _, f := range formats {
+		if f.Name != "" {
+			return f.Name
+		}
+	}
+	return lang
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// subtitleArgs returns yt-dlp arguments that download the subtitles next to
+// the video. With ffmpeg they are converted to .srt, which players handle best.
+func (d *YouTubeDownloader) subtitleArgs(s *Subtitles) []string {
+	if s == nil {
+		return nil
+	}
+	flag := "--write-subs"
+	if s.Auto {
+		flag = "--write-auto-subs"
+	}
+	args := []string{flag, "--sub-langs", s.Lang, "--sub-format", "srt/vtt/best"}
+	if d.hasFFmpeg() {
+		args = append(args, "--convert-subs", "srt")
+	}
+	return args
+}
+
+// findSubtitles returns the subtitle file yt-dlp wrote for the video at
+// videoPath: <name>.<lang>.<ext>. Empty if there is none.
+func findSubtitles(videoPath, lang string) string {
+	base := strings.TrimSuffix(videoPath, filepath.Ext(videoPath))
+	matches, _ := filepath.Glob(base + "." + lang + ".*")
+	for _, m := range matches {
+		if !strings.HasSuffix(m, ".part") {
+			return m
+		}
+	}
+	return ""
+}
+
+// applySubtitles finds the subtitles downloaded with the video at path and
+// either burns them in or returns their file to be sent separately
+func (d *YouTubeDownloader) applySubtitles(ctx context.Context, path string, s *Subtitles, opts *DownloadOptions) (string, error) {
+	if s == nil {
+		return "", nil
+	}
+
+	subtitlesPath := findSubtitles(path, s.Lang)
+	if subtitlesPath == "" {
+		return "", ErrNoSubtitles
+	}
+	if s.Mode != SubtitlesBurn {
+		return subtitlesPath, nil
+	}
+
+	defer os.Remove(subtitlesPath)
+	opts.report(Progress{Stage: StageBurn})
+	if err := d.burnSubtitles(ctx, path, subtitlesPath); err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", fmt.Errorf("failed to burn subtitles: %w", err)
+	}
+	return "", nil
+}
+
+// burnSubtitles renders the subtitles into the video at path in place
+func (d *YouTubeDownloader) burnSubtitles(ctx context.Context, path, subtitlesPath string) error {
+	tmpPath := siblingPath(path, "-subs")
+	defer os.Remove(tmpPath)
+
+	log.Printf("[DOWNLOADER] Burning subtitles %s into %s", subtitlesPath, path)
+
+	args := []string{
+		"-y",
+		"-i", path,
+		"-vf", "subtitles=" + escapeFilterValue(subtitlesPath),
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-crf", "23",
+		"-c:a", "copy",
+	}
+	args = append(args, faststartArgs(tmpPath)...)
+	args = append(args, tmpPath)
+
+	cmd := d.command(ctx, d.ffmpegPath, args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("ffmpeg error: %w: %s", err, lastLines(string(output), 5))
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// escapeFilterValue escapes characters special in ffmpeg filter options,
+// e.g. the drive colon of Windows paths
+func escapeFilterValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `:`, `\:`, `'`, `\'`, `,`, `\,`, `[`, `\[`, `]`, `\]`, `;`, `\;`).Replace(s)
+}
@@ -0,0 +1,134 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/artur/solid-spoon/internal/downloader/ytdlptest"
+)
+
+func TestSubtitlesString(t *testing.T) {
+	selections := []Subtitles{
+		{Lang: "en", Mode: SubtitlesFile},
+		{Lang: "en-orig", Auto: true, Mode: SubtitlesBurn},
+	}
+	for _, s := range selections {
+		parsed, ok := ParseSubtitles(s.String())
+		if !ok || parsed != s {
+			t.Errorf("ParseSubtitles(%q) = %+v, %v, want %+v", s.String(), parsed, ok, s)
+		}
+	}
+
+	for _, str := range []string{"", "file", "file:", "show:en", "file:en:manual", "file:en:auto:x"} {
+		if _, ok := ParseSubtitles(str); ok {
+			t.Errorf("Expected %q to be rejected", str)
+		}
+	}
+}
+
+func TestGetSubtitles_Fake(t *testing.T) {
+	d, _, _ := newFakeDownloader(t, ytdlptest.Scenario{Info: fixtureVideo}, Config{})
+
+	tracks, err := d.GetSubtitles(context.Background(), "dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatalf("GetSubtitles failed: %v", err)
+	}
+
+	// Сначала ручные субтитры, потом оригинальные автоматические и ru/en; чат и другие переводы не предлагаются
+	want := []SubtitleTrack{
+		{Lang: "de", Name: "German"},
+		{Lang: "en", Name: "English"},
+		{Lang: "en", Name: "English", Auto: true},
+		{Lang: "en-orig", Name: "English (Original)", Auto: true},
+		{Lang: "ru", Name: "Russian", Auto: true},
+	}
+	if len(tracks) != len(want) {
+		t.Fatalf("Tracks = %+v, want %+v", tracks, want)
+	}
+	for i := range want {
+		if tracks[i] != want[i] {
+			t.Errorf("Track %d = %+v, want %+v", i, tracks[i], want[i])
+		}
+	}
+}
+
+func TestDownloadWithQualityInfo_SubtitlesFile(t *testing.T) {
+	d, fake, tmp := newFakeDownloader(t, ytdlptest.Scenario{Info: fixtureVideo, FileSize: 1024}, Config{})
+
+	opts := &DownloadOptions{Subtitles: &Subtitles{Lang: "en", Auto: true, Mode: SubtitlesFile}}
+	info, err := d.DownloadWithQualityInfo(context.Background(), "dQw4w9WgXcQ", QualityHigh, opts)
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	defer info.Cleanup()
+
+	// Без ffmpeg субтитры остаются в исходном формате
+	assertJobFile(t, tmp, info.Subtitles, "yt-dQw4w9WgXcQ.en.vtt")
+	args := fake.LastCall(t)
+	if !containsString(args, "--write-auto-subs") || ytdlptest.Arg(args, "--sub-langs") != "en" {
+		t.Errorf("Expected auto subtitles in en to be requested, got %v", args)
+	}
+}
+
+func TestDownloadWithQualityInfo_SubtitlesBurn(t *testing.T) {
+	ffmpeg, err := filepath.Abs(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, fake, _ := newFakeDownloader(t, ytdlptest.Scenario{Info: fixtureVideo, FileSize: 1024}, Config{FfmpegPath: ffmpeg})
+
+	var stages []Stage
+	opts := &DownloadOptions{
+		Subtitles:  &Subtitles{Lang: "de", Mode: SubtitlesBurn},
+		OnProgress: func(p Progress) { stages = append(stages, p.Stage) },
+	}
+	info, err := d.DownloadWithQualityInfo(context.Background(), "dQw4w9WgXcQ", QualityHigh, opts)
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	defer info.Cleanup()
+
+	if info.Subtitles != "" {
+		t.Errorf("Burned subtitles must not be returned as a file, got %q", info.Subtitles)
+	}
+	if len(stages) == 0 || stages[len(stages)-1] != StageBurn {
+		t.Errorf("Expected burn stage to be reported, got %v", stages)
+	}
+
+	calls := fake.Calls(t)
+	burn := calls[len(calls)-1]
+	if vf := ytdlptest.Arg(burn, "-vf"); vf != "subtitles="+escapeFilterValue(filepath.Join(filepath.Dir(info.FilePath), "yt-dQw4w9WgXcQ.de.srt")) {
+		t.Errorf("Unexpected subtitles filter %q", vf)
+	}
+
+	// Остаётся только видео
+	entries, _ := os.ReadDir(filepath.Dir(info.FilePath))
+	if len(entries) != 1 {
+		t.Errorf("Expected only the video to be left, got %v", entries)
+	}
+}
+
+func TestDownloadWithQualityInfo_SubtitlesErrors(t *testing.T) {
+	d, fake, tmp := newFakeDownloader(t, ytdlptest.Scenario{Info: fixtureVideo, FileSize: 1024, NoSubtitles: true}, Config{})
+
+	_, err := d.DownloadWithQualityInfo(context.Background(), "dQw4w9WgXcQ", QualityHigh, &DownloadOptions{Subtitles: &Subtitles{Lang: "xx", Mode: SubtitlesFile}})
+	if !errors.Is(err, ErrNoSubtitles) {
+		t.Errorf("Expected ErrNoSubtitles, got %v", err)
+	}
+	assertEmptyDir(t, tmp)
+
+	fake.Set(t, ytdlptest.Scenario{Info: fixtureVideo, FileSize: 1024})
+	_, err = d.DownloadWithQualityInfo(context.Background(), "dQw4w9WgXcQ", QualityHigh, &DownloadOptions{Subtitles: &Subtitles{Lang: "en", Mode: SubtitlesBurn}})
+	if !errors.Is(err, ErrSubtitlesUnsupported) {
+		t.Errorf("Expected ErrSubtitlesUnsupported without ffmpeg, got %v", err)
+	}
+}
+
+func TestEscapeFilterValue(t *testing.T) {
+	if got := escapeFilterValue(`C:\tmp\it's.srt`); got != `C\:\\tmp\\it\'s.srt` {
+		t.Errorf("Unexpected escaping %q", got)
+	}
+}
@@ -0,0 +1,132 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// thumbnailSide - Telegram принимает превью не больше 320x320
+	thumbnailSide = 320
+	// maxThumbnailSize - и не тяжелее 200 КБ
+	maxThumbnailSize = 200 * 1024
+)
+
+// ytdlpThumbnail is one of the thumbnails listed in yt-dlp metadata
+type ytdlpThumbnail struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// thumbnail makes a JPEG preview for the video at path, the file is placed
+// next to it. With ffmpeg a frame of the video is used, otherwise one of the
+// thumbnails yt-dlp lists is downloaded. Previews are optional: on failure
+// the error is logged and an empty path is returned.
+func (d *YouTubeDownloader) thumbnail(ctx context.Context, path string, duration float64, info *ytdlpVideoInfo) string {
+	thumbPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".jpg"
+
+	var err error
+	if d.hasFFmpeg() {
+		err = d.extractThumbnail(ctx, path, thumbPath, duration)
+	} else {
+		err = fetchThumbnail(ctx, info.Thumbnails, thumbPath)
+	}
+	if err != nil {
+		os.Remove(thumbPath)
+		log.Printf("[DOWNLOADER] No thumbnail for %s: %v", path, err)
+		return ""
+	}
+
+	if fileInfo, err := os.Stat(thumbPath); err != nil || fileInfo.Size() > maxThumbnailSize {
+		os.Remove(thumbPath)
+		log.Printf("[DOWNLOADER] Thumbnail for %s is missing or too large", path)
+		return ""
+	}
+	return thumbPath
+}
+
+// extractThumbnail saves a frame from the first tenth of the video, the very
+// first frame is often black
+func (d *YouTubeDownloader) extractThumbnail(ctx context.Context, path, thumbPath string, duration float64) error {
+	position := strconv.FormatFloat(duration/10, 'f', 2, 64)
+	side := strconv.Itoa(thumbnailSide)
+
+	args := []string{
+		"-y",
+		"-ss", position,
+		"-i", path,
+		"-frames:v", "1",
+		"-vf", "scale=" + side + ":" + side + ":force_original_aspect_ratio=decrease",
+		"-q:v", "5",
+		thumbPath,
+	}
+
+	cmd := d.command(ctx, d.ffmpegPath, args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("ffmpeg error: %w: %s", err, lastLines(string(output), 5))
+	}
+	return nil
+}
+
+// fetchThumbnail downloads the largest JPEG thumbnail Telegram accepts as is
+func fetchThumbnail(ctx context.Context, thumbnails []ytdlpThumbnail, thumbPath string) error {
+	url := pickThumbnail(thumbnails)
+	if url == "" {
+		return fmt.Errorf("no suitable thumbnail")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("thumbnail request failed: %s", resp.Status)
+	}
+
+	file, err := os.Create(thumbPath)
+	if err != nil {
+		return err
+	}
+	// Читаем на байт больше лимита, чтобы отличить слишком большой файл
+	_, err = io.Copy(file, io.LimitReader(resp.Body, maxThumbnailSize+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// pickThumbnail returns the URL of the largest JPEG thumbnail that fits into
+// thumbnailSide, empty if there is none. Converting other formats needs ffmpeg.
+func pickThumbnail(thumbnails []ytdlpThumbnail) string {
+	best, bestWidth := "", 0
+	for _, t := range thumbnails {
+		if !isJPEG(t.URL) || t.Width == 0 || t.Width > thumbnailSide || t.Height > thumbnailSide {
+			continue
+		}
+		if t.Width > bestWidth {
+			best, bestWidth = t.URL, t.Width
+		}
+	}
+	return best
+}
+
+func isJPEG(url string) bool {
+	url, _, _ = strings.Cut(url, "?")
+	return strings.HasSuffix(url, ".jpg") || strings.HasSuffix(url, ".jpeg")
+}
@@ -0,0 +1,111 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/artur/solid-spoon/internal/downloader/ytdlptest"
+)
+
+func TestPickThumbnail(t *testing.T) {
+	tests := []struct {
+		name       string
+		thumbnails []ytdlpThumbnail
+		want       string
+	}{
+		{
+			name: "largest fitting jpeg",
+			thumbnails: []ytdlpThumbnail{
+				{URL: "https://example.com/default.jpg", Width: 120, Height: 90},
+				{URL: "https://example.com/mq.jpg?v=1", Width: 320, Height: 180},
+				{URL: "https://example.com/hq.jpg", Width: 480, Height: 360},
+			},
+			want: "https://example.com/mq.jpg?v=1",
+		},
+		{
+			name: "webp needs conversion",
+			thumbnails: []ytdlpThumbnail{
+				{URL: "https://example.com/small.webp", Width: 320, Height: 180},
+			},
+			want: "",
+		},
+		{
+			name: "unknown size",
+			thumbnails: []ytdlpThumbnail{
+				{URL: "https://example.com/thumb.jpg"},
+			},
+			want: "",
+		},
+		{name: "none", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pickThumbnail(tt.thumbnails); got != tt.want {
+				t.Errorf("pickThumbnail() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchThumbnail(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/large.jpg" {
+			w.Write(make([]byte, maxThumbnailSize+10))
+			return
+		}
+		w.Write([]byte("jpeg"))
+	}))
+	defer srv.Close()
+
+	d := NewYouTubeDownloaderWithConfig(Config{})
+	video := filepath.Join(t.TempDir(), "yt-test.mp4")
+
+	info := &ytdlpVideoInfo{Thumbnails: []ytdlpThumbnail{{URL: srv.URL + "/thumb.jpg", Width: 320, Height: 180}}}
+	path := d.thumbnail(context.Background(), video, 10, info)
+	if path != strings.TrimSuffix(video, ".mp4")+".jpg" {
+		t.Fatalf("Expected thumbnail next to the video, got %q", path)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "jpeg" {
+		t.Errorf("Unexpected thumbnail content %q", data)
+	}
+
+	// Превью тяжелее лимита Telegram не отправляем
+	info.Thumbnails[0].URL = srv.URL + "/large.jpg"
+	if path := d.thumbnail(context.Background(), video, 10, info); path != "" {
+		t.Errorf("Expected oversized thumbnail to be dropped, got %q", path)
+	}
+	if _, err := os.Stat(strings.TrimSuffix(video, ".mp4") + ".jpg"); !os.IsNotExist(err) {
+		t.Errorf("Expected oversized thumbnail to be removed: %v", err)
+	}
+}
+
+func TestDownloadWithQualityInfo_Thumbnail(t *testing.T) {
+	ffmpeg, err := filepath.Abs(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, fake, tmp := newFakeDownloader(t, ytdlptest.Scenario{Info: fixtureVideo, FileSize: 1024}, Config{FfmpegPath: ffmpeg})
+
+	info, err := d.DownloadWithQualityInfo(context.Background(), "dQw4w9WgXcQ", QualityHigh, &DownloadOptions{Thumbnail: true})
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	defer info.Cleanup()
+
+	assertJobFile(t, tmp, info.Thumbnail, "yt-dQw4w9WgXcQ.jpg")
+
+	calls := fake.Calls(t)
+	extract := calls[len(calls)-1]
+	if ytdlptest.Arg(extract, "-i") != info.FilePath || ytdlptest.Arg(extract, "-frames:v") != "1" {
+		t.Errorf("Expected a single frame to be extracted from the video, got %v", extract)
+	}
+	if ss := ytdlptest.Arg(extract, "-ss"); ss != "21.24" {
+		t.Errorf("Expected a frame from the first tenth of the video, got -ss %q", ss)
+	}
+}
@@ -0,0 +1,132 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// workDirPrefix - префикс каталогов загрузок, по нему их находит RemoveTempFiles.
+// Файлы старых версий бота лежали прямо в temp с тем же префиксом.
+const workDirPrefix = "yt-"
+
+// Workspace hands out a private directory to every download, so parallel
+// downloads of the same video never share files, and keeps the disk space
+// reserved by running downloads under a budget
+type Workspace struct {
+	root string
+	// budget - сколько байт можно зарезервировать одновременно, 0 - без ограничения
+	budget int64
+
+	mu       sync.Mutex
+	reserved int64
+	// freed закрывается при каждом освобождении места, чтобы разбудить ждущих
+	freed chan struct{}
+}
+
+// NewWorkspace creates a workspace in root, the system temp dir if root is empty
+func NewWorkspace(root string, budget int64) *Workspace {
+	if root == "" {
+		root = os.TempDir()
+	}
+	return &Workspace{root: root, budget: max(budget, 0), freed: make(chan struct{})}
+}
+
+// jobDir is the directory of one download and its share of the budget
+type jobDir struct {
+	path string
+	size int64
+	ws   *Workspace
+	once sync.Once
+}
+
+// acquire reserves size bytes and creates a directory for a download. If the
+// budget is exhausted it calls onWait once and waits until other downloads
+// finish. A download larger than the whole budget waits for all others.
+func (w *Workspace) acquire(ctx context.Context, size int64, onWait func()) (*jobDir, error) {
+	if w.budget > 0 && size > w.budget {
+		size = w.budget
+	}
+
+	waited := false
+	for {
+		w.mu.Lock()
+		if w.budget == 0 || w.reserved+size <= w.budget {
+			w.reserved += size
+			w.mu.Unlock()
+			break
+		}
+		freed := w.freed
+		w.mu.Unlock()
+
+		if !waited {
+			log.Printf("[DOWNLOADER] Disk budget of %.0f MB is used up, waiting", megabytes(w.budget))
+			onWait()
+			waited = true
+		}
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	dir := &jobDir{size: size, ws: w}
+	if err := os.MkdirAll(w.root, 0755); err != nil {
+		dir.free()
+		return nil, fmt.Errorf("failed to create work dir: %w", err)
+	}
+	path, err := os.MkdirTemp(w.root, workDirPrefix+"*")
+	if err != nil {
+		dir.free()
+		return nil, fmt.Errorf("failed to create job dir: %w", err)
+	}
+	dir.path = path
+	return dir, nil
+}
+
+// free returns the reserved space to the budget, the files stay
+func (j *jobDir) free() {
+	if j == nil {
+		return
+	}
+	j.once.Do(func() {
+		w := j.ws
+		w.mu.Lock()
+		w.reserved -= j.size
+		close(w.freed)
+		w.freed = make(chan struct{})
+		w.mu.Unlock()
+	})
+}
+
+// release removes the directory with all files and frees its space
+func (j *jobDir) release() {
+	if j == nil {
+		return
+	}
+	if err := os.RemoveAll(j.path); err != nil {
+		log.Printf("[DOWNLOADER] Failed to remove job dir %s: %v", j.path, err)
+	}
+	j.free()
+}
+
+// RemoveTempFiles deletes everything downloads leave in the work dir. It is
+// meant to be called when no download is running: on startup it sweeps
+// files of crashed runs, on shutdown those of interrupted downloads.
+func (w *Workspace) RemoveTempFiles() {
+	matches, err := filepath.Glob(filepath.Join(w.root, workDirPrefix+"*"))
+	if err != nil {
+		return
+	}
+	for _, path := range matches {
+		if err := os.RemoveAll(path); err != nil {
+			log.Printf("[DOWNLOADER] Failed to remove %s: %v", path, err)
+			continue
+		}
+		log.Printf("[DOWNLOADER] Removed leftover %s", path)
+	}
+}
@@ -0,0 +1,118 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/artur/solid-spoon/internal/downloader/ytdlptest"
+)
+
+func TestWorkspace_WaitsForBudget(t *testing.T) {
+	w := NewWorkspace(t.TempDir(), 100)
+
+	first, err := w.acquire(context.Background(), 60, func() { t.Error("First download must not wait") })
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+
+	waiting := make(chan struct{})
+	acquired := make(chan *jobDir)
+	go func() {
+		second, err := w.acquire(context.Background(), 60, func() { close(waiting) })
+		if err != nil {
+			t.Errorf("acquire failed: %v", err)
+		}
+		acquired <- second
+	}()
+
+	select {
+	case <-waiting:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the second download to wait for disk space")
+	}
+
+	first.release()
+	select {
+	case second := <-acquired:
+		if second.path == first.path {
+			t.Errorf("Expected separate job dirs, both got %s", second.path)
+		}
+		second.release()
+	case <-time.After(time.Second):
+		t.Fatal("Expected the second download to start after the first released its space")
+	}
+
+	if w.reserved != 0 {
+		t.Errorf("Expected all space to be returned, %d bytes still reserved", w.reserved)
+	}
+}
+
+func TestWorkspace_CancelWhileWaiting(t *testing.T) {
+	root := t.TempDir()
+	w := NewWorkspace(root, 100)
+
+	// Загрузка больше всего бюджета ждёт, пока диск не освободится целиком
+	first, err := w.acquire(context.Background(), 500, func() {})
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	defer first.release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := w.acquire(ctx, 10, func() {}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected waiting to stop on cancellation, got %v", err)
+	}
+	if w.reserved != 100 {
+		t.Errorf("Expected only the first download to hold space, got %d bytes reserved", w.reserved)
+	}
+}
+
+func TestWorkspace_RemoveTempFiles(t *testing.T) {
+	root := t.TempDir()
+	w := NewWorkspace(root, 0)
+
+	dir, err := w.acquire(context.Background(), 10, func() {})
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir.path, "yt-video.mp4"), []byte("video"), 0644)
+	// Файл старой версии бота прямо в корне и чужой файл
+	os.WriteFile(filepath.Join(root, "yt-old.mp4"), []byte("video"), 0644)
+	os.WriteFile(filepath.Join(root, "other.txt"), []byte("keep"), 0644)
+
+	w.RemoveTempFiles()
+
+	entries, _ := os.ReadDir(root)
+	if len(entries) != 1 || entries[0].Name() != "other.txt" {
+		t.Errorf("Expected only foreign files to stay, got %v", entries)
+	}
+}
+
+func TestDownloadWithQualityInfo_SeparateJobDirs(t *testing.T) {
+	d, _, tmp := newFakeDownloader(t, ytdlptest.Scenario{Info: fixtureVideo, FileSize: 1024}, Config{})
+
+	first, err := d.DownloadWithQualityInfo(context.Background(), "dQw4w9WgXcQ", QualityLow, nil)
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	second, err := d.DownloadWithQualityInfo(context.Background(), "dQw4w9WgXcQ", QualityHigh, nil)
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	if first.FilePath == second.FilePath {
+		t.Fatalf("Expected downloads of the same video not to share a file: %s", first.FilePath)
+	}
+
+	// Удаление одной загрузки не трогает файлы другой
+	first.Cleanup()
+	if _, err := os.Stat(second.FilePath); err != nil {
+		t.Errorf("Expected the second download to keep its file: %v", err)
+	}
+	second.Cleanup()
+	assertEmptyDir(t, tmp)
+}
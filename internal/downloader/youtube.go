@@ -1,12 +1,17 @@
 package downloader
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Quality string
@@ -16,11 +21,124 @@ const (
 	QualityMedium Quality = "480p"
 	QualityHigh   Quality = "720p"
 	QualityFull   Quality = "1080p"
+	// QualityAudio - только аудиодорожка без видео
+	QualityAudio Quality = "audio"
 )
 
 // maxLocalAPIServer - максимальный размер файла для Local API Server (2 ГБ)
 const maxLocalAPIServer = 2000 * 1024 * 1024
 
+// maxStandardAPI - максимальный размер файла для стандартного Bot API (50 МБ)
+const maxStandardAPI = 50 * 1024 * 1024
+
+// defaultMetadataTTL - форматы видео меняются редко, а ссылки из метаданных не используются
+const defaultMetadataTTL = 30 * time.Minute
+
+// defaultMetadataWorkers - столько же, сколько загрузок по умолчанию
+const defaultMetadataWorkers = 4
+
+// Config configures YouTubeDownloader
+type Config struct {
+	YtdlpPath string
+	// FfmpegPath - путь к ffmpeg, пустая строка отключает сжатие
+	FfmpegPath string
+	// MaxSize - бюджет размера файла, который можно отправить в Telegram
+	MaxSize int64
+	// SplitOversized - резать слишком большие видео на части вместо сжатия
+	SplitOversized bool
+	// AudioFormat - в какой формат конвертировать аудио (mp3 или m4a)
+	AudioFormat AudioFormat
+	// Sources - откуда можно скачивать, nil означает DefaultRegistry
+	Sources *Registry
+	// WorkDir - каталог для файлов загрузок, пустая строка - системный temp
+	WorkDir string
+	// DiskBudget - сколько байт могут занимать одновременные загрузки, 0 - без
+	// ограничения. Загрузка видео резервирует два MaxSize: исходник и сжатую копию.
+	DiskBudget int64
+	// MetadataTTL - сколько хранить метаданные видео из yt-dlp -j, 0 отключает кэш
+	MetadataTTL time.Duration
+	// MetadataStore - где сохранять метаданные между перезапусками, nil - только в памяти
+	MetadataStore MetadataStore
+	// MetadataWorkers - сколько запросов метаданных (yt-dlp -j, --flat-playlist)
+	// выполняется одновременно на весь бот, остальные ждут
+	MetadataWorkers int
+}
+
+// DefaultConfig returns configuration for the Local API Server limits
+func DefaultConfig() Config {
+	return Config{
+		YtdlpPath:       "yt-dlp",
+		FfmpegPath:      "ffmpeg",
+		MaxSize:         maxLocalAPIServer,
+		AudioFormat:     AudioMP3,
+		MetadataTTL:     defaultMetadataTTL,
+		MetadataWorkers: defaultMetadataWorkers,
+	}
+}
+
+// ConfigFromEnv builds configuration from environment variables. The size budget
+// depends on whether a Local API Server is used (TELEGRAM_API_ENDPOINT) and may
+// be overridden with MAX_FILE_SIZE_MB.
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig()
+
+	if os.Getenv("TELEGRAM_API_ENDPOINT") == "" {
+		cfg.MaxSize = maxStandardAPI
+	}
+
+	if value := os.Getenv("MAX_FILE_SIZE_MB"); value != "" {
+		if mb, err := strconv.ParseInt(value, 10, 64); err == nil && mb > 0 {
+			cfg.MaxSize = mb * 1024 * 1024
+		} else {
+			log.Printf("[DOWNLOADER] Invalid MAX_FILE_SIZE_MB=%q, using %d bytes", value, cfg.MaxSize)
+		}
+	}
+
+	cfg.SplitOversized = os.Getenv("SPLIT_OVERSIZED") == "true"
+
+	cfg.WorkDir = os.Getenv("WORK_DIR")
+	if value := os.Getenv("DISK_BUDGET_MB"); value != "" {
+		if mb, err := strconv.ParseInt(value, 10, 64); err == nil && mb >= 0 {
+			cfg.DiskBudget = mb * 1024 * 1024
+		} else {
+			log.Printf("[DOWNLOADER] Invalid DISK_BUDGET_MB=%q, disk usage is not limited", value)
+		}
+	}
+
+	if value := os.Getenv("METADATA_CACHE_MINUTES"); value != "" {
+		if minutes, err := strconv.Atoi(value); err == nil && minutes >= 0 {
+			cfg.MetadataTTL = time.Duration(minutes) * time.Minute
+		} else {
+			log.Printf("[DOWNLOADER] Invalid METADATA_CACHE_MINUTES=%q, caching metadata for %s", value, cfg.MetadataTTL)
+		}
+	}
+
+	if value := os.Getenv("METADATA_WORKERS"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			cfg.MetadataWorkers = n
+		} else {
+			log.Printf("[DOWNLOADER] Invalid METADATA_WORKERS=%q, using %d", value, cfg.MetadataWorkers)
+		}
+	}
+
+	switch format := AudioFormat(os.Getenv("AUDIO_FORMAT")); format {
+	case "":
+	case AudioMP3, AudioM4A:
+		cfg.AudioFormat = format
+	default:
+		log.Printf("[DOWNLOADER] Unsupported AUDIO_FORMAT=%q, using %s", format, cfg.AudioFormat)
+	}
+
+	if path, ok := os.LookupEnv("YTDLP_PATH"); ok && path != "" {
+		cfg.YtdlpPath = path
+	}
+	if path, ok := os.LookupEnv("FFMPEG_PATH"); ok {
+		cfg.FfmpegPath = path
+	}
+
+	return cfg
+}
+
 type VideoFormat struct {
 	Quality     Quality
 	QualityNum  int
@@ -38,249 +156,348 @@ type VideoInfo struct {
 	Title       string
 	Description string
 	Compressed  bool
+	// Parts - файлы частей, если видео было разрезано (FilePath в этом случае пуст)
+	Parts []string
+	// Subtitles - файл субтитров, запрошенных отдельным файлом. Не входит в Files,
+	// удалять его после отправки должен вызывающий.
+	Subtitles string
+	// Thumbnail - превью JPEG, если его запросили в DownloadOptions. Удаляет вызывающий.
+	Thumbnail string
+
+	dir *jobDir
+	// shared - общий счётчик, если файлы одной загрузки получили несколько вызывающих
+	shared *sharedFiles
+}
+
+// Files returns paths of all files that make up the video, in order
+func (v *VideoInfo) Files() []string {
+	if len(v.Parts) > 0 {
+		return v.Parts
+	}
+	return []string{v.FilePath}
+}
+
+// Cleanup removes all files of the download, including subtitles and the
+// thumbnail, and returns its disk space to the budget. Files shared by
+// identical downloads are removed by the last caller.
+func (v *VideoInfo) Cleanup() {
+	if v.shared != nil && !v.shared.release() {
+		return
+	}
+	removeFiles(v.Files())
+	removeFiles([]string{v.Subtitles, v.Thumbnail})
+	v.dir.release()
 }
 
 // ytdlpVideoInfo represents the JSON output from yt-dlp -j
 type ytdlpVideoInfo struct {
-	ID          string         `json:"id"`
-	Title       string         `json:"title"`
-	Description string         `json:"description"`
-	Duration    float64        `json:"duration"`
-	Formats     []ytdlpFormat  `json:"formats"`
+	ID          string        `json:"id"`
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	Duration    float64       `json:"duration"`
+	Uploader    string        `json:"uploader"`
+	Channel     string        `json:"channel"`
+	Artist      string        `json:"artist"`
+	Track       string        `json:"track"`
+	Formats     []ytdlpFormat `json:"formats"`
+	// Subtitles и AutomaticCaptions - дорожки субтитров по коду языка
+	Subtitles         map[string][]ytdlpSubtitle `json:"subtitles"`
+	AutomaticCaptions map[string][]ytdlpSubtitle `json:"automatic_captions"`
+	Thumbnails        []ytdlpThumbnail           `json:"thumbnails"`
+	// Width и Height - размеры выбранного формата, есть в выводе --print-json
+	Width  int `json:"width"`
+	Height int `json:"height"`
 }
 
 type ytdlpFormat struct {
-	FormatID   string  `json:"format_id"`
-	Ext        string  `json:"ext"`
-	Width      int     `json:"width"`
-	Height     int     `json:"height"`
-	Filesize   int64   `json:"filesize"`
-	FilesizeApprox int64 `json:"filesize_approx"`
-	VCodec     string  `json:"vcodec"`
-	ACodec     string  `json:"acodec"`
-	FormatNote string  `json:"format_note"`
+	FormatID       string  `json:"format_id"`
+	Ext            string  `json:"ext"`
+	Width          int     `json:"width"`
+	Height         int     `json:"height"`
+	Filesize       int64   `json:"filesize"`
+	FilesizeApprox int64   `json:"filesize_approx"`
+	VCodec         string  `json:"vcodec"`
+	ACodec         string  `json:"acodec"`
+	FormatNote     string  `json:"format_note"`
+	FPS            float64 `json:"fps"`
+	// TBR - общий битрейт в Кбит/с
+	TBR float64 `json:"tbr"`
 }
 
+// YouTubeDownloader downloads videos with yt-dlp. Despite the name it handles
+// every source of its registry: video IDs are resolved to links through it.
 type YouTubeDownloader struct {
-	ytdlpPath string
-	maxSize   int64
+	sources        *Registry
+	ytdlpPath      string
+	ffmpegPath     string
+	maxSize        int64
+	splitOversized bool
+	audioFormat    AudioFormat
+	workspace      *Workspace
+	flights        *flightGroup
+	metadata       *metadataCache
+	// lookups - семафор запросов метаданных
+	lookups chan struct{}
 }
 
 func NewYouTubeDownloader() *YouTubeDownloader {
+	return NewYouTubeDownloaderWithConfig(DefaultConfig())
+}
+
+func NewYouTubeDownloaderWithConfig(cfg Config) *YouTubeDownloader {
+	if cfg.YtdlpPath == "" {
+		cfg.YtdlpPath = "yt-dlp"
+	}
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = maxLocalAPIServer
+	}
+	if cfg.AudioFormat == "" {
+		cfg.AudioFormat = AudioMP3
+	}
+	if cfg.Sources == nil {
+		cfg.Sources = DefaultRegistry()
+	}
+	if cfg.MetadataWorkers <= 0 {
+		cfg.MetadataWorkers = defaultMetadataWorkers
+	}
 	return &YouTubeDownloader{
-		ytdlpPath: "yt-dlp",
-		maxSize:   maxLocalAPIServer,
+		sources:        cfg.Sources,
+		ytdlpPath:      cfg.YtdlpPath,
+		ffmpegPath:     cfg.FfmpegPath,
+		maxSize:        cfg.MaxSize,
+		splitOversized: cfg.SplitOversized,
+		audioFormat:    cfg.AudioFormat,
+		workspace:      NewWorkspace(cfg.WorkDir, cfg.DiskBudget),
+		flights:        newFlightGroup(),
+		metadata:       newMetadataCache(cfg.MetadataTTL, cfg.MetadataStore),
+		lookups:        make(chan struct{}, cfg.MetadataWorkers),
+	}
+}
+
+// RemoveTempFiles deletes files left in the work dir, see Workspace.RemoveTempFiles
+func (d *YouTubeDownloader) RemoveTempFiles() {
+	d.workspace.RemoveTempFiles()
+}
+
+// acquireDir waits for disk space of size bytes and creates a directory for a download
+func (d *YouTubeDownloader) acquireDir(ctx context.Context, size int64, opts *DownloadOptions) (*jobDir, error) {
+	return d.workspace.acquire(ctx, size, func() {
+		opts.report(Progress{Stage: StageWait})
+	})
+}
+
+// videoURL resolves a video ID to the link passed to yt-dlp
+func (d *YouTubeDownloader) videoURL(videoID string) (string, error) {
+	url := d.sources.URL(videoID)
+	if url == "" {
+		return "", fmt.Errorf("unknown source of video %q", videoID)
 	}
+	return url, nil
+}
+
+// fileKey turns a video ID into a part of a file name
+func fileKey(videoID string) string {
+	return strings.NewReplacer(":", "-", "/", "-").Replace(videoID)
 }
 
-func (d *YouTubeDownloader) GetAvailableFormats(videoID string) ([]VideoFormat, error) {
-	url := fmt.Sprintf("https://www.youtube.com/watch?v=%s", videoID)
+// lookup runs yt-dlp that only prints metadata and returns its output. At
+// most MetadataWorkers lookups run at once: the messages with links are
+// handled outside the download queue, and a burst of them must not start a
+// yt-dlp process each.
+func (d *YouTubeDownloader) lookup(ctx context.Context, args ...string) ([]byte, error) {
+	select {
+	case d.lookups <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-d.lookups }()
 
-	cmd := exec.Command(d.ytdlpPath, "-j", url)
-	output, err := cmd.Output()
+	output, err := d.command(ctx, d.ytdlpPath, args...).Output()
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		if exitErr, ok := err.(*exec.ExitError); ok {
-			return nil, fmt.Errorf("yt-dlp error: %s", string(exitErr.Stderr))
+			return nil, ytdlpError(string(exitErr.Stderr))
 		}
 		return nil, fmt.Errorf("failed to run yt-dlp: %w", err)
 	}
+	return output, nil
+}
 
-	var info ytdlpVideoInfo
-	if err := json.Unmarshal(output, &info); err != nil {
-		return nil, fmt.Errorf("failed to parse yt-dlp output: %w", err)
+// videoInfo fetches metadata of a video with yt-dlp -j without downloading it.
+// Recently fetched metadata is taken from the cache.
+func (d *YouTubeDownloader) videoInfo(ctx context.Context, videoID string) (*ytdlpVideoInfo, error) {
+	if info := d.metadata.get(videoID); info != nil {
+		return info, nil
 	}
 
-	qualityMap := make(map[int]VideoFormat)
-	for _, f := range info.Formats {
-		// Пропускаем не-MP4 форматы
-		if f.Ext != "mp4" {
-			continue
-		}
-
-		// Пропускаем форматы без видео
-		if f.VCodec == "none" || f.VCodec == "" {
-			continue
-		}
+	url, err := d.videoURL(videoID)
+	if err != nil {
+		return nil, err
+	}
 
-		// Пропускаем форматы без аудио (предпочитаем с аудио)
-		if f.ACodec == "none" || f.ACodec == "" {
-			continue
-		}
+	output, err := d.lookup(ctx, "-j", url)
+	if err != nil {
+		return nil, err
+	}
 
-		if f.Height == 0 {
-			continue
-		}
+	var info ytdlpVideoInfo
+	if err := json.Unmarshal(output, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse yt-dlp output: %w", err)
+	}
+	d.metadata.put(videoID, &info)
+	return &info, nil
+}
 
-		// Получаем размер файла
-		filesize := f.Filesize
-		if filesize == 0 {
-			filesize = f.FilesizeApprox
-		}
+func (d *YouTubeDownloader) GetAvailableFormats(ctx context.Context, videoID string) ([]VideoFormat, error) {
+	info, err := d.videoInfo(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
 
-		// Пропускаем файлы больше лимита
-		if filesize > d.maxSize {
-			continue
-		}
+	choices := d.chooseFormats(info.Formats)
+	if len(choices) == 0 {
+		return nil, ErrNoFormats
+	}
 
-		qualityLabel := fmt.Sprintf("%dp", f.Height)
+	result := make([]VideoFormat, 0, len(choices))
+	for height, c := range choices {
+		qualityLabel := fmt.Sprintf("%dp", height)
 
 		// Формируем описание размера
 		var sizeDesc string
-		if filesize > 0 {
-			sizeMB := filesize / (1024 * 1024)
+		if c.size > 0 {
+			sizeMB := c.size / (1024 * 1024)
 			if sizeMB > 0 {
 				sizeDesc = fmt.Sprintf(" (~%dMB)", sizeMB)
 			} else {
-				sizeKB := filesize / 1024
+				sizeKB := c.size / 1024
 				sizeDesc = fmt.Sprintf(" (~%dKB)", sizeKB)
 			}
 		}
-
-		description := fmt.Sprintf("%s%s", qualityLabel, sizeDesc)
-
-		// Сохраняем только один формат для каждого качества (предпочитаем меньший размер)
-		if existing, ok := qualityMap[f.Height]; ok {
-			if filesize > 0 && filesize < existing.Size {
-				qualityMap[f.Height] = VideoFormat{
-					Quality:     Quality(qualityLabel),
-					QualityNum:  f.Height,
-					Size:        filesize,
-					Description: description,
-					Width:       f.Width,
-					Height:      f.Height,
-				}
-			}
-		} else {
-			qualityMap[f.Height] = VideoFormat{
-				Quality:     Quality(qualityLabel),
-				QualityNum:  f.Height,
-				Size:        filesize,
-				Description: description,
-				Width:       f.Width,
-				Height:      f.Height,
-			}
+		if c.size > d.maxSize {
+			sizeDesc += " 🗜"
 		}
-	}
-
-	// Если нет форматов с аудио, попробуем форматы которые yt-dlp может объединить
-	if len(qualityMap) == 0 {
-		for _, f := range info.Formats {
-			if f.Ext != "mp4" && f.Ext != "webm" {
-				continue
-			}
-			if f.VCodec == "none" || f.VCodec == "" {
-				continue
-			}
-			if f.Height == 0 {
-				continue
-			}
-
-			filesize := f.Filesize
-			if filesize == 0 {
-				filesize = f.FilesizeApprox
-			}
-			if filesize > d.maxSize {
-				continue
-			}
 
-			qualityLabel := fmt.Sprintf("%dp", f.Height)
-			var sizeDesc string
-			if filesize > 0 {
-				sizeMB := filesize / (1024 * 1024)
-				if sizeMB > 0 {
-					sizeDesc = fmt.Sprintf(" (~%dMB)", sizeMB)
-				}
-			}
-
-			if _, ok := qualityMap[f.Height]; !ok {
-				qualityMap[f.Height] = VideoFormat{
-					Quality:     Quality(qualityLabel),
-					QualityNum:  f.Height,
-					Size:        filesize,
-					Description: fmt.Sprintf("%s%s", qualityLabel, sizeDesc),
-					Width:       f.Width,
-					Height:      f.Height,
-				}
-			}
-		}
-	}
-
-	if len(qualityMap) == 0 {
-		return nil, fmt.Errorf("no suitable formats found")
-	}
-
-	result := make([]VideoFormat, 0, len(qualityMap))
-	for _, vf := range qualityMap {
-		result = append(result, vf)
+		result = append(result, VideoFormat{
+			Quality:     Quality(qualityLabel),
+			QualityNum:  height,
+			Size:        c.size,
+			Description: qualityLabel + sizeDesc,
+			Width:       c.video.Width,
+			Height:      height,
+		})
 	}
 
 	sort.Slice(result, func(i, j int) bool {
 		return result[i].QualityNum < result[j].QualityNum
 	})
 
+	// Аудио всегда идёт последним вариантом
+	if audio, ok := bestAudioFormat(info.Formats); ok {
+		result = append(result, audio)
+	}
+
 	return result, nil
 }
 
-func (d *YouTubeDownloader) Download(videoID string) (string, error) {
-	return d.DownloadWithQuality(videoID, "")
+// Download downloads the video in the best quality as a single file. The
+// caller removes it with cleanup, which also frees its work dir and budget.
+func (d *YouTubeDownloader) Download(ctx context.Context, videoID string) (string, func(), error) {
+	info, err := d.download(ctx, videoID, "", nil)
+	if err != nil {
+		return "", nil, err
+	}
+	// Части одним путём не вернуть - такие видео скачиваются через DownloadWithQualityInfo
+	if len(info.Parts) > 0 {
+		info.Cleanup()
+		return "", nil, ErrSplit
+	}
+	return info.FilePath, info.Cleanup, nil
 }
 
-func (d *YouTubeDownloader) DownloadWithQuality(videoID string, quality Quality) (string, error) {
-	info, err := d.DownloadWithQualityInfo(videoID, quality)
+// DownloadWithQualityInfo downloads the video. Identical downloads running at
+// the same time share one yt-dlp run and its files, see VideoInfo.Cleanup.
+func (d *YouTubeDownloader) DownloadWithQualityInfo(ctx context.Context, videoID string, quality Quality, opts *DownloadOptions) (*VideoInfo, error) {
+	key := flightKey(videoID, quality, opts)
+	return d.flights.do(ctx, key, opts, func(ctx context.Context, opts *DownloadOptions) (*VideoInfo, error) {
+		return d.download(ctx, videoID, quality, opts)
+	})
+}
+
+// download runs yt-dlp and post-processing for one caller
+func (d *YouTubeDownloader) download(ctx context.Context, videoID string, quality Quality, opts *DownloadOptions) (*VideoInfo, error) {
+	url, err := d.videoURL(videoID)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return info.FilePath, nil
-}
 
-func (d *YouTubeDownloader) DownloadWithQualityInfo(videoID string, quality Quality) (*VideoInfo, error) {
-	url := fmt.Sprintf("https://www.youtube.com/watch?v=%s", videoID)
+	clip := opts.clip()
+	if clip != nil && !d.hasFFmpeg() {
+		return nil, ErrClipUnsupported
+	}
+	subs := opts.subtitles()
+	if subs != nil && subs.Mode == SubtitlesBurn && !d.hasFFmpeg() {
+		return nil, ErrSubtitlesUnsupported
+	}
 
-	// Создаём временный файл
-	tmpDir := os.TempDir()
-	outputPath := filepath.Join(tmpDir, fmt.Sprintf("yt-%s.mp4", videoID))
+	// Каждая загрузка пишет в свой каталог: параллельные загрузки того же видео
+	// не затирают файлы друг друга. Место нужно под исходник и сжатую копию.
+	dir, err := d.acquireDir(ctx, 2*d.maxSize, opts)
+	if err != nil {
+		return nil, err
+	}
+	delivered := false
+	defer func() {
+		if !delivered {
+			dir.release()
+		}
+	}()
+	// Расширение зависит от кодеков, yt-dlp подставляет его сам
+	base := filepath.Join(dir.path, fmt.Sprintf("yt-%s%s", fileKey(videoID), clipSuffix(clip)))
 
-	// Формируем аргументы yt-dlp
-	// Используем только форматы с уже объединённым аудио (без ffmpeg)
 	args := []string{
 		"--no-playlist",
-		"-o", outputPath,
+		"-o", base + ".%(ext)s",
 	}
-
-	// Добавляем фильтр по качеству - только форматы с видео И аудио (без merge)
-	if quality != "" {
-		height := parseQualityNum(string(quality))
-		if height > 0 {
-			// Выбираем лучший формат с указанным качеством, где есть и видео и аудио
-			formatSpec := fmt.Sprintf("best[height<=%d][ext=mp4][acodec!=none][vcodec!=none]/best[height<=%d][acodec!=none][vcodec!=none]/best[ext=mp4][acodec!=none][vcodec!=none]", height, height)
-			args = append(args, "-f", formatSpec)
-		}
-	} else {
-		// Без указания качества - берём наименьший размер с аудио и видео
-		args = append(args, "-f", "worst[ext=mp4][acodec!=none][vcodec!=none]/worst[acodec!=none][vcodec!=none]")
+	args = append(args, d.formatArgs(videoID, quality)...)
+	if d.hasFFmpeg() {
+		args = append(args, d.ffmpegLocationArgs()...)
 	}
+	args = append(args, d.clipArgs(clip)...)
+	args = append(args, d.subtitleArgs(subs)...)
 
-	// Добавляем вывод JSON для получения метаданных
+	// Добавляем вывод прогресса и JSON для получения метаданных
+	args = append(args, progressArgs()...)
 	args = append(args, "--print-json", url)
 
-	cmd := exec.Command(d.ytdlpPath, args...)
-	output, err := cmd.Output()
+	// Частично скачанные файлы (.part, .ytdl, -Frag*) удаляются вместе с каталогом
+	output, err := d.runYtdlp(ctx, args, opts)
 	if err != nil {
-		// Удаляем частично скачанный файл
-		os.Remove(outputPath)
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return nil, fmt.Errorf("yt-dlp download error: %s", string(exitErr.Stderr))
-		}
-		return nil, fmt.Errorf("failed to download video: %w", err)
+		return nil, err
+	}
+	outputPath := findVideo(base)
+	if outputPath == "" {
+		return nil, fmt.Errorf("download failed: file not found")
 	}
 
-	// Парсим JSON вывод для получения метаданных
+	// Парсим JSON вывод для получения метаданных, без них файл всё равно отправим
 	var info ytdlpVideoInfo
-	if err := json.Unmarshal(output, &info); err != nil {
-		// Если не удалось распарсить, проверяем что файл скачался
-		if _, statErr := os.Stat(outputPath); statErr != nil {
-			return nil, fmt.Errorf("download failed: file not found")
-		}
+	json.Unmarshal(output, &info)
+
+	// Длительность фрагмента нужна для расчёта битрейта при сжатии и нарезке
+	duration := clipDuration(clip, info.Duration)
+
+	// Субтитры вшиваются до проверки размера: перекодирование меняет размер файла
+	subtitlesPath, err := d.applySubtitles(ctx, outputPath, subs, opts)
+	if err != nil {
+		return nil, err
+	}
+	// Превью делаем до нарезки, пока видео одним файлом
+	thumbnailPath := ""
+	if opts.thumbnail() {
+		thumbnailPath = d.thumbnail(ctx, outputPath, duration, &info)
 	}
 
 	// Проверяем размер файла
@@ -289,33 +506,107 @@ func (d *YouTubeDownloader) DownloadWithQualityInfo(videoID string, quality Qual
 		return nil, fmt.Errorf("failed to stat downloaded file: %w", err)
 	}
 
+	compressed := false
+	var parts []string
 	if fileInfo.Size() > d.maxSize {
-		os.Remove(outputPath)
-		sizeMB := float64(fileInfo.Size()) / (1024 * 1024)
-		maxMB := float64(d.maxSize) / (1024 * 1024)
-		return nil, fmt.Errorf("видео слишком большое (%.1f МБ), максимум %.0f МБ", sizeMB, maxMB)
-	}
-
-	// Получаем размеры видео из формата (если доступны)
-	width, height := 0, 0
-	for _, f := range info.Formats {
-		if f.Width > width {
-			width = f.Width
-			height = f.Height
+		if !d.hasFFmpeg() {
+			return nil, &TooLargeError{Size: fileInfo.Size(), Limit: d.maxSize}
+		}
+
+		if d.splitOversized {
+			opts.report(Progress{Stage: StageSplit})
+			log.Printf("[DOWNLOADER] File is %.1f MB, splitting into parts of %.0f MB", megabytes(fileInfo.Size()), megabytes(d.maxSize))
+			parts, err = d.split(ctx, outputPath, duration, fileInfo.Size(), d.maxSize)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				return nil, &TooLargeError{Size: fileInfo.Size(), Limit: d.maxSize, Err: fmt.Errorf("split failed: %w", err)}
+			}
+			os.Remove(outputPath)
+			outputPath = ""
+		} else {
+			opts.report(Progress{Stage: StageCompress})
+			log.Printf("[DOWNLOADER] File is %.1f MB, compressing to fit %.0f MB", megabytes(fileInfo.Size()), megabytes(d.maxSize))
+			if err := d.compress(ctx, outputPath, duration, d.maxSize); err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				return nil, &TooLargeError{Size: fileInfo.Size(), Limit: d.maxSize, Err: fmt.Errorf("compression failed: %w", err)}
+			}
+			compressed = true
+		}
+	}
+
+	// Получаем размеры скачанного формата, для старых версий yt-dlp - наибольшего из доступных
+	width, height := info.Width, info.Height
+	if width == 0 {
+		for _, f := range info.Formats {
+			if f.Width > width {
+				width = f.Width
+				height = f.Height
+			}
 		}
 	}
 
+	delivered = true
 	return &VideoInfo{
 		FilePath:    outputPath,
 		Width:       width,
 		Height:      height,
-		Duration:    int(info.Duration),
+		Duration:    int(duration),
 		Title:       info.Title,
 		Description: info.Description,
-		Compressed:  false,
+		Compressed:  compressed,
+		Parts:       parts,
+		Subtitles:   subtitlesPath,
+		Thumbnail:   thumbnailPath,
+		dir:         dir,
 	}, nil
 }
 
+// formatArgs selects the format of the quality. While the metadata is cached
+// exactly the format shown on the keyboard is downloaded, filters remain the
+// fallback. With ffmpeg video-only formats are merged with the best audio,
+// H.264 is preferred as the codec every Telegram client plays.
+func (d *YouTubeDownloader) formatArgs(videoID string, quality Quality) []string {
+	// Без указания качества - берём наименьший размер с аудио и видео
+	progressive := "worst[ext=mp4][acodec!=none][vcodec!=none]/worst[acodec!=none][vcodec!=none]"
+	height := 0
+	if quality != "" {
+		height = parseQualityNum(string(quality))
+	}
+	if height > 0 {
+		// Лучший формат с указанным качеством, где есть и видео и аудио
+		progressive = fmt.Sprintf("best[height<=%d][ext=mp4][acodec!=none][vcodec!=none]/best[height<=%d][acodec!=none][vcodec!=none]/best[ext=mp4][acodec!=none][vcodec!=none]", height, height)
+	}
+	if height == 0 {
+		return []string{"-f", progressive}
+	}
+
+	spec := progressive
+	var args []string
+	if d.hasFFmpeg() {
+		var merged []string
+		for _, codec := range []string{"avc1", "vp9", "vp09", "av01"} {
+			merged = append(merged, fmt.Sprintf("bv[height<=%d][vcodec^=%s]+ba[acodec^=mp4a]/bv[height<=%d][vcodec^=%s]+ba", height, codec, height, codec))
+		}
+		spec = strings.Join(merged, "/") + "/" + progressive
+		// Контейнер выбирает yt-dlp: MP4, если кодеки в него помещаются
+		args = []string{"--merge-output-format", containerMP4 + "/" + containerMKV}
+	}
+
+	if info := d.metadata.get(videoID); info != nil {
+		if c, ok := d.chooseFormats(info.Formats)[height]; ok {
+			spec = c.formatID() + "/" + spec
+			if c.audio != nil {
+				args = []string{"--merge-output-format", c.container()}
+			}
+		}
+	}
+	return append([]string{"-f", spec}, args...)
+}
+
 func parseQualityNum(quality string) int {
 	var num int
 	fmt.Sscanf(quality, "%dp", &num)
@@ -319,3 +319,68 @@ func intToString(n int64) string {
 	}
 	return result
 }
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Run("standard API limits", func(t *testing.T) {
+		t.Setenv("TELEGRAM_API_ENDPOINT", "")
+		t.Setenv("MAX_FILE_SIZE_MB", "")
+
+		cfg := ConfigFromEnv()
+		if cfg.MaxSize != maxStandardAPI {
+			t.Errorf("expected MaxSize %d, got %d", int64(maxStandardAPI), cfg.MaxSize)
+		}
+	})
+
+	t.Run("local API server limits", func(t *testing.T) {
+		t.Setenv("TELEGRAM_API_ENDPOINT", "http://telegram-bot-api:8081/bot%s/%s")
+		t.Setenv("MAX_FILE_SIZE_MB", "")
+
+		cfg := ConfigFromEnv()
+		if cfg.MaxSize != maxLocalAPIServer {
+			t.Errorf("expected MaxSize %d, got %d", int64(maxLocalAPIServer), cfg.MaxSize)
+		}
+	})
+
+	t.Run("explicit override", func(t *testing.T) {
+		t.Setenv("TELEGRAM_API_ENDPOINT", "")
+		t.Setenv("MAX_FILE_SIZE_MB", "100")
+		t.Setenv("FFMPEG_PATH", "")
+
+		cfg := ConfigFromEnv()
+		if cfg.MaxSize != 100*1024*1024 {
+			t.Errorf("expected MaxSize 100MB, got %d", cfg.MaxSize)
+		}
+		if cfg.FfmpegPath != "" {
+			t.Errorf("expected empty FfmpegPath to disable compression, got %q", cfg.FfmpegPath)
+		}
+	})
+
+	t.Run("metadata cache", func(t *testing.T) {
+		t.Setenv("METADATA_CACHE_MINUTES", "")
+		if cfg := ConfigFromEnv(); cfg.MetadataTTL != defaultMetadataTTL {
+			t.Errorf("expected default MetadataTTL %s, got %s", defaultMetadataTTL, cfg.MetadataTTL)
+		}
+
+		t.Setenv("METADATA_CACHE_MINUTES", "0")
+		if cfg := ConfigFromEnv(); cfg.MetadataTTL != 0 {
+			t.Errorf("expected 0 to disable the cache, got %s", cfg.MetadataTTL)
+		}
+	})
+
+	t.Run("metadata workers", func(t *testing.T) {
+		t.Setenv("METADATA_WORKERS", "")
+		if cfg := ConfigFromEnv(); cfg.MetadataWorkers != defaultMetadataWorkers {
+			t.Errorf("expected default MetadataWorkers %d, got %d", defaultMetadataWorkers, cfg.MetadataWorkers)
+		}
+
+		t.Setenv("METADATA_WORKERS", "2")
+		if cfg := ConfigFromEnv(); cfg.MetadataWorkers != 2 {
+			t.Errorf("expected MetadataWorkers 2, got %d", cfg.MetadataWorkers)
+		}
+
+		t.Setenv("METADATA_WORKERS", "0")
+		if cfg := ConfigFromEnv(); cfg.MetadataWorkers != defaultMetadataWorkers {
+			t.Errorf("expected invalid value to be ignored, got %d", cfg.MetadataWorkers)
+		}
+	})
+}
@@ -0,0 +1,308 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/artur/solid-spoon/internal/downloader/ytdlptest"
+)
+
+func TestMain(m *testing.M) {
+	ytdlptest.Main()
+	os.Exit(m.Run())
+}
+
+const fixtureVideo = "testdata/video.json"
+
+// newFakeDownloader points a downloader at the fake yt-dlp and isolates the
+// temp dir downloads go to
+func newFakeDownloader(t *testing.T, sc ytdlptest.Scenario, cfg Config) (*YouTubeDownloader, *ytdlptest.Fake, string) {
+	t.Helper()
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	fake := ytdlptest.Install(t, sc)
+	cfg.YtdlpPath = fake.Path
+	return NewYouTubeDownloaderWithConfig(cfg), fake, tmp
+}
+
+// assertJobFile fails unless path is a file with the given name in a job
+// directory of its own under tmp
+func assertJobFile(t *testing.T, tmp, path, name string) {
+	t.Helper()
+	dir := filepath.Dir(path)
+	if filepath.Base(path) != name || filepath.Dir(dir) != tmp || !strings.HasPrefix(filepath.Base(dir), workDirPrefix) {
+		t.Errorf("Expected %s in a job dir under %s, got %q", name, tmp, path)
+	}
+}
+
+// assertEmptyDir fails if downloads left any files behind
+func assertEmptyDir(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read dir: %v", err)
+	}
+	for _, e := range entries {
+		t.Errorf("Unexpected file left behind: %s", e.Name())
+	}
+}
+
+func TestGetAvailableFormats_Fake(t *testing.T) {
+	d, fake, _ := newFakeDownloader(t, ytdlptest.Scenario{Info: fixtureVideo}, Config{})
+
+	formats, err := d.GetAvailableFormats(context.Background(), "dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatalf("GetAvailableFormats failed: %v", err)
+	}
+
+	var got []string
+	for _, f := range formats {
+		got = append(got, f.Description)
+	}
+	// 1080p есть только без звука, а без ffmpeg склеить его не с чем
+	want := []string{"360p (~10MB)", "720p (~40MB)", "🎵 Аудио (~3MB)"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Formats = %v, want %v", got, want)
+	}
+
+	args := fake.LastCall(t)
+	if len(args) != 2 || args[0] != "-j" || args[1] != "https://www.youtube.com/watch?v=dQw4w9WgXcQ" {
+		t.Errorf("Unexpected yt-dlp arguments: %v", args)
+	}
+}
+
+func TestGetAvailableFormats_SkipsOversized(t *testing.T) {
+	d, _, _ := newFakeDownloader(t, ytdlptest.Scenario{Info: fixtureVideo}, Config{MaxSize: 20 * 1024 * 1024})
+
+	formats, err := d.GetAvailableFormats(context.Background(), "dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatalf("GetAvailableFormats failed: %v", err)
+	}
+	if len(formats) != 2 || formats[0].Quality != QualityLow || formats[1].Quality != QualityAudio {
+		t.Errorf("Expected only 360p and audio without ffmpeg, got %+v", formats)
+	}
+}
+
+func TestGetAvailableFormats_BurstIsLimited(t *testing.T) {
+	const workers = 2
+	d, fake, _ := newFakeDownloader(t, ytdlptest.Scenario{Info: fixtureVideo, Sleep: 200 * time.Millisecond}, Config{MetadataWorkers: workers})
+
+	// Ссылки от разных пользователей приходят одновременно, кэш их не спасает
+	var wg sync.WaitGroup
+	for i := range 3 * workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := d.GetAvailableFormats(context.Background(), fmt.Sprintf("video%06d", i)); err != nil {
+				t.Errorf("GetAvailableFormats failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls := fake.Calls(t); len(calls) != 3*workers {
+		t.Errorf("Expected %d yt-dlp runs, got %d", 3*workers, len(calls))
+	}
+	if peak := fake.MaxConcurrent(t); peak > workers || peak == 0 {
+		t.Errorf("Expected at most %d yt-dlp processes at once, got %d", workers, peak)
+	}
+}
+
+func TestGetAvailableFormats_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		scenario ytdlptest.Scenario
+		kind     error
+		want     string
+	}{
+		{
+			name:     "unavailable",
+			scenario: ytdlptest.Scenario{ExitCode: 1, Stderr: "ERROR: [youtube] dQw4w9WgXcQ: Video unavailable"},
+			kind:     ErrUnavailable,
+			want:     "Video unavailable",
+		},
+		{
+			name:     "private",
+			scenario: ytdlptest.Scenario{ExitCode: 1, Stderr: "ERROR: [youtube] dQw4w9WgXcQ: Private video. Sign in if you've been granted access to this video"},
+			kind:     ErrPrivate,
+			want:     "Private video",
+		},
+		{
+			name:     "unknown failure",
+			scenario: ytdlptest.Scenario{ExitCode: 2, Stderr: "ERROR: something odd"},
+			want:     "something odd",
+		},
+		{
+			name:     "invalid output",
+			scenario: ytdlptest.Scenario{},
+			want:     "failed to parse yt-dlp output",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _, _ := newFakeDownloader(t, tt.scenario, Config{})
+
+			_, err := d.GetAvailableFormats(context.Background(), "dQw4w9WgXcQ")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+			if tt.kind != nil && !errors.Is(err, tt.kind) {
+				t.Errorf("Expected %v, got %v", tt.kind, err)
+			}
+		})
+	}
+}
+
+func TestDownloadWithQualityInfo_Fake(t *testing.T) {
+	d, fake, tmp := newFakeDownloader(t, ytdlptest.Scenario{Info: fixtureVideo, FileSize: 4096}, Config{})
+
+	var reports []Progress
+	opts := &DownloadOptions{OnProgress: func(p Progress) { reports = append(reports, p) }}
+
+	info, err := d.DownloadWithQualityInfo(context.Background(), "dQw4w9WgXcQ", QualityHigh, opts)
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	defer info.Cleanup()
+
+	assertJobFile(t, tmp, info.FilePath, "yt-dQw4w9WgXcQ.mp4")
+	if stat, err := os.Stat(info.FilePath); err != nil || stat.Size() != 4096 {
+		t.Errorf("Expected downloaded file of 4096 bytes: %v", err)
+	}
+	if info.Title != "Test Video" || info.Duration != 212 || info.Width != 1280 || info.Height != 720 || info.Compressed {
+		t.Errorf("Unexpected metadata: %+v", info)
+	}
+
+	args := fake.LastCall(t)
+	if format := ytdlptest.Arg(args, "-f"); !strings.HasPrefix(format, "best[height<=720][ext=mp4]") {
+		t.Errorf("Expected format selection capped at 720p, got %q", format)
+	}
+	if !strings.Contains(strings.Join(args, " "), "--no-playlist") {
+		t.Errorf("Expected --no-playlist in %v", args)
+	}
+
+	// Промежуточный прогресс может быть пропущен, последний доходит всегда
+	if len(reports) == 0 || reports[len(reports)-1].Percent != 100 {
+		t.Errorf("Expected progress up to 100%%, got %+v", reports)
+	}
+}
+
+func TestDownload_CleanupRemovesJobDir(t *testing.T) {
+	d, _, tmp := newFakeDownloader(t, ytdlptest.Scenario{Info: fixtureVideo, FileSize: 4096}, Config{})
+
+	path, cleanup, err := d.Download(context.Background(), "dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	assertJobFile(t, tmp, path, "yt-dQw4w9WgXcQ.mp4")
+
+	cleanup()
+	assertEmptyDir(t, tmp)
+}
+
+func TestDownloadWithQualityInfo_RejectsOversized(t *testing.T) {
+	d, _, tmp := newFakeDownloader(t, ytdlptest.Scenario{Info: fixtureVideo, FileSize: 4096}, Config{MaxSize: 1024})
+
+	_, err := d.DownloadWithQualityInfo(context.Background(), "dQw4w9WgXcQ", QualityHigh, nil)
+	var tooLarge *TooLargeError
+	if !errors.As(err, &tooLarge) || !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Expected oversize error, got %v", err)
+	}
+	if tooLarge.Size != 4096 || tooLarge.Limit != 1024 {
+		t.Errorf("Unexpected sizes in error: %+v", tooLarge)
+	}
+	assertEmptyDir(t, tmp)
+}
+
+func TestDownloadWithQualityInfo_FailureRemovesPartialFiles(t *testing.T) {
+	d, _, tmp := newFakeDownloader(t, ytdlptest.Scenario{
+		FileSize: 4096,
+		Partial:  true,
+		ExitCode: 1,
+		Stderr:   "ERROR: unable to download video data: HTTP Error 403: Forbidden",
+	}, Config{})
+
+	_, err := d.DownloadWithQualityInfo(context.Background(), "dQw4w9WgXcQ", QualityHigh, nil)
+	var ytErr *Error
+	if !errors.As(err, &ytErr) || !strings.Contains(ytErr.Stderr, "HTTP Error 403") {
+		t.Fatalf("Expected error with yt-dlp stderr, got %v", err)
+	}
+	assertEmptyDir(t, tmp)
+}
+
+func TestDownloadWithQualityInfo_Timeout(t *testing.T) {
+	d, _, tmp := newFakeDownloader(t, ytdlptest.Scenario{
+		Info:     fixtureVideo,
+		FileSize: 4096,
+		Partial:  true,
+		Sleep:    time.Minute,
+	}, Config{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := d.DownloadWithQualityInfo(ctx, "dQw4w9WgXcQ", QualityHigh, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Download was not stopped on timeout, took %v", elapsed)
+	}
+	assertEmptyDir(t, tmp)
+}
+
+func TestDownloadAudio_Fake(t *testing.T) {
+	// Для аудио нужен только существующий ffmpeg, сама конвертация на стороне yt-dlp
+	ffmpeg, err := filepath.Abs(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, fake, tmp := newFakeDownloader(t, ytdlptest.Scenario{Info: fixtureVideo, FileSize: 2048}, Config{
+		FfmpegPath:  ffmpeg,
+		AudioFormat: AudioM4A,
+	})
+
+	info, err := d.DownloadAudio(context.Background(), "dQw4w9WgXcQ", nil)
+	if err != nil {
+		t.Fatalf("DownloadAudio failed: %v", err)
+	}
+	defer info.Cleanup()
+
+	assertJobFile(t, tmp, info.FilePath, "yt-dQw4w9WgXcQ-audio.m4a")
+	if info.Title != "Test Video" || info.Performer != "Test Channel" || info.Duration != 212 {
+		t.Errorf("Unexpected metadata: %+v", info)
+	}
+	if got := ytdlptest.Arg(fake.LastCall(t), "--ffmpeg-location"); got != ffmpeg {
+		t.Errorf("Expected ffmpeg location %q, got %q", ffmpeg, got)
+	}
+}
+
+func TestDownloadWithQualityInfo_OtherSource(t *testing.T) {
+	d, fake, tmp := newFakeDownloader(t, ytdlptest.Scenario{Info: fixtureVideo, FileSize: 1024}, Config{})
+
+	info, err := d.DownloadWithQualityInfo(context.Background(), "vimeo:76979871", QualityHigh, nil)
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	defer info.Cleanup()
+
+	assertJobFile(t, tmp, info.FilePath, "yt-vimeo-76979871.mp4")
+	args := fake.LastCall(t)
+	if url := args[len(args)-1]; url != "https://vimeo.com/76979871" {
+		t.Errorf("Expected Vimeo link to be passed to yt-dlp, got %q", url)
+	}
+
+	if _, err := d.DownloadWithQualityInfo(context.Background(), "dailymotion:x7tgad0", QualityHigh, nil); err == nil {
+		t.Error("Expected error for a video of unknown source")
+	}
+}
@@ -0,0 +1,384 @@
+// Package ytdlptest provides a fake yt-dlp for deterministic downloader tests.
+//
+// The fake is the test binary itself: TestMain calls Main, and when the
+// binary is started by the downloader with the scenario variable set it
+// behaves like yt-dlp instead of running tests. Pointed to as ffmpeg, it
+// copies the -i input to the output file.
+//
+//	func TestMain(m *testing.M) {
+//		ytdlptest.Main()
+//		os.Exit(m.Run())
+//	}
+package ytdlptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ScenarioEnv names the variable with the path of the scenario file
+const ScenarioEnv = "YTDLPTEST_SCENARIO"
+
+// Scenario describes how the fake behaves on the next runs
+type Scenario struct {
+	// Info - путь к JSON-фикстуре, которую yt-dlp печатает для -j, -J и --print-json
+	Info string
+	// FileSize - размер файла, который "скачивается" по пути из -o
+	FileSize int64
+	// Stderr печатается в stderr перед выходом
+	Stderr string
+	// ExitCode - код выхода, ненулевой означает ошибку загрузки
+	ExitCode int
+	// Sleep - пауза перед выходом, чтобы проверить таймауты и отмену
+	Sleep time.Duration
+	// Hold - не выходить, пока тест не вызовет Release
+	Hold bool
+	// Partial оставляет недокачанный .part файл
+	Partial bool
+	// NoSubtitles - не создавать файл субтитров, как будто языка у видео нет
+	NoSubtitles bool
+
+	// Log - файл, куда записываются аргументы каждого запуска
+	Log string
+	// Running - каталог, где живут метки выполняющихся запусков
+	Running string
+	// Peaks - файл, куда каждый запуск пишет, сколько запусков шло вместе с ним
+	Peaks string
+	// Gate - файл, появления которого ждёт запуск с Hold
+	Gate string
+}
+
+// Fake is an installed fake yt-dlp
+type Fake struct {
+	// Path - что передать в Config.YtdlpPath
+	Path string
+
+	scenario string
+	log      string
+	running  string
+	peaks    string
+	gate     string
+}
+
+// Install makes the test binary act as yt-dlp with the given scenario for the
+// rest of the test and returns the fake to point the downloader at
+func Install(t testing.TB, sc Scenario) *Fake {
+	t.Helper()
+
+	dir := t.TempDir()
+	f := &Fake{
+		Path:     os.Args[0],
+		scenario: filepath.Join(dir, "scenario.json"),
+		log:      filepath.Join(dir, "calls.log"),
+		running:  filepath.Join(dir, "running"),
+		peaks:    filepath.Join(dir, "peaks.log"),
+		gate:     filepath.Join(dir, "gate"),
+	}
+	if err := os.Mkdir(f.running, 0755); err != nil {
+		t.Fatalf("Failed to create running dir: %v", err)
+	}
+	if !filepath.IsAbs(f.Path) {
+		abs, err := filepath.Abs(f.Path)
+		if err != nil {
+			t.Fatalf("Failed to resolve test binary path: %v", err)
+		}
+		f.Path = abs
+	}
+
+	f.Set(t, sc)
+	t.Setenv(ScenarioEnv, f.scenario)
+	// Запуски с Hold не должны пережить тест, который упал до Release
+	t.Cleanup(func() { os.WriteFile(f.gate, nil, 0644) })
+	return f
+}
+
+// Set replaces the scenario of an installed fake
+func (f *Fake) Set(t testing.TB, sc Scenario) {
+	t.Helper()
+
+	if sc.Info != "" {
+		abs, err := filepath.Abs(sc.Info)
+		if err != nil {
+			t.Fatalf("Failed to resolve fixture path: %v", err)
+		}
+		sc.Info = abs
+	}
+	sc.Log = f.log
+	sc.Running = f.running
+	sc.Peaks = f.peaks
+	if sc.Hold {
+		sc.Gate = f.gate
+	}
+
+	data, err := json.Marshal(sc)
+	if err != nil {
+		t.Fatalf("Failed to encode scenario: %v", err)
+	}
+	if err := os.WriteFile(f.scenario, data, 0644); err != nil {
+		t.Fatalf("Failed to write scenario: %v", err)
+	}
+}
+
+// Calls returns arguments of every run of the fake so far
+func (f *Fake) Calls(t testing.TB) [][]string {
+	t.Helper()
+
+	data, err := os.ReadFile(f.log)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatalf("Failed to read calls log: %v", err)
+	}
+
+	var calls [][]string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var args []string
+		if err := json.Unmarshal([]byte(line), &args); err != nil {
+			t.Fatalf("Failed to parse calls log: %v", err)
+		}
+		calls = append(calls, args)
+	}
+	return calls
+}
+
+// LastCall returns arguments of the last run, nil if the fake never ran
+func (f *Fake) LastCall(t testing.TB) []string {
+	t.Helper()
+	calls := f.Calls(t)
+	if len(calls) == 0 {
+		return nil
+	}
+	return calls[len(calls)-1]
+}
+
+// Release lets runs of a scenario with Hold finish, the ones already waiting
+// and all later ones
+func (f *Fake) Release(t testing.TB) {
+	t.Helper()
+	if err := os.WriteFile(f.gate, nil, 0644); err != nil {
+		t.Fatalf("Failed to open the gate: %v", err)
+	}
+}
+
+// MaxConcurrent returns the largest number of runs of the fake that were in
+// progress at the same time
+func (f *Fake) MaxConcurrent(t testing.TB) int {
+	t.Helper()
+
+	data, err := os.ReadFile(f.peaks)
+	if os.IsNotExist(err) {
+		return 0
+	}
+	if err != nil {
+		t.Fatalf("Failed to read peaks log: %v", err)
+	}
+
+	peak := 0
+	for _, line := range strings.Fields(string(data)) {
+		n, err := strconv.Atoi(line)
+		if err != nil {
+			t.Fatalf("Failed to parse peaks log: %v", err)
+		}
+		peak = max(peak, n)
+	}
+	return peak
+}
+
+// Arg returns the value following flag in args, "" if there is none
+func Arg(args []string, flag string) string {
+	for i, arg := range args {
+		if arg == flag && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// Main runs the fake and exits if the binary was started as yt-dlp,
+// otherwise it returns immediately
+func Main() {
+	path := os.Getenv(ScenarioEnv)
+	if path == "" {
+		return
+	}
+	os.Exit(run(path, os.Args[1:]))
+}
+
+func run(scenarioPath string, args []string) int {
+	data, err := os.ReadFile(scenarioPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ytdlptest: %v\n", err)
+		return 2
+	}
+	var sc Scenario
+	if err := json.Unmarshal(data, &sc); err != nil {
+		fmt.Fprintf(os.Stderr, "ytdlptest: %v\n", err)
+		return 2
+	}
+
+	logCall(sc.Log, args)
+	defer markRunning(sc.Running, sc.Peaks)()
+
+	if len(args) > 0 && args[0] == "-y" && Arg(args, "-i") != "" {
+		return runFFmpeg(args)
+	}
+
+	info, err := loadInfo(sc.Info)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ytdlptest: %v\n", err)
+		return 2
+	}
+
+	output := outputPath(args)
+	if output != "" && sc.Partial {
+		os.WriteFile(output+".part", make([]byte, sc.FileSize/2+1), 0644)
+	}
+
+	// Успешный запуск сначала "скачивает" файл, а потом печатает метаданные
+	if sc.ExitCode == 0 && output != "" && sc.FileSize > 0 {
+		if hasFlag(args, "--progress-template") {
+			fmt.Printf("[progress] %d %d NA NA NA\n", sc.FileSize/2, sc.FileSize)
+			fmt.Printf("[progress] %d %d NA NA NA\n", sc.FileSize, sc.FileSize)
+		}
+		if err := os.WriteFile(output, make([]byte, sc.FileSize), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "ytdlptest: %v\n", err)
+			return 2
+		}
+		if (hasFlag(args, "--write-subs") || hasFlag(args, "--write-auto-subs")) && !sc.NoSubtitles {
+			writeSubtitles(output, args)
+		}
+	}
+
+	time.Sleep(sc.Sleep)
+	waitGate(sc.Gate)
+
+	if sc.ExitCode == 0 && info != nil && (hasFlag(args, "-j") || hasFlag(args, "-J") || hasFlag(args, "--print-json")) {
+		os.Stdout.Write(info)
+		os.Stdout.Write([]byte("\n"))
+	}
+	if sc.Stderr != "" {
+		fmt.Fprintln(os.Stderr, sc.Stderr)
+	}
+	return sc.ExitCode
+}
+
+// writeSubtitles creates <name>.<lang>.<ext> next to the video as yt-dlp does
+func writeSubtitles(output string, args []string) {
+	ext := Arg(args, "--convert-subs")
+	if ext == "" {
+		ext = "vtt"
+	}
+	path := strings.TrimSuffix(output, filepath.Ext(output)) + "." + Arg(args, "--sub-langs") + "." + ext
+	os.WriteFile(path, []byte("1\n00:00:00,000 --> 00:00:01,000\nHello\n"), 0644)
+}
+
+// runFFmpeg copies the input to the output, the last argument
+func runFFmpeg(args []string) int {
+	data, err := os.ReadFile(Arg(args, "-i"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ytdlptest: %v\n", err)
+		return 1
+	}
+	if err := os.WriteFile(args[len(args)-1], data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "ytdlptest: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// loadInfo reads the fixture and compacts it into one line as yt-dlp prints it
+func loadInfo(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", path, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// outputPath returns the file the run downloads to. The %(ext)s template is
+// replaced with the requested audio format or the first merge container.
+func outputPath(args []string) string {
+	output := Arg(args, "-o")
+	if strings.Contains(output, "%(ext)s") {
+		ext := Arg(args, "--audio-format")
+		if ext == "" {
+			ext, _, _ = strings.Cut(Arg(args, "--merge-output-format"), "/")
+		}
+		if ext == "" {
+			ext = "mp4"
+		}
+		output = strings.ReplaceAll(output, "%(ext)s", ext)
+	}
+	return output
+}
+
+func hasFlag(args []string, flag string) bool {
+	for _, arg := range args {
+		if arg == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// waitGate blocks until the gate file appears, if there is one
+func waitGate(path string) {
+	if path == "" {
+		return
+	}
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// markRunning leaves a mark of the run until the returned func is called and
+// logs how many marks there are. A run counts every run it overlaps with that
+// started before it, so the largest logged number is the peak concurrency.
+func markRunning(dir, peaks string) func() {
+	if dir == "" {
+		return func() {}
+	}
+	mark := filepath.Join(dir, strconv.Itoa(os.Getpid()))
+	if err := os.WriteFile(mark, nil, 0644); err != nil {
+		return func() {}
+	}
+	if entries, err := os.ReadDir(dir); err == nil {
+		appendLine(peaks, []byte(strconv.Itoa(len(entries))))
+	}
+	return func() { os.Remove(mark) }
+}
+
+func logCall(path string, args []string) {
+	if path == "" {
+		return
+	}
+	line, _ := json.Marshal(args)
+	appendLine(path, line)
+}
+
+func appendLine(path string, line []byte) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	f.Write(append(line, '\n'))
+}
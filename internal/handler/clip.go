@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"errors"
+	"regexp"
+
+	"github.com/artur/solid-spoon/internal/database/models"
+	"github.com/artur/solid-spoon/internal/downloader"
+)
+
+// clipSeparator отделяет фрагмент от ID видео в callback data: yt:<videoID>@<clip>:<quality>
+const clipSeparator = "@"
+
+// clipRangePattern matches the fragment written after the link, e.g. "1:23-2:10"
+var clipRangePattern = regexp.MustCompile(`(?:^|\s)((?:\d+:)?\d{1,2}:\d{2})\s*[-–—]\s*((?:\d+:)?\d{1,2}:\d{2})(?:\s|$)`)
+
+// clipStartPattern matches the t= parameter of YouTube links: t=83, t=83s, t=1m23s
+var clipStartPattern = regexp.MustCompile(`[?&#]t=(\d[\dhms]*)`)
+
+var errInvalidClip = errors.New("clip ends before it starts")
+
+// parseClip finds the fragment of the video requested in the message text.
+// A range in the text wins over the t= parameter of the link, which only
+// sets the start. nil means the whole video.
+func parseClip(text string) (*downloader.Clip, error) {
+	if m := clipRangePattern.FindStringSubmatch(text); m != nil {
+		start, ok1 := downloader.ParseTimestamp(m[1])
+		end, ok2 := downloader.ParseTimestamp(m[2])
+		if !ok1 || !ok2 || end <= start {
+			return nil, errInvalidClip
+		}
+		return &downloader.Clip{Start: start, End: end}, nil
+	}
+
+	if m := clipStartPattern.FindStringSubmatch(text); m != nil {
+		start, ok := downloader.ParseTimestamp(m[1])
+		// t=0 - просто ссылка на начало видео
+		if ok && start > 0 {
+			return &downloader.Clip{Start: start}, nil
+		}
+	}
+	return nil, nil
+}
+
+// jobClip returns the fragment the job downloads, nil for the whole video
+func jobClip(job *models.DownloadJob) *downloader.Clip {
+	if job.Clip == "" {
+		return nil
+	}
+	clip, ok := downloader.ParseClip(job.Clip)
+	if !ok {
+		return nil
+	}
+	return &clip
+}
+
+// clipLabel describes the fragment for users: "1:23–2:10" or "с 1:23 до конца"
+func clipLabel(lang string, clip *downloader.Clip) string {
+	if clip.End == 0 {
+		return trf(lang, "clip.to_end", downloader.FormatTimestamp(clip.Start))
+	}
+	return downloader.FormatTimestamp(clip.Start) + "–" + downloader.FormatTimestamp(clip.End)
+}
+
+// jobSubject describes what the job downloads for status messages
+func jobSubject(lang string, job *models.DownloadJob) string {
+	subject := downloadSubject(lang, downloader.Quality(job.Quality))
+	if clip := jobClip(job); clip != nil {
+		subject += trf(lang, "subject.clip", clipLabel(lang, clip))
+	}
+	if subs := jobSubtitles(job); subs != nil {
+		subject += trf(lang, "subject.subtitles", subtitlesLabel(lang, subs))
+	}
+	return subject
+}
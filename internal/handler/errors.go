@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/artur/solid-spoon/internal/downloader"
+)
+
+// downloadErrorTexts - ключи сообщений пользователю для известных причин ошибок загрузки
+var downloadErrorTexts = []struct {
+	err error
+	key string
+}{
+	{downloader.ErrPrivate, "error.private"},
+	{downloader.ErrMembersOnly, "error.members_only"},
+	{downloader.ErrAgeRestricted, "error.age"},
+	{downloader.ErrGeoBlocked, "error.geo"},
+	{downloader.ErrCopyright, "error.copyright"},
+	{downloader.ErrLiveNotFinished, "error.live"},
+	{downloader.ErrRateLimited, "error.rate_limited"},
+	{downloader.ErrUnavailable, "error.unavailable"},
+	{downloader.ErrNoFormats, "error.no_formats"},
+	{downloader.ErrEmptyPlaylist, "error.empty_playlist"},
+	{downloader.ErrAudioUnsupported, "error.no_audio"},
+	{downloader.ErrClipUnsupported, "error.no_clip"},
+	{downloader.ErrSubtitlesUnsupported, "error.no_burn"},
+	{downloader.ErrNoSubtitles, "error.no_subtitles"},
+}
+
+// downloadErrorText returns a message explaining why the download failed.
+// Raw yt-dlp output is never shown to users, it only goes to logs.
+func downloadErrorText(lang string, err error) string {
+	var tooLarge *downloader.TooLargeError
+	if errors.As(err, &tooLarge) {
+		return trf(lang, "error.too_large",
+			float64(tooLarge.Size)/(1024*1024), float64(tooLarge.Limit)/(1024*1024))
+	}
+
+	for _, e := range downloadErrorTexts {
+		if errors.Is(err, e.err) {
+			return tr(lang, e.key)
+		}
+	}
+	return tr(lang, "error.unknown")
+}
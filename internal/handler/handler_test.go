@@ -1,7 +1,14 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
+
+	"github.com/artur/solid-spoon/internal/database/models"
+	"github.com/artur/solid-spoon/internal/downloader"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 func TestGetUserName(t *testing.T) {
@@ -62,7 +69,7 @@ func TestFormatGreeting(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := formatGreeting(tt.userName)
+			result := formatGreeting(models.LanguageRussian, tt.userName)
 			if result != tt.expected {
 				t.Errorf("formatGreeting(%q) = %q, want %q",
 					tt.userName, result, tt.expected)
@@ -71,46 +78,278 @@ func TestFormatGreeting(t *testing.T) {
 	}
 }
 
-func TestExtractYouTubeID(t *testing.T) {
+func TestParseQualityCallback(t *testing.T) {
+	tests := []struct {
+		data    string
+		videoID string
+		clip    string
+		quality downloader.Quality
+		ok      bool
+	}{
+		{"yt:dQw4w9WgXcQ:720p", "dQw4w9WgXcQ", "", downloader.QualityHigh, true},
+		{"yt:tiktok:7301234567890123456:audio", "tiktok:7301234567890123456", "", downloader.QualityAudio, true},
+		{"yt:dQw4w9WgXcQ@83-130:720p", "dQw4w9WgXcQ", "83-130", downloader.QualityHigh, true},
+		{"yt:vimeo:76979871@83-:audio", "vimeo:76979871", "83-", downloader.QualityAudio, true},
+		{"yt:dQw4w9WgXcQ@130-83:720p", "", "", "", false},
+		{"yt:@83-130:720p", "", "", "", false},
+		{"yt:dQw4w9WgXcQ:", "", "", "", false},
+		{"yt::720p", "", "", "", false},
+		{"yt:dQw4w9WgXcQ", "", "", "", false},
+		{"other:dQw4w9WgXcQ:720p", "", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			videoID, clip, quality, ok := parseQualityCallback(tt.data)
+			if videoID != tt.videoID || clip != tt.clip || quality != tt.quality || ok != tt.ok {
+				t.Errorf("parseQualityCallback(%q) = %q, %q, %q, %v, want %q, %q, %q, %v",
+					tt.data, videoID, clip, quality, ok, tt.videoID, tt.clip, tt.quality, tt.ok)
+			}
+		})
+	}
+}
+
+func TestParseClip(t *testing.T) {
+	link := "https://youtu.be/dQw4w9WgXcQ"
+	tests := []struct {
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{link, "", false},
+		{link + " 1:23-2:10", "83-130", false},
+		{link + " 1:23 – 1:02:10", "83-3730", false},
+		{"1:23-2:10 " + link, "83-130", false},
+		{link + "?t=83", "83-", false},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=1m23s", "83-", false},
+		{link + "?t=0", "", false},
+		{link + "?t=83 2:00-2:30", "120-150", false},
+		{link + " 2:10-1:23", "", true},
+		{link + " 1-10", "", false},
+	}
+
+	for _, tt := range tests {
+		clip, err := parseClip(tt.text)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseClip(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			continue
+		}
+		got := ""
+		if clip != nil {
+			got = clip.String()
+		}
+		if got != tt.want {
+			t.Errorf("parseClip(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestFormatCaption(t *testing.T) {
+	longDesc := strings.Repeat("a", 300)
+
+	tests := []struct {
+		name        string
+		title       string
+		description string
+		expected    string
+	}{
+		{"title only", "Title", "", "Title"},
+		{"title with description", "Title", "Desc", "Title\n\nDesc"},
+		{"long description is truncated", "Title", longDesc, "Title\n\n" + strings.Repeat("a", 200) + "..."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := formatCaption(tt.title, tt.description)
+			if result != tt.expected {
+				t.Errorf("formatCaption(%q, ...) = %q, want %q", tt.title, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFormatPartCaption(t *testing.T) {
+	if got := formatPartCaption(models.LanguageRussian, 2, 4, "Video"); got != "Часть 2/4 — Video" {
+		t.Errorf("formatPartCaption() = %q", got)
+	}
+	if got := formatPartCaption(models.LanguageRussian, 1, 3, ""); got != "Часть 1/3" {
+		t.Errorf("formatPartCaption() without title = %q", got)
+	}
+}
+
+func TestDefaultQuality(t *testing.T) {
+	formats := []downloader.VideoFormat{
+		{Quality: downloader.QualityHigh, QualityNum: 720},
+		{Quality: downloader.QualityFull, QualityNum: 1080},
+		{Quality: downloader.QualityAudio},
+	}
+	tests := []struct {
+		preferred string
+		expected  downloader.Quality
+	}{
+		{"1080p", downloader.QualityFull},
+		{"720p", downloader.QualityHigh},
+		// Если все форматы больше - самый маленький
+		{"360p", downloader.QualityHigh},
+	}
+	for _, tt := range tests {
+		if got, ok := defaultQuality(formats, tt.preferred); !ok || got != tt.expected {
+			t.Errorf("defaultQuality(%s) = %s, want %s", tt.preferred, got, tt.expected)
+		}
+	}
+	if _, ok := defaultQuality(formats[2:], "720p"); ok {
+		t.Error("Expected no video quality for audio only")
+	}
+}
+
+func TestDownloadSubject(t *testing.T) {
+	if got := downloadSubject(models.LanguageRussian, downloader.QualityHigh); got != "видео в качестве 720p" {
+		t.Errorf("downloadSubject(720p) = %q", got)
+	}
+	if got := downloadSubject(models.LanguageRussian, downloader.QualityAudio); got != "аудио" {
+		t.Errorf("downloadSubject(audio) = %q", got)
+	}
+}
+
+func TestIsStaleFileError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"wrong file identifier", &tgbotapi.Error{Code: 400, Message: "Bad Request: wrong file identifier/HTTP URL specified"}, true},
+		{"wrong remote file", &tgbotapi.Error{Code: 400, Message: "Bad Request: wrong remote file identifier specified: Wrong padding in the string"}, true},
+		{"file reference expired", &tgbotapi.Error{Code: 400, Message: "Bad Request: FILE_REFERENCE_EXPIRED"}, true},
+		{"unrelated api error", &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}, false},
+		{"network error", errors.New("connection reset by peer"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isStaleFileError(tt.err); got != tt.expected {
+				t.Errorf("isStaleFileError(%v) = %v, want %v", tt.err, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSentFileID(t *testing.T) {
 	tests := []struct {
 		name     string
-		text     string
+		msg      tgbotapi.Message
 		expected string
 	}{
-		{
-			name:     "extracts ID from youtube.com/watch",
-			text:     "https://www.youtube.com/watch?v=dQw4w9WgXcQ",
-			expected: "dQw4w9WgXcQ",
-		},
-		{
-			name:     "extracts ID from youtu.be",
-			text:     "https://youtu.be/dQw4w9WgXcQ",
-			expected: "dQw4w9WgXcQ",
-		},
-		{
-			name:     "extracts ID from youtube.com/shorts",
-			text:     "https://youtube.com/shorts/dQw4w9WgXcQ",
-			expected: "dQw4w9WgXcQ",
-		},
-		{
-			name:     "returns empty for non-youtube URL",
-			text:     "https://example.com/video",
-			expected: "",
-		},
-		{
-			name:     "returns empty for empty string",
-			text:     "",
-			expected: "",
-		},
+		{"document", tgbotapi.Message{Document: &tgbotapi.Document{FileID: "doc"}}, "doc"},
+		{"audio", tgbotapi.Message{Audio: &tgbotapi.Audio{FileID: "audio"}}, "audio"},
+		{"video", tgbotapi.Message{Video: &tgbotapi.Video{FileID: "video"}}, "video"},
+		{"text only", tgbotapi.Message{Text: "hello"}, ""},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := extractYouTubeID(tt.text)
-			if result != tt.expected {
-				t.Errorf("extractYouTubeID(%q) = %q, want %q",
-					tt.text, result, tt.expected)
+			if got := sentFileID(tt.msg); got != tt.expected {
+				t.Errorf("sentFileID() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDownloadErrorText(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		contains string
+	}{
+		{"private", &downloader.Error{Kind: downloader.ErrPrivate, Stderr: "ERROR: Private video"}, "приватное"},
+		{"geo blocked", fmt.Errorf("download: %w", &downloader.Error{Kind: downloader.ErrGeoBlocked}), "стране"},
+		{"rate limited", &downloader.Error{Kind: downloader.ErrRateLimited}, "ограничил"},
+		{"too large", &downloader.TooLargeError{Size: 75 << 20, Limit: 50 << 20}, "75.0 МБ), максимум 50 МБ"},
+		{"unknown yt-dlp error", &downloader.Error{Stderr: "ERROR: secret internal detail"}, "Не удалось скачать"},
+		{"other error", errors.New("exec: not found"), "Не удалось скачать"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := downloadErrorText(models.LanguageRussian, tt.err)
+			if !strings.Contains(text, tt.contains) {
+				t.Errorf("downloadErrorText() = %q, want it to contain %q", text, tt.contains)
+			}
+			if strings.Contains(text, "ERROR") {
+				t.Errorf("Raw yt-dlp output leaked to user: %q", text)
 			}
 		})
 	}
 }
+
+func TestParsePlaylistRange(t *testing.T) {
+	link := "https://www.youtube.com/playlist?list=PLtest"
+	tests := []struct {
+		text        string
+		count       int
+		first, last int
+		ok          bool
+	}{
+		{link, 10, 1, 10, true},
+		{link, 120, 1, maxPlaylistItems, true},
+		{link + " 3-5", 10, 3, 5, true},
+		{link + " 5 – 3", 10, 3, 5, true},
+		{"1-4 " + link, 10, 1, 4, true},
+		{link + " 8-20", 10, 8, 10, true},
+		{link + " 1-200", 300, 1, maxPlaylistItems, true},
+		{link + " 11-20", 10, 0, 0, false},
+		{link + " 0-3", 10, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		first, last, ok := parsePlaylistRange(tt.text, tt.count)
+		if first != tt.first || last != tt.last || ok != tt.ok {
+			t.Errorf("parsePlaylistRange(%q, %d) = %d, %d, %v, want %d, %d, %v",
+				tt.text, tt.count, first, last, ok, tt.first, tt.last, tt.ok)
+		}
+	}
+}
+
+func TestParsePlaylistCallback(t *testing.T) {
+	batchID, quality, ok := parsePlaylistCallback("pl:17:720p")
+	if !ok || batchID != 17 || quality != downloader.QualityHigh {
+		t.Errorf("Unexpected result: %d, %s, %v", batchID, quality, ok)
+	}
+	for _, data := range []string{"pl:17", "pl:x:720p", "pl:17:", "yt:17:720p"} {
+		if _, _, ok := parsePlaylistCallback(data); ok {
+			t.Errorf("Expected %q to be rejected", data)
+		}
+	}
+}
+
+func TestParseSubtitlesCallback(t *testing.T) {
+	tests := []struct {
+		data       string
+		wantJobID  int64
+		wantChoice string
+		wantOK     bool
+	}{
+		{"sb:12:file:en", 12, "file:en", true},
+		{"sb:12:burn:ru:auto", 12, "burn:ru:auto", true},
+		{"sb:12:-", 12, "-", true},
+		{"sb:12:copy:en", 0, "", false},
+		{"sb:abc:file:en", 0, "", false},
+		{"sb:12", 0, "", false},
+		{"yt:12:file:en", 0, "", false},
+	}
+
+	for _, tt := range tests {
+		jobID, choice, ok := parseSubtitlesCallback(tt.data)
+		if jobID != tt.wantJobID || choice != tt.wantChoice || ok != tt.wantOK {
+			t.Errorf("parseSubtitlesCallback(%q) = (%d, %q, %v), want (%d, %q, %v)",
+				tt.data, jobID, choice, ok, tt.wantJobID, tt.wantChoice, tt.wantOK)
+		}
+	}
+}
+
+func TestLinkHandler_CommandName(t *testing.T) {
+	// Статистика ссылок с первых версий бота собрана под этим именем
+	h := NewLinkHandler(nil, downloader.DefaultRegistry(), nil, nil, nil, nil, nil)
+	if got := h.CommandName(); got != "youtube" {
+		t.Errorf("CommandName() = %q, want %q", got, "youtube")
+	}
+}
@@ -0,0 +1,273 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/artur/solid-spoon/internal/database/models"
+)
+
+// texts holds translations of interface messages by language. Messages
+// missing in a language fall back to Russian.
+var texts = map[string]map[string]string{
+	models.LanguageRussian: {
+		"start.greeting":      "Привет, %s! Рад тебя видеть! 👋",
+		"link.choose_quality": "🎬 Выберите качество видео или аудио:",
+
+		"settings.title":   "⚙️ Настройки\n\nВыберите, что изменить:",
+		"settings.quality": "🎚 Качество",
+		"settings.mode":    "📦 Отправка",
+		"settings.caption": "📝 Подпись",
+		"settings.delete":  "🗑 Удалять ссылку",
+		"settings.lang":    "🌐 Язык",
+		"settings.back":    "« Назад",
+		"settings.saved":   "Сохранено",
+		"settings.failed":  "Не удалось сохранить, попробуйте ещё раз",
+		"settings.on":      "да",
+		"settings.off":     "нет",
+
+		"quality.prompt": "В каком качестве скачивать видео?\n\nС выбранным качеством ссылки скачиваются сразу, без клавиатуры. Если такого качества нет, берётся ближайшее меньшее.",
+		"quality.ask":    "Спрашивать",
+
+		"mode.prompt": "Как присылать видео?\n\n" +
+			"📄 Файлом - оригинальное качество, видео нужно скачать перед просмотром\n" +
+			"🎬 Видео - встроенный плеер с превью, можно смотреть сразу\n" +
+			"🎵 Аудио - только звуковая дорожка, ссылки скачиваются сразу",
+		"mode.document": "📄 Файлом",
+		"mode.video":    "🎬 Видео",
+		"mode.audio":    "🎵 Аудио",
+
+		"caption.prompt": "Что писать в подписи к видео?",
+		"caption.full":   "Название и описание",
+		"caption.title":  "Только название",
+		"caption.none":   "Без подписи",
+
+		"lang.prompt": "Язык интерфейса:",
+
+		"format.audio": "🎵 Аудио",
+
+		"link.bad_clip":         "❌ Конец фрагмента должен быть позже начала, например: ссылка 1:23-2:10",
+		"link.fragment":         "✂️ Фрагмент %s",
+		"link.stale_button":     "Кнопка устарела, отправьте ссылку ещё раз",
+		"link.choose_subtitles": "Выберите субтитры",
+		"link.downloading":      "Скачиваю %s...",
+		"link.status":           "⏳ Скачиваю %s...",
+		"link.queued":           "⏳ Вы №%d в очереди, загрузка начнётся автоматически",
+		"link.overloaded":       "❌ Бот перегружен, отправьте ссылку ещё раз",
+		"link.uploading":        "📤 Отправляю видео в Telegram...",
+		"link.file_error":       "❌ Ошибка при проверке файла",
+		"link.video_failed":     "❌ Не удалось отправить видео, попробуйте ещё раз позже",
+		"link.audio_failed":     "❌ Не удалось отправить аудио, попробуйте ещё раз позже",
+		"link.video_sent":       "✅ Видео отправлено (%s)",
+		"link.audio_sent":       "✅ Аудио отправлено",
+		"link.sent":             "✅ Отправлено (%s)",
+		"link.part":             "Часть %d/%d",
+
+		"subject.audio":     "аудио",
+		"subject.video":     "видео в качестве %s",
+		"subject.clip":      ", фрагмент %s",
+		"subject.subtitles": ", субтитры %s",
+		"clip.to_end":       "с %s до конца",
+
+		"job.interrupted": "🔄 Бот перезапускается. Загрузка продолжится после запуска, " +
+			"а если этого не произойдёт - отправьте ссылку ещё раз",
+		"job.cancel":     "✖ Отмена",
+		"job.cancelling": "Отменяю загрузку...",
+		"job.not_owner":  "Отменить загрузку может только тот, кто её запустил",
+		"job.finished":   "Загрузка уже завершена",
+		"job.cancelled":  "✖ Загрузка отменена",
+		"job.gave_up":    "❌ Не удалось скачать видео после нескольких попыток",
+		"job.resumed":    "🔄 Бот был перезапущен, продолжаю: %s...",
+
+		"playlist.unsupported":    "❌ Скачивание плейлистов не поддерживается",
+		"playlist.out_of_range":   "❌ В плейлисте всего %d видео, укажите номера от 1 до %d",
+		"playlist.failed":         "❌ Не удалось скачать плейлист, попробуйте позже",
+		"playlist.info":           "📃 %s\nВидео в плейлисте: %d\nБудут скачаны: %d–%d",
+		"playlist.range_hint":     "Чтобы скачать другие видео, отправьте ссылку с номерами, например: ссылка 11-20",
+		"playlist.not_owner":      "Выбрать качество может только тот, кто отправил ссылку",
+		"playlist.started":        "Загрузка плейлиста уже запущена",
+		"playlist.downloading":    "Скачиваю плейлист в %s...",
+		"playlist.fetching":       "⏳ Получаю список видео...",
+		"playlist.resumed":        "🔄 Бот был перезапущен, продолжаю загрузку плейлиста...",
+		"playlist.header":         "📃 %s\nВидео %d из %d",
+		"playlist.header_failed":  " (не удалось: %d)",
+		"playlist.done":           "✅ Плейлист скачан",
+		"playlist.cancelled":      "✖ Загрузка плейлиста отменена",
+		"playlist.summary":        "📃 %s\n\n%s\nОтправлено: %d из %d",
+		"playlist.summary_failed": "\nНе удалось скачать: %d",
+		"playlist.untitled":       "Плейлист",
+
+		"subtitles.prompt":    "💬 Добавить субтитры?\n\n📄 - отдельным файлом .srt\n🔥 - вшить в видео",
+		"subtitles.auto":      "авто",
+		"subtitles.none":      "Без субтитров",
+		"subtitles.not_owner": "Выбрать субтитры может только тот, кто отправил ссылку",
+		"subtitles.caption":   "💬 Субтитры (%s)",
+
+		"progress.compress": "🗜 Сжимаю видео, чтобы оно поместилось в Telegram...",
+		"progress.split":    "✂️ Режу видео на части...",
+		"progress.burn":     "💬 Вшиваю субтитры в видео...",
+		"progress.wait":     "💾 Жду, пока освободится место на диске...",
+		"progress.speed":    "%s/с",
+
+		"unit.b":  "%d Б",
+		"unit.kb": "%.0f КБ",
+		"unit.mb": "%.1f МБ",
+		"unit.gb": "%.1f ГБ",
+
+		"error.too_large":      "📦 Файл слишком большой (%.1f МБ), максимум %.0f МБ",
+		"error.private":        "🔒 Это приватное видео, скачать его нельзя",
+		"error.members_only":   "💳 Видео доступно только спонсорам канала",
+		"error.age":            "🔞 Видео с возрастным ограничением, YouTube не отдаёт его без входа в аккаунт",
+		"error.geo":            "🌍 Видео недоступно в стране, где работает бот",
+		"error.copyright":      "©️ Видео заблокировано по жалобе правообладателя",
+		"error.live":           "🔴 Трансляция ещё не закончилась, попробуйте после её завершения",
+		"error.rate_limited":   "⏳ YouTube временно ограничил запросы бота, попробуйте через несколько минут",
+		"error.unavailable":    "🚫 Видео недоступно: оно удалено или ссылка неверная",
+		"error.no_formats":     "🤷 Не нашлось подходящего формата для скачивания",
+		"error.empty_playlist": "📭 В плейлисте нет видео, которые можно скачать",
+		"error.no_audio":       "🎵 Скачивание аудио на этом сервере недоступно",
+		"error.no_clip":        "✂️ Вырезать фрагмент на этом сервере нельзя, отправьте ссылку без времени",
+		"error.no_burn":        "💬 Вшить субтитры на этом сервере нельзя, выберите их отдельным файлом",
+		"error.no_subtitles":   "💬 Не удалось скачать субтитры на выбранном языке",
+		"error.unknown":        "❌ Не удалось скачать видео, попробуйте позже",
+	},
+	models.LanguageEnglish: {
+		"start.greeting":      "Hi, %s! Glad to see you! 👋",
+		"link.choose_quality": "🎬 Choose video quality or audio:",
+
+		"settings.title":   "⚙️ Settings\n\nChoose what to change:",
+		"settings.quality": "🎚 Quality",
+		"settings.mode":    "📦 Delivery",
+		"settings.caption": "📝 Caption",
+		"settings.delete":  "🗑 Delete link",
+		"settings.lang":    "🌐 Language",
+		"settings.back":    "« Back",
+		"settings.saved":   "Saved",
+		"settings.failed":  "Could not save, please try again",
+		"settings.on":      "yes",
+		"settings.off":     "no",
+
+		"quality.prompt": "Which quality should videos be downloaded in?\n\nWith a quality chosen links are downloaded right away, without the keyboard. If the video has no such quality, the nearest lower one is taken.",
+		"quality.ask":    "Ask every time",
+
+		"mode.prompt": "How should videos be sent?\n\n" +
+			"📄 File - original quality, the video has to be downloaded before watching\n" +
+			"🎬 Video - built-in player with a preview, can be watched right away\n" +
+			"🎵 Audio - the audio track only, links are downloaded right away",
+		"mode.document": "📄 File",
+		"mode.video":    "🎬 Video",
+		"mode.audio":    "🎵 Audio",
+
+		"caption.prompt": "What should the video caption contain?",
+		"caption.full":   "Title and description",
+		"caption.title":  "Title only",
+		"caption.none":   "No caption",
+
+		"lang.prompt": "Interface language:",
+
+		"format.audio": "🎵 Audio",
+
+		"link.bad_clip":         "❌ The end of the fragment must be after its start, e.g.: link 1:23-2:10",
+		"link.fragment":         "✂️ Fragment %s",
+		"link.stale_button":     "The button is outdated, send the link again",
+		"link.choose_subtitles": "Choose subtitles",
+		"link.downloading":      "Downloading %s...",
+		"link.status":           "⏳ Downloading %s...",
+		"link.queued":           "⏳ You are #%d in the queue, the download will start automatically",
+		"link.overloaded":       "❌ The bot is overloaded, send the link again",
+		"link.uploading":        "📤 Uploading the video to Telegram...",
+		"link.file_error":       "❌ Failed to check the file",
+		"link.video_failed":     "❌ Could not send the video, please try again later",
+		"link.audio_failed":     "❌ Could not send the audio, please try again later",
+		"link.video_sent":       "✅ Video sent (%s)",
+		"link.audio_sent":       "✅ Audio sent",
+		"link.sent":             "✅ Sent (%s)",
+		"link.part":             "Part %d/%d",
+
+		"subject.audio":     "audio",
+		"subject.video":     "video in %s",
+		"subject.clip":      ", fragment %s",
+		"subject.subtitles": ", subtitles %s",
+		"clip.to_end":       "from %s to the end",
+
+		"job.interrupted": "🔄 The bot is restarting. The download will continue after the start, " +
+			"and if it does not - send the link again",
+		"job.cancel":     "✖ Cancel",
+		"job.cancelling": "Cancelling the download...",
+		"job.not_owner":  "Only the one who started the download can cancel it",
+		"job.finished":   "The download has already finished",
+		"job.cancelled":  "✖ Download cancelled",
+		"job.gave_up":    "❌ Could not download the video after several attempts",
+		"job.resumed":    "🔄 The bot was restarted, resuming: %s...",
+
+		"playlist.unsupported":    "❌ Playlist downloads are not supported",
+		"playlist.out_of_range":   "❌ The playlist has only %d videos, use numbers from 1 to %d",
+		"playlist.failed":         "❌ Could not download the playlist, please try later",
+		"playlist.info":           "📃 %s\nVideos in the playlist: %d\nTo be downloaded: %d–%d",
+		"playlist.range_hint":     "To download other videos, send the link with their numbers, e.g.: link 11-20",
+		"playlist.not_owner":      "Only the one who sent the link can choose the quality",
+		"playlist.started":        "The playlist download has already started",
+		"playlist.downloading":    "Downloading the playlist in %s...",
+		"playlist.fetching":       "⏳ Getting the list of videos...",
+		"playlist.resumed":        "🔄 The bot was restarted, resuming the playlist download...",
+		"playlist.header":         "📃 %s\nVideo %d of %d",
+		"playlist.header_failed":  " (failed: %d)",
+		"playlist.done":           "✅ Playlist downloaded",
+		"playlist.cancelled":      "✖ Playlist download cancelled",
+		"playlist.summary":        "📃 %s\n\n%s\nSent: %d of %d",
+		"playlist.summary_failed": "\nFailed to download: %d",
+		"playlist.untitled":       "Playlist",
+
+		"subtitles.prompt":    "💬 Add subtitles?\n\n📄 - as a separate .srt file\n🔥 - burned into the video",
+		"subtitles.auto":      "auto",
+		"subtitles.none":      "No subtitles",
+		"subtitles.not_owner": "Only the one who sent the link can choose subtitles",
+		"subtitles.caption":   "💬 Subtitles (%s)",
+
+		"progress.compress": "🗜 Compressing the video to fit into Telegram...",
+		"progress.split":    "✂️ Splitting the video into parts...",
+		"progress.burn":     "💬 Burning subtitles into the video...",
+		"progress.wait":     "💾 Waiting for free disk space...",
+		"progress.speed":    "%s/s",
+
+		"unit.b":  "%d B",
+		"unit.kb": "%.0f KB",
+		"unit.mb": "%.1f MB",
+		"unit.gb": "%.1f GB",
+
+		"error.too_large":      "📦 The file is too large (%.1f MB), the limit is %.0f MB",
+		"error.private":        "🔒 This video is private and cannot be downloaded",
+		"error.members_only":   "💳 The video is available to channel members only",
+		"error.age":            "🔞 The video is age-restricted, YouTube does not give it out without signing in",
+		"error.geo":            "🌍 The video is not available in the country the bot runs in",
+		"error.copyright":      "©️ The video was blocked on a copyright claim",
+		"error.live":           "🔴 The stream has not ended yet, try again after it ends",
+		"error.rate_limited":   "⏳ YouTube has temporarily limited the bot's requests, try again in a few minutes",
+		"error.unavailable":    "🚫 The video is unavailable: it was removed or the link is wrong",
+		"error.no_formats":     "🤷 No suitable format to download was found",
+		"error.empty_playlist": "📭 The playlist has no videos that can be downloaded",
+		"error.no_audio":       "🎵 Audio downloads are not available on this server",
+		"error.no_clip":        "✂️ Fragments cannot be cut on this server, send the link without the time",
+		"error.no_burn":        "💬 Subtitles cannot be burned in on this server, choose a separate file",
+		"error.no_subtitles":   "💬 Could not download subtitles in the chosen language",
+		"error.unknown":        "❌ Could not download the video, please try later",
+	},
+}
+
+// languageNames are shown in the language menu in the language itself
+var languageNames = map[string]string{
+	models.LanguageRussian: "🇷🇺 Русский",
+	models.LanguageEnglish: "🇬🇧 English",
+}
+
+// tr returns the message in the language
+func tr(lang, key string) string {
+	if text, ok := texts[lang][key]; ok {
+		return text
+	}
+	return texts[models.LanguageRussian][key]
+}
+
+// trf formats the message in the language with args
+func trf(lang, key string, args ...any) string {
+	return fmt.Sprintf(tr(lang, key), args...)
+}
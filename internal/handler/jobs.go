@@ -0,0 +1,339 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	botpkg "github.com/artur/solid-spoon/internal/bot"
+	"github.com/artur/solid-spoon/internal/database/models"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxJobAttempts - сколько раз задача может быть запущена, прежде чем мы сдадимся
+const maxJobAttempts = 3
+
+// cancelCallbackPrefix - префикс callback data кнопки отмены: yt:cancel:<jobID>
+const cancelCallbackPrefix = "yt:cancel:"
+
+var (
+	errJobNotFound = errors.New("job is not running")
+	errNotJobOwner = errors.New("job belongs to another user")
+	// errShuttingDown - причина отмены задач, не успевших завершиться до остановки бота
+	errShuttingDown = errors.New("bot is shutting down")
+)
+
+// jobTracker keeps cancel functions of scheduled and running jobs
+type jobTracker struct {
+	mu   sync.Mutex
+	jobs map[int64]trackedJob
+}
+
+type trackedJob struct {
+	userID int64
+	cancel context.CancelCauseFunc
+	// header - первая строка статуса задачи из плейлиста, общая для всего плейлиста
+	header string
+}
+
+func newJobTracker() *jobTracker {
+	return &jobTracker{jobs: make(map[int64]trackedJob)}
+}
+
+// track returns a context that is cancelled when the job owner presses the
+// cancel button. Jobs that were not persisted have no ID and cannot be cancelled.
+func (t *jobTracker) track(job *models.DownloadJob) context.Context {
+	if job.ID == 0 {
+		return context.Background()
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+
+	t.mu.Lock()
+	t.jobs[job.ID] = trackedJob{userID: job.TelegramUserID, cancel: cancel}
+	t.mu.Unlock()
+
+	return ctx
+}
+
+// setHeader makes status messages of a tracked job start with header
+func (t *jobTracker) setHeader(jobID int64, header string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if tracked, ok := t.jobs[jobID]; ok {
+		tracked.header = header
+		t.jobs[jobID] = tracked
+	}
+}
+
+// header returns the status header of a tracked job, "" if it has none
+func (t *jobTracker) header(jobID int64) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.jobs[jobID].header
+}
+
+// done forgets the job and releases its context
+func (t *jobTracker) done(jobID int64) {
+	t.mu.Lock()
+	tracked, ok := t.jobs[jobID]
+	delete(t.jobs, jobID)
+	t.mu.Unlock()
+
+	if ok {
+		tracked.cancel(nil)
+	}
+}
+
+// cancel stops the job if it is still tracked and belongs to userID
+func (t *jobTracker) cancel(jobID, userID int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tracked, ok := t.jobs[jobID]
+	if !ok {
+		return errJobNotFound
+	}
+	if tracked.userID != userID {
+		return errNotJobOwner
+	}
+
+	tracked.cancel(nil)
+	return nil
+}
+
+// cancelAll stops every tracked job with the given cause and returns how many were stopped
+func (t *jobTracker) cancelAll(cause error) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, tracked := range t.jobs {
+		tracked.cancel(cause)
+	}
+	return len(t.jobs)
+}
+
+// cancelMarkup returns the keyboard with a cancel button for the job status message
+func cancelMarkup(lang string, job *models.DownloadJob) *tgbotapi.InlineKeyboardMarkup {
+	if job.ID == 0 {
+		return nil
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(tr(lang, "job.cancel"), fmt.Sprintf("%s%d", cancelCallbackPrefix, job.ID)),
+	))
+	return &keyboard
+}
+
+// parseCancelCallback extracts the job ID from cancel button callback data
+func parseCancelCallback(data string) (int64, bool) {
+	raw, ok := strings.CutPrefix(data, cancelCallbackPrefix)
+	if !ok {
+		return 0, false
+	}
+	jobID, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return jobID, true
+}
+
+// handleCancel processes a press of the cancel button
+func (h *LinkHandler) handleCancel(bot botpkg.Sender, callback *tgbotapi.CallbackQuery) {
+	jobID, ok := parseCancelCallback(callback.Data)
+	if !ok {
+		log.Printf("[LINK] Invalid cancel callback data: %s", callback.Data)
+		return
+	}
+
+	lang := h.language(callback.From.ID)
+	text := tr(lang, "job.cancelling")
+	switch err := h.jobs.cancel(jobID, callback.From.ID); {
+	case errors.Is(err, errNotJobOwner):
+		text = tr(lang, "job.not_owner")
+	case err != nil:
+		text = tr(lang, "job.finished")
+	default:
+		log.Printf("[LINK] Job %d cancelled by user %d", jobID, callback.From.ID)
+	}
+
+	bot.Send(tgbotapi.NewCallback(callback.ID, text))
+}
+
+// editStatus replaces the text of the job status message keeping the cancel button
+func editStatus(bot botpkg.Sender, lang string, job *models.DownloadJob, text string) {
+	editMsg := tgbotapi.NewEditMessageText(job.ChatID, job.MessageID, text)
+	editMsg.ReplyMarkup = cancelMarkup(lang, job)
+	bot.Send(editMsg)
+}
+
+// editStatusText replaces the text of the job status message removing the buttons
+func editStatusText(bot botpkg.Sender, job *models.DownloadJob, text string) {
+	editMsg := tgbotapi.NewEditMessageText(job.ChatID, job.MessageID, text)
+	bot.Send(editMsg)
+}
+
+// Resume re-queues jobs left unfinished by a previous run of the bot
+func (h *LinkHandler) Resume(bot botpkg.Sender, schedule botpkg.ScheduleFunc) {
+	jobs, err := h.jobRepo.ListUnfinished()
+	if err != nil {
+		log.Printf("[LINK] Failed to load unfinished jobs: %v", err)
+		return
+	}
+
+	// Первая незавершённая задача каждого плейлиста: из неё берётся статусное сообщение
+	batches := make(map[int64]*models.DownloadJob)
+	var batchOrder []int64
+
+	for _, job := range jobs {
+		lang := h.language(job.TelegramUserID)
+		if job.Attempts >= maxJobAttempts {
+			log.Printf("[LINK] Job %d exceeded %d attempts, giving up", job.ID, maxJobAttempts)
+			h.failJob(bot, job, tr(lang, "job.gave_up"), "too many attempts")
+			continue
+		}
+
+		log.Printf("[LINK] Resuming job %d: %s (%s)", job.ID, job.VideoID, job.Quality)
+
+		// Возвращаем задачу в очередь до того, как её подхватит воркер
+		if err := h.jobRepo.Finish(job, models.JobQueued, ""); err != nil {
+			log.Printf("[LINK] Failed to requeue job %d: %v", job.ID, err)
+		}
+
+		// Видео плейлиста продолжает runBatch, по одной задаче на плейлист
+		if job.BatchID != 0 {
+			if _, ok := batches[job.BatchID]; !ok {
+				batches[job.BatchID] = job
+				batchOrder = append(batchOrder, job.BatchID)
+			}
+			continue
+		}
+
+		// Отслеживаем задачу сразу, чтобы её можно было отменить ещё в очереди
+		ctx := h.jobs.track(job)
+		editStatus(bot, lang, job, trf(lang, "job.resumed", jobSubject(lang, job)))
+
+		job := job
+		run := func() { h.runJob(ctx, bot, job) }
+		// Задача, не дождавшаяся воркера до остановки, остаётся в очереди в БД
+		drop := func() {
+			h.jobs.done(job.ID)
+			editStatusText(bot, job, tr(lang, "job.interrupted"))
+		}
+		if _, err := schedule(job.TelegramUserID, run, drop); err != nil {
+			log.Printf("[LINK] Failed to schedule job %d: %v", job.ID, err)
+			h.jobs.done(job.ID)
+			h.failJob(bot, job, tr(lang, "link.overloaded"), err.Error())
+		}
+	}
+
+	for _, batchID := range batchOrder {
+		h.resumeBatch(bot, schedule, batchID, batches[batchID])
+	}
+
+	log.Printf("[LINK] Resumed %d unfinished jobs", len(jobs))
+}
+
+// resumeBatch schedules the rest of a playlist interrupted by a restart
+func (h *LinkHandler) resumeBatch(bot botpkg.Sender, schedule botpkg.ScheduleFunc, batchID int64, job *models.DownloadJob) {
+	batch, err := h.jobRepo.GetBatch(batchID)
+	if err != nil || batch == nil {
+		log.Printf("[LINK] Failed to load batch %d: %v", batchID, err)
+		return
+	}
+
+	log.Printf("[LINK] Resuming batch %d: %s", batch.ID, batch.PlaylistID)
+	lang := h.language(job.TelegramUserID)
+	editStatusText(bot, job, "📃 "+playlistTitle(lang, batch)+"\n\n"+tr(lang, "playlist.resumed"))
+
+	run := func() { h.runBatch(bot, batch, job.ChatID, job.MessageID) }
+	drop := func() { editStatusText(bot, job, tr(lang, "job.interrupted")) }
+	if _, err := schedule(job.TelegramUserID, run, drop); err != nil {
+		log.Printf("[LINK] Failed to schedule batch %d: %v", batch.ID, err)
+		if err := h.jobRepo.CancelBatch(batch.ID); err != nil {
+			log.Printf("[LINK] Failed to cancel batch %d: %v", batch.ID, err)
+		}
+		editStatusText(bot, job, tr(lang, "link.overloaded"))
+	}
+}
+
+// scheduleDownload queues run behind the other downloads of the user and
+// returns its place in the queue. Without a scheduler in ctx, e.g. in tests,
+// run is called right away.
+func scheduleDownload(ctx context.Context, userID int64, run, drop func()) (int, error) {
+	schedule := botpkg.ScheduleFromContext(ctx)
+	if schedule == nil {
+		run()
+		return 0, nil
+	}
+
+	position, err := schedule(userID, run, drop)
+	if errors.Is(err, botpkg.ErrStopped) {
+		// Бот уже останавливается - как и задачи из очереди, загрузка дождётся перезапуска
+		drop()
+		return 0, nil
+	}
+	return position, err
+}
+
+// Interrupt cancels all running and queued jobs when the bot is stopping
+func (h *LinkHandler) Interrupt() {
+	n := h.jobs.cancelAll(errShuttingDown)
+	log.Printf("[LINK] Interrupted %d jobs", n)
+}
+
+// runJob executes a download job and keeps its persistent state up to date
+func (h *LinkHandler) runJob(ctx context.Context, bot botpkg.Sender, job *models.DownloadJob) {
+	defer h.jobs.done(job.ID)
+
+	// Задачу могли отменить, пока она ждала в очереди
+	if ctx.Err() == nil {
+		if job.ID != 0 {
+			if err := h.jobRepo.MarkRunning(job); err != nil {
+				log.Printf("[LINK] Failed to mark job %d running: %v", job.ID, err)
+			}
+		}
+
+		err := h.processJob(ctx, bot, job)
+		if err == nil {
+			h.finishJob(job, models.JobDone, "")
+			return
+		}
+		if ctx.Err() == nil {
+			log.Printf("[LINK] Job %d failed: %v", job.ID, err)
+			h.finishJob(job, models.JobFailed, err.Error())
+			return
+		}
+	}
+
+	if errors.Is(context.Cause(ctx), errShuttingDown) {
+		// Возвращаем задачу в очередь: её подхватит Resume после перезапуска
+		log.Printf("[LINK] Job %d interrupted by shutdown", job.ID)
+		h.finishJob(job, models.JobQueued, "")
+		editStatusText(bot, job, tr(h.language(job.TelegramUserID), "job.interrupted"))
+		return
+	}
+
+	log.Printf("[LINK] Job %d cancelled", job.ID)
+	h.finishJob(job, models.JobCancelled, "")
+	editStatusText(bot, job, tr(h.language(job.TelegramUserID), "job.cancelled"))
+}
+
+func (h *LinkHandler) finishJob(job *models.DownloadJob, status models.JobStatus, errMsg string) {
+	if job.ID == 0 {
+		return
+	}
+	if err := h.jobRepo.Finish(job, status, errMsg); err != nil {
+		log.Printf("[LINK] Failed to update job %d: %v", job.ID, err)
+	}
+}
+
+// failJob marks the job failed and shows text in its status message
+func (h *LinkHandler) failJob(bot botpkg.Sender, job *models.DownloadJob, text, errMsg string) {
+	h.finishJob(job, models.JobFailed, errMsg)
+	editStatusText(bot, job, text)
+}
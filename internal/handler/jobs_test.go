@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/artur/solid-spoon/internal/database/models"
+)
+
+func TestParseCancelCallback(t *testing.T) {
+	tests := []struct {
+		data   string
+		wantID int64
+		wantOK bool
+	}{
+		{"yt:cancel:42", 42, true},
+		{"yt:cancel:", 0, false},
+		{"yt:cancel:abc", 0, false},
+		{"yt:dQw4w9WgXcQ:720p", 0, false},
+	}
+
+	for _, tt := range tests {
+		id, ok := parseCancelCallback(tt.data)
+		if id != tt.wantID || ok != tt.wantOK {
+			t.Errorf("parseCancelCallback(%q) = %d, %v; want %d, %v", tt.data, id, ok, tt.wantID, tt.wantOK)
+		}
+	}
+}
+
+func TestCancelMarkup(t *testing.T) {
+	if cancelMarkup(models.LanguageRussian, &models.DownloadJob{}) != nil {
+		t.Error("Expected no cancel button for a job without ID")
+	}
+
+	markup := cancelMarkup(models.LanguageRussian, &models.DownloadJob{ID: 7})
+	if markup == nil {
+		t.Fatal("Expected cancel button")
+	}
+	data := markup.InlineKeyboard[0][0].CallbackData
+	if data == nil || *data != "yt:cancel:7" {
+		t.Errorf("Unexpected callback data: %v", data)
+	}
+}
+
+func TestJobTracker_Cancel(t *testing.T) {
+	tracker := newJobTracker()
+	job := &models.DownloadJob{ID: 1, TelegramUserID: 100}
+	ctx := tracker.track(job)
+
+	if err := tracker.cancel(1, 200); !errors.Is(err, errNotJobOwner) {
+		t.Errorf("Expected errNotJobOwner, got %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("Job must not be cancelled by another user")
+	}
+
+	if err := tracker.cancel(1, 100); err != nil {
+		t.Fatalf("Failed to cancel job: %v", err)
+	}
+	if ctx.Err() == nil {
+		t.Error("Expected job context to be cancelled")
+	}
+
+	tracker.done(1)
+	if err := tracker.cancel(1, 100); !errors.Is(err, errJobNotFound) {
+		t.Errorf("Expected errJobNotFound after done, got %v", err)
+	}
+}
+
+func TestJobTracker_DoneReleasesContext(t *testing.T) {
+	tracker := newJobTracker()
+	ctx := tracker.track(&models.DownloadJob{ID: 1, TelegramUserID: 100})
+
+	tracker.done(1)
+	if ctx.Err() == nil {
+		t.Error("Expected context to be released by done")
+	}
+
+	if tracker.track(&models.DownloadJob{}).Done() != nil {
+		t.Error("Expected jobs without ID to get a context that is never cancelled")
+	}
+}
+
+func TestJobTracker_CancelAll(t *testing.T) {
+	tracker := newJobTracker()
+	first := tracker.track(&models.DownloadJob{ID: 1, TelegramUserID: 100})
+	second := tracker.track(&models.DownloadJob{ID: 2, TelegramUserID: 200})
+
+	if n := tracker.cancelAll(errShuttingDown); n != 2 {
+		t.Errorf("Expected 2 cancelled jobs, got %d", n)
+	}
+	for _, ctx := range []context.Context{first, second} {
+		if !errors.Is(context.Cause(ctx), errShuttingDown) {
+			t.Errorf("Expected shutdown cause, got %v", context.Cause(ctx))
+		}
+	}
+}
@@ -0,0 +1,822 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	botpkg "github.com/artur/solid-spoon/internal/bot"
+	"github.com/artur/solid-spoon/internal/database/models"
+	"github.com/artur/solid-spoon/internal/database/repository"
+	"github.com/artur/solid-spoon/internal/downloader"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// formatsTimeout - сколько ждём yt-dlp при получении списка форматов
+const formatsTimeout = time.Minute
+
+// qualityCallbackPrefix - префикс callback data кнопок качества: yt:<videoID>:<quality>.
+// Остался от времён, когда бот умел только YouTube: клавиатуры в старых сообщениях должны работать.
+const qualityCallbackPrefix = "yt:"
+
+// LinkHandler downloads videos from links to any source of the registry
+type LinkHandler struct {
+	downloader downloader.Downloader
+	sources    *downloader.Registry
+	userRepo   *repository.UserRepository
+	videoRepo  *repository.VideoRepository
+	jobRepo    *repository.JobRepository
+	fileRepo   *repository.FileCacheRepository
+	// settingsRepo - настройки пользователей, nil - настройки по умолчанию
+	settingsRepo *repository.SettingsRepository
+	jobs         *jobTracker
+}
+
+func NewLinkHandler(
+	dl downloader.Downloader,
+	sources *downloader.Registry,
+	userRepo *repository.UserRepository,
+	videoRepo *repository.VideoRepository,
+	jobRepo *repository.JobRepository,
+	fileRepo *repository.FileCacheRepository,
+	settingsRepo *repository.SettingsRepository,
+) *LinkHandler {
+	return &LinkHandler{
+		downloader:   dl,
+		sources:      sources,
+		userRepo:     userRepo,
+		videoRepo:    videoRepo,
+		jobRepo:      jobRepo,
+		fileRepo:     fileRepo,
+		settingsRepo: settingsRepo,
+		jobs:         newJobTracker(),
+	}
+}
+
+func (h *LinkHandler) CanHandle(update tgbotapi.Update) bool {
+	if update.Message != nil {
+		_, ok := h.sources.Match(update.Message.Text)
+		return ok
+	}
+	if update.CallbackQuery != nil {
+		data := update.CallbackQuery.Data
+		return strings.HasPrefix(data, qualityCallbackPrefix) ||
+			strings.HasPrefix(data, playlistCallbackPrefix) ||
+			strings.HasPrefix(data, subtitlesCallbackPrefix)
+	}
+	return false
+}
+
+// CommandName is the name links are recorded under in command statistics.
+// Links of all sources stay under "youtube" to keep the existing statistics whole.
+func (h *LinkHandler) CommandName() string {
+	return "youtube"
+}
+
+func (h *LinkHandler) Handle(ctx context.Context, bot botpkg.Sender, update tgbotapi.Update) {
+	// Обработка callback от кнопок
+	if update.CallbackQuery != nil {
+		h.handleCallback(ctx, bot, update)
+		return
+	}
+
+	link, _ := h.sources.Match(update.Message.Text)
+	if link.Provider.Playlist {
+		h.handlePlaylist(ctx, bot, update, link)
+		return
+	}
+
+	videoID := link.VideoID()
+	chatID := update.Message.Chat.ID
+
+	settings := userSettings(h.settingsRepo, update.Message.From.ID)
+
+	clip, err := parseClip(update.Message.Text)
+	if err != nil {
+		bot.Send(tgbotapi.NewMessage(chatID, tr(settings.Language, "link.bad_clip")))
+		return
+	}
+
+	log.Printf("[LINK] Processing %s video ID: %s for chat: %d", link.Provider.Name, videoID, chatID)
+
+	// В режиме аудио качество выбирать не из чего - сразу скачиваем звук
+	if settings.DeliveryMode == models.ModeAudio {
+		h.downloadNow(ctx, bot, update.Message, settings, videoID, clip, downloader.QualityAudio)
+		return
+	}
+
+	// Показываем действие "печатает"
+	actionCfg := tgbotapi.NewChatAction(chatID, tgbotapi.ChatTyping)
+	bot.Send(actionCfg)
+
+	// Получаем доступные форматы
+	log.Printf("[LINK] Fetching available formats for: %s", videoID)
+	formatsCtx, cancel := context.WithTimeout(ctx, formatsTimeout)
+	defer cancel()
+	formats, err := h.downloader.GetAvailableFormats(formatsCtx, videoID)
+	if err != nil {
+		log.Printf("[LINK] Failed to get formats: %v", err)
+		errMsg := tgbotapi.NewMessage(chatID, downloadErrorText(settings.Language, err))
+		bot.Send(errMsg)
+		return
+	}
+
+	log.Printf("[LINK] Found %d formats for: %s", len(formats), videoID)
+
+	if settings.DefaultQuality != "" {
+		if quality, ok := defaultQuality(formats, settings.DefaultQuality); ok {
+			h.downloadNow(ctx, bot, update.Message, settings, videoID, clip, quality)
+			return
+		}
+	}
+
+	// Создаём кнопки выбора качества
+	// Фрагмент передаётся в callback data вместе с ID видео
+	target := videoID
+	if clip != nil {
+		target += clipSeparator + clip.String()
+	}
+
+	var buttons [][]tgbotapi.InlineKeyboardButton
+	for _, f := range formats {
+		callbackData := qualityCallbackPrefix + target + ":" + string(f.Quality)
+		btn := tgbotapi.NewInlineKeyboardButtonData(formatLabel(settings.Language, f), callbackData)
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(btn))
+		log.Printf("[LINK] Added quality option: %s", f.Description)
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(buttons...)
+	text := tr(settings.Language, "link.choose_quality")
+	if clip != nil {
+		text = trf(settings.Language, "link.fragment", clipLabel(settings.Language, clip)) + "\n" + text
+	}
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = keyboard
+
+	if _, err := bot.Send(msg); err != nil {
+		log.Printf("[LINK] Failed to send quality selection: %v", err)
+	}
+
+	deleteLink(bot, update.Message, settings)
+}
+
+// downloadNow starts the download without the quality keyboard: the user has
+// chosen a default quality or the audio mode in settings. Subtitles are not
+// offered, the video is downloaded without them.
+func (h *LinkHandler) downloadNow(ctx context.Context, bot botpkg.Sender, message *tgbotapi.Message, settings *models.UserSettings, videoID string, clip *downloader.Clip, quality downloader.Quality) {
+	job := &models.DownloadJob{
+		TelegramUserID: message.From.ID,
+		ChatID:         message.Chat.ID,
+		VideoID:        videoID,
+		Quality:        string(quality),
+	}
+	if clip != nil {
+		job.Clip = clip.String()
+	}
+
+	log.Printf("[LINK] Downloading %s in default %s quality", videoID, quality)
+
+	// Статусное сообщение заменяет клавиатуру качества, в нём будет кнопка отмены
+	status, err := bot.Send(tgbotapi.NewMessage(job.ChatID, trf(settings.Language, "link.status", jobSubject(settings.Language, job))))
+	if err != nil {
+		log.Printf("[LINK] Failed to send status message: %v", err)
+		return
+	}
+	job.MessageID = status.MessageID
+
+	if err := h.jobRepo.Create(job); err != nil {
+		log.Printf("[LINK] Failed to persist job: %v", err)
+	}
+
+	deleteLink(bot, message, settings)
+	h.startJob(ctx, bot, job)
+}
+
+// defaultQuality picks the format of the user's default quality: the best one
+// not above it, the lowest one if the video has only larger formats
+func defaultQuality(formats []downloader.VideoFormat, preferred string) (downloader.Quality, bool) {
+	limit, _ := strconv.Atoi(strings.TrimSuffix(preferred, "p"))
+
+	var best, lowest *downloader.VideoFormat
+	for i, f := range formats {
+		// У аудио нет высоты
+		if f.QualityNum == 0 {
+			continue
+		}
+		if lowest == nil || f.QualityNum < lowest.QualityNum {
+			lowest = &formats[i]
+		}
+		if f.QualityNum <= limit && (best == nil || f.QualityNum > best.QualityNum) {
+			best = &formats[i]
+		}
+	}
+	if best == nil {
+		best = lowest
+	}
+	if best == nil {
+		return "", false
+	}
+	return best.Quality, true
+}
+
+// language returns the interface language the user chose in settings
+func (h *LinkHandler) language(telegramUserID int64) string {
+	return userSettings(h.settingsRepo, telegramUserID).Language
+}
+
+// deleteLink removes the user's message with the link unless the user keeps
+// links in settings
+func deleteLink(bot botpkg.Sender, message *tgbotapi.Message, settings *models.UserSettings) {
+	if !settings.DeleteLink {
+		return
+	}
+	deleteMsg := tgbotapi.NewDeleteMessage(message.Chat.ID, message.MessageID)
+	if _, err := bot.Send(deleteMsg); err != nil {
+		log.Printf("[LINK] Failed to delete user message: %v", err)
+	}
+}
+
+func (h *LinkHandler) handleCallback(ctx context.Context, bot botpkg.Sender, update tgbotapi.Update) {
+	callback := update.CallbackQuery
+	lang := h.language(callback.From.ID)
+	if strings.HasPrefix(callback.Data, cancelCallbackPrefix) {
+		h.handleCancel(bot, callback)
+		return
+	}
+	if strings.HasPrefix(callback.Data, playlistCallbackPrefix) && callback.Message != nil {
+		h.handlePlaylistCallback(ctx, bot, callback)
+		return
+	}
+	if strings.HasPrefix(callback.Data, subtitlesCallbackPrefix) && callback.Message != nil {
+		h.handleSubtitlesCallback(ctx, bot, callback)
+		return
+	}
+
+	// У callback из inline-режима нет сообщения, редактировать нечего
+	if callback.Message == nil {
+		log.Printf("[LINK] Callback without message: %s", callback.Data)
+		bot.Send(tgbotapi.NewCallback(callback.ID, tr(lang, "link.stale_button")))
+		return
+	}
+
+	chatID := callback.Message.Chat.ID
+	messageID := callback.Message.MessageID
+
+	// Парсим данные: yt:videoID:quality, ID других источников сам содержит двоеточие
+	videoID, clip, quality, ok := parseQualityCallback(callback.Data)
+	if !ok {
+		log.Printf("[LINK] Invalid callback data: %s", callback.Data)
+		return
+	}
+
+	log.Printf("[LINK] Callback: downloading %s in %s quality", videoID, quality)
+
+	// Сохраняем задачу, чтобы она пережила перезапуск бота
+	job := &models.DownloadJob{
+		TelegramUserID: callback.From.ID,
+		ChatID:         chatID,
+		MessageID:      messageID,
+		VideoID:        videoID,
+		Quality:        string(quality),
+		Clip:           clip,
+	}
+	if err := h.jobRepo.Create(job); err != nil {
+		log.Printf("[LINK] Failed to persist job: %v", err)
+	}
+
+	// Если у видео есть субтитры, задача ждёт выбора пользователя
+	if h.offerSubtitles(bot, job) {
+		bot.Send(tgbotapi.NewCallback(callback.ID, tr(lang, "link.choose_subtitles")))
+		return
+	}
+
+	// Отвечаем на callback
+	callbackCfg := tgbotapi.NewCallback(callback.ID, trf(lang, "link.downloading", qualityLabel(lang, quality)))
+	bot.Send(callbackCfg)
+
+	h.startJob(ctx, bot, job)
+}
+
+// startJob shows the cancel button and queues the job behind the user's
+// other downloads
+func (h *LinkHandler) startJob(ctx context.Context, bot botpkg.Sender, job *models.DownloadJob) {
+	lang := h.language(job.TelegramUserID)
+	// Отслеживаем задачу сразу, чтобы её можно было отменить ещё в очереди
+	jobCtx := h.jobs.track(job)
+
+	// Редактируем сообщение, добавляя кнопку отмены
+	editStatus(bot, lang, job, trf(lang, "link.status", jobSubject(lang, job)))
+
+	run := func() { h.runJob(jobCtx, bot, job) }
+	// Задача, не дождавшаяся воркера до остановки, остаётся в очереди в БД
+	drop := func() {
+		h.jobs.done(job.ID)
+		editStatusText(bot, job, tr(lang, "job.interrupted"))
+	}
+	position, err := scheduleDownload(ctx, job.TelegramUserID, run, drop)
+	if err != nil {
+		log.Printf("[LINK] Failed to schedule job %d: %v", job.ID, err)
+		h.jobs.done(job.ID)
+		h.failJob(bot, job, tr(lang, "link.overloaded"), err.Error())
+		return
+	}
+	if position > 0 {
+		log.Printf("[LINK] Job %d queued at position %d", job.ID, position)
+		editStatus(bot, lang, job, trf(lang, "link.queued", position))
+	}
+}
+
+// processJob downloads the video and sends it to the chat. Failures are
+// reported to the user by editing the job status message, cancellation is
+// reported by the caller.
+func (h *LinkHandler) processJob(ctx context.Context, bot botpkg.Sender, job *models.DownloadJob) error {
+	chatID := job.ChatID
+	messageID := job.MessageID
+	videoID := job.VideoID
+	quality := downloader.Quality(job.Quality)
+
+	if quality == downloader.QualityAudio {
+		return h.processAudioJob(ctx, bot, job)
+	}
+
+	user, err := h.userRepo.GetByTelegramID(job.TelegramUserID)
+	if err != nil {
+		log.Printf("[LINK] Failed to load user: %v", err)
+	}
+	settings := userSettings(h.settingsRepo, job.TelegramUserID)
+	lang := settings.Language
+	mode := deliveryMode(settings)
+
+	// Видео уже загружалось в Telegram - переотправляем по file_id
+	if h.sendCached(bot, job, mode, settings) {
+		return nil
+	}
+
+	// Показываем действие "отправляет видео"
+	actionCfg := tgbotapi.NewChatAction(chatID, tgbotapi.ChatUploadVideo)
+	bot.Send(actionCfg)
+
+	// Скачиваем видео
+	log.Printf("[LINK] Starting download: %s (%s)", videoID, quality)
+	progress := newProgressReporter(bot, chatID, messageID, lang, h.statusText(job, trf(lang, "link.status", jobSubject(lang, job))), cancelMarkup(lang, job))
+	opts := &downloader.DownloadOptions{
+		OnProgress: progress.Update,
+		Clip:       jobClip(job),
+		Subtitles:  jobSubtitles(job),
+		Thumbnail:  mode == models.ModeVideo,
+	}
+	videoInfo, err := h.downloader.DownloadWithQualityInfo(ctx, videoID, quality, opts)
+	progress.Stop()
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("[LINK] Download failed: %v", err)
+		editMsg := tgbotapi.NewEditMessageText(chatID, messageID, h.statusText(job, downloadErrorText(lang, err)))
+		bot.Send(editMsg)
+		return err
+	}
+	// Удаляем файлы после отправки и освобождаем место на диске для других загрузок
+	defer videoInfo.Cleanup()
+	files := videoInfo.Files()
+
+	log.Printf("[LINK] Download complete: %d file(s), sending to chat", len(files))
+	log.Printf("[LINK] Video metadata - Title: %s, Size: %dx%d, Duration: %ds, Compressed: %v",
+		videoInfo.Title, videoInfo.Width, videoInfo.Height, videoInfo.Duration, videoInfo.Compressed)
+
+	title := videoInfo.Title
+	if clip := jobClip(job); clip != nil {
+		title = "✂️ " + clipLabel(lang, clip) + " · " + title
+	}
+	caption := videoCaption(settings.Caption, title, videoInfo.Description)
+
+	uploadingMsg := tgbotapi.NewEditMessageText(chatID, messageID, h.statusText(job, tr(lang, "link.uploading")))
+	bot.Send(uploadingMsg)
+
+	for i, path := range files {
+		// Проверяем размер скачанного файла
+		fileInfo, err := os.Stat(path)
+		if err != nil {
+			log.Printf("[LINK] Failed to get file info: %v", err)
+			editMsg := tgbotapi.NewEditMessageText(chatID, messageID, h.statusText(job, tr(lang, "link.file_error")))
+			bot.Send(editMsg)
+			return err
+		}
+
+		sizeMB := float64(fileInfo.Size()) / (1024 * 1024)
+		log.Printf("[LINK] File size: %.2f MB", sizeMB)
+
+		partCaption := caption
+		if len(files) > 1 {
+			partTitle := videoInfo.Title
+			if settings.Caption == models.CaptionNone {
+				partTitle = ""
+			}
+			partCaption = formatPartCaption(lang, i+1, len(files), partTitle)
+		}
+
+		// MKV отправляем файлом и в режиме видео, встроенный плеер его не показывает
+		fileMode := mode
+		if mode == models.ModeVideo && !playsInline(path) {
+			log.Printf("[LINK] %s does not play inline, sending it as a document", filepath.Base(path))
+			fileMode = models.ModeDocument
+		}
+
+		var sent tgbotapi.Message
+		if fileMode == models.ModeVideo {
+			bot.Send(tgbotapi.NewChatAction(chatID, tgbotapi.ChatUploadVideo))
+
+			// Отправляем видео со встроенным плеером
+			upload := videoUpload{
+				ChatID:    chatID,
+				Path:      path,
+				Caption:   partCaption,
+				Thumbnail: videoInfo.Thumbnail,
+				Width:     videoInfo.Width,
+				Height:    videoInfo.Height,
+				Duration:  videoInfo.Duration,
+			}
+			// Длительность частей неизвестна, Telegram определит её сам
+			if len(files) > 1 {
+				upload.Duration = 0
+			}
+			sent, err = sendVideo(bot, upload)
+		} else {
+			// Обновляем действие перед отправкой
+			uploadAction := tgbotapi.NewChatAction(chatID, tgbotapi.ChatUploadDocument)
+			bot.Send(uploadAction)
+
+			// Отправляем видео как документ (файл)
+			docMsg := tgbotapi.NewDocument(chatID, tgbotapi.FilePath(path))
+			docMsg.Caption = partCaption
+			sent, err = bot.Send(docMsg)
+		}
+		if err != nil {
+			log.Printf("[LINK] Failed to send %s: %v", fileMode, err)
+			editMsg := tgbotapi.NewEditMessageText(chatID, messageID, h.statusText(job, tr(lang, "link.video_failed")))
+			bot.Send(editMsg)
+			return err
+		}
+
+		// Части разрезанного видео не кэшируем - переотправить их одним file_id нельзя.
+		// Подпись кэшируется полной, при переотправке её урезают по настройкам получателя.
+		if len(files) == 1 {
+			h.cacheFile(job, fileMode, sent, &models.CachedFile{
+				Title:         videoInfo.Title,
+				Caption:       formatCaption(videoInfo.Title, videoInfo.Description),
+				Compressed:    videoInfo.Compressed,
+				FileSizeBytes: fileInfo.Size(),
+			})
+		}
+
+		log.Printf("[LINK] Video sent successfully: %s (part %d/%d)", videoID, i+1, len(files))
+
+		// Записываем скачивание в БД
+		if user != nil {
+			download := &models.VideoDownload{
+				UserID:        user.ID,
+				VideoID:       videoID,
+				VideoURL:      h.sources.URL(videoID),
+				VideoTitle:    videoInfo.Title,
+				Quality:       string(quality),
+				Compressed:    videoInfo.Compressed,
+				FileSizeBytes: fileInfo.Size(),
+				PartNumber:    i + 1,
+				PartCount:     len(files),
+				PlaylistID:    h.playlistOf(job),
+				Clip:          job.Clip,
+				ExecutedAt:    time.Now(),
+			}
+			if err := h.videoRepo.RecordDownload(download); err != nil {
+				log.Printf("[LINK] Failed to record download: %v", err)
+			}
+		}
+	}
+
+	// Субтитры файлом приходят следом за видео
+	if videoInfo.Subtitles != "" {
+		sendSubtitles(bot, lang, job, videoInfo.Subtitles)
+	}
+
+	// Отмечаем в статусном сообщении, что видео отправлено
+	doneMsg := tgbotapi.NewEditMessageText(chatID, messageID, h.statusText(job, trf(lang, "link.video_sent", quality)))
+	bot.Send(doneMsg)
+
+	return nil
+}
+
+// processAudioJob downloads the audio track and sends it with sendAudio
+func (h *LinkHandler) processAudioJob(ctx context.Context, bot botpkg.Sender, job *models.DownloadJob) error {
+	chatID := job.ChatID
+	messageID := job.MessageID
+	videoID := job.VideoID
+	settings := userSettings(h.settingsRepo, job.TelegramUserID)
+	lang := settings.Language
+
+	if h.sendCached(bot, job, models.ModeAudio, settings) {
+		return nil
+	}
+
+	actionCfg := tgbotapi.NewChatAction(chatID, tgbotapi.ChatUploadVoice)
+	bot.Send(actionCfg)
+
+	log.Printf("[LINK] Starting audio download: %s", videoID)
+	progress := newProgressReporter(bot, chatID, messageID, lang, h.statusText(job, trf(lang, "link.status", jobSubject(lang, job))), cancelMarkup(lang, job))
+	opts := &downloader.DownloadOptions{OnProgress: progress.Update, Clip: jobClip(job)}
+	audioInfo, err := h.downloader.DownloadAudio(ctx, videoID, opts)
+	progress.Stop()
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("[LINK] Audio download failed: %v", err)
+		editMsg := tgbotapi.NewEditMessageText(chatID, messageID, h.statusText(job, downloadErrorText(lang, err)))
+		bot.Send(editMsg)
+		return err
+	}
+	defer audioInfo.Cleanup()
+
+	log.Printf("[LINK] Audio metadata - Title: %s, Performer: %s, Duration: %ds",
+		audioInfo.Title, audioInfo.Performer, audioInfo.Duration)
+
+	fileInfo, err := os.Stat(audioInfo.FilePath)
+	if err != nil {
+		log.Printf("[LINK] Failed to get file info: %v", err)
+		editMsg := tgbotapi.NewEditMessageText(chatID, messageID, h.statusText(job, tr(lang, "link.file_error")))
+		bot.Send(editMsg)
+		return err
+	}
+
+	audioMsg := tgbotapi.NewAudio(chatID, tgbotapi.FilePath(audioInfo.FilePath))
+	audioMsg.Title = audioInfo.Title
+	audioMsg.Performer = audioInfo.Performer
+	audioMsg.Duration = audioInfo.Duration
+
+	sent, err := bot.Send(audioMsg)
+	if err != nil {
+		log.Printf("[LINK] Failed to send audio: %v", err)
+		editMsg := tgbotapi.NewEditMessageText(chatID, messageID, h.statusText(job, tr(lang, "link.audio_failed")))
+		bot.Send(editMsg)
+		return err
+	}
+
+	h.cacheFile(job, models.ModeAudio, sent, &models.CachedFile{
+		Title:         audioInfo.Title,
+		FileSizeBytes: fileInfo.Size(),
+	})
+
+	log.Printf("[LINK] Audio sent successfully: %s", videoID)
+
+	if user, err := h.userRepo.GetByTelegramID(job.TelegramUserID); err == nil && user != nil {
+		download := &models.VideoDownload{
+			UserID:        user.ID,
+			VideoID:       videoID,
+			VideoURL:      h.sources.URL(videoID),
+			VideoTitle:    audioInfo.Title,
+			Quality:       string(downloader.QualityAudio),
+			FileSizeBytes: fileInfo.Size(),
+			PlaylistID:    h.playlistOf(job),
+			Clip:          job.Clip,
+			ExecutedAt:    time.Now(),
+		}
+		if err := h.videoRepo.RecordDownload(download); err != nil {
+			log.Printf("[LINK] Failed to record download: %v", err)
+		}
+	}
+
+	doneMsg := tgbotapi.NewEditMessageText(chatID, messageID, h.statusText(job, tr(lang, "link.audio_sent")))
+	bot.Send(doneMsg)
+
+	return nil
+}
+
+// sendCached resends a file previously uploaded to Telegram by its file_id.
+// It returns false if nothing is cached or the cached file could not be sent,
+// in which case the caller downloads the video as usual.
+func (h *LinkHandler) sendCached(bot botpkg.Sender, job *models.DownloadJob, mode string, settings *models.UserSettings) bool {
+	if !cacheable(job) {
+		return false
+	}
+
+	cached, err := h.fileRepo.Get(job.VideoID, job.Quality, mode)
+	if err != nil {
+		log.Printf("[LINK] Failed to look up file cache: %v", err)
+		return false
+	}
+	if cached == nil {
+		return false
+	}
+
+	log.Printf("[LINK] Cache hit for %s (%s, %s), resending file_id", job.VideoID, job.Quality, mode)
+
+	file := tgbotapi.FileID(cached.FileID)
+	var msg tgbotapi.Chattable
+	switch mode {
+	case models.ModeAudio:
+		msg = tgbotapi.NewAudio(job.ChatID, file)
+	case models.ModeVideo:
+		videoMsg := tgbotapi.NewVideo(job.ChatID, file)
+		videoMsg.Caption = cachedCaption(settings.Caption, cached)
+		videoMsg.SupportsStreaming = true
+		msg = videoMsg
+	default:
+		docMsg := tgbotapi.NewDocument(job.ChatID, file)
+		docMsg.Caption = cachedCaption(settings.Caption, cached)
+		msg = docMsg
+	}
+
+	if _, err := bot.Send(msg); err != nil {
+		log.Printf("[LINK] Failed to resend cached file: %v", err)
+		if isStaleFileError(err) {
+			log.Printf("[LINK] Invalidating stale file_id for %s (%s, %s)", job.VideoID, job.Quality, mode)
+			if err := h.fileRepo.Delete(job.VideoID, job.Quality, mode); err != nil {
+				log.Printf("[LINK] Failed to invalidate file cache: %v", err)
+			}
+		}
+		return false
+	}
+
+	if user, err := h.userRepo.GetByTelegramID(job.TelegramUserID); err == nil && user != nil {
+		download := &models.VideoDownload{
+			UserID:        user.ID,
+			VideoID:       job.VideoID,
+			VideoURL:      h.sources.URL(job.VideoID),
+			VideoTitle:    cached.Title,
+			Quality:       job.Quality,
+			Compressed:    cached.Compressed,
+			FileSizeBytes: cached.FileSizeBytes,
+			PlaylistID:    h.playlistOf(job),
+			Clip:          job.Clip,
+			ExecutedAt:    time.Now(),
+		}
+		if err := h.videoRepo.RecordDownload(download); err != nil {
+			log.Printf("[LINK] Failed to record download: %v", err)
+		}
+	}
+
+	doneMsg := tgbotapi.NewEditMessageText(job.ChatID, job.MessageID, h.statusText(job, trf(settings.Language, "link.sent", qualityLabel(settings.Language, downloader.Quality(job.Quality)))))
+	bot.Send(doneMsg)
+
+	return true
+}
+
+// cacheFile remembers the file_id of a sent message for the job's video
+func (h *LinkHandler) cacheFile(job *models.DownloadJob, mode string, sent tgbotapi.Message, file *models.CachedFile) {
+	if !cacheable(job) {
+		return
+	}
+
+	fileID := sentFileID(sent)
+	if fileID == "" {
+		log.Printf("[LINK] No file_id in sent message, skipping cache")
+		return
+	}
+
+	file.VideoID = job.VideoID
+	file.Quality = job.Quality
+	file.Mode = mode
+	file.FileID = fileID
+
+	if err := h.fileRepo.Save(file); err != nil {
+		log.Printf("[LINK] Failed to cache file_id: %v", err)
+	}
+}
+
+// cacheable reports whether the job downloads what the file cache stores: the
+// whole video without subtitles
+func cacheable(job *models.DownloadJob) bool {
+	return job.Clip == "" && job.Subtitles == ""
+}
+
+// sentFileID extracts file_id of the media attached to a sent message
+func sentFileID(msg tgbotapi.Message) string {
+	switch {
+	case msg.Document != nil:
+		return msg.Document.FileID
+	case msg.Audio != nil:
+		return msg.Audio.FileID
+	case msg.Video != nil:
+		return msg.Video.FileID
+	}
+	return ""
+}
+
+// isStaleFileError reports whether Telegram rejected a file_id that is no longer valid
+func isStaleFileError(err error) bool {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	message := strings.ToLower(apiErr.Message)
+	for _, marker := range []string{"wrong file identifier", "file_id", "file reference", "wrong remote file", "file_reference"} {
+		if strings.Contains(message, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// qualityLabel returns a short human readable name of the quality
+func qualityLabel(lang string, quality downloader.Quality) string {
+	if quality == downloader.QualityAudio {
+		return tr(lang, "subject.audio")
+	}
+	return string(quality)
+}
+
+// downloadSubject describes what is being downloaded for status messages
+func downloadSubject(lang string, quality downloader.Quality) string {
+	if quality == downloader.QualityAudio {
+		return tr(lang, "subject.audio")
+	}
+	return trf(lang, "subject.video", quality)
+}
+
+// formatLabel returns the keyboard button of a format. Descriptions of video
+// formats are sizes only, the audio one is named in the user's language.
+func formatLabel(lang string, f downloader.VideoFormat) string {
+	if f.Quality != downloader.QualityAudio {
+		return f.Description
+	}
+	label := tr(lang, "format.audio")
+	if sizeMB := f.Size / (1024 * 1024); sizeMB > 0 {
+		label += fmt.Sprintf(" (~%dMB)", sizeMB)
+	}
+	return label
+}
+
+// formatCaption builds a document caption from the video title and description
+func formatCaption(title, description string) string {
+	caption := title
+	if description != "" {
+		// Ограничиваем описание до 200 символов
+		desc := description
+		if len(desc) > 200 {
+			desc = desc[:200] + "..."
+		}
+		caption += "\n\n" + desc
+	}
+
+	// Telegram caption limit is 1024 characters
+	if len(caption) > 1024 {
+		caption = caption[:1021] + "..."
+	}
+	return caption
+}
+
+// videoCaption builds the caption of a video in the style the user chose in settings
+func videoCaption(style, title, description string) string {
+	switch style {
+	case models.CaptionNone:
+		return ""
+	case models.CaptionTitle:
+		return formatCaption(title, "")
+	}
+	return formatCaption(title, description)
+}
+
+// cachedCaption cuts the full caption of a cached file down to the user's style
+func cachedCaption(style string, cached *models.CachedFile) string {
+	if style == models.CaptionFull || style == "" {
+		return cached.Caption
+	}
+	return videoCaption(style, cached.Title, "")
+}
+
+// formatPartCaption builds a caption for one part of a split video
+func formatPartCaption(lang string, part, total int, title string) string {
+	caption := trf(lang, "link.part", part, total)
+	if title != "" {
+		caption += " — " + title
+	}
+	if len(caption) > 1024 {
+		caption = caption[:1021] + "..."
+	}
+	return caption
+}
+
+// parseQualityCallback parses yt:<videoID>[@<clip>]:<quality> callback data
+func parseQualityCallback(data string) (videoID, clip string, quality downloader.Quality, ok bool) {
+	data, ok = strings.CutPrefix(data, qualityCallbackPrefix)
+	if !ok {
+		return "", "", "", false
+	}
+	i := strings.LastIndex(data, ":")
+	if i <= 0 || i == len(data)-1 {
+		return "", "", "", false
+	}
+	videoID, clip, hasClip := strings.Cut(data[:i], clipSeparator)
+	if hasClip {
+		if _, valid := downloader.ParseClip(clip); !valid || videoID == "" {
+			return "", "", "", false
+		}
+	}
+	return videoID, clip, downloader.Quality(data[i+1:]), true
+}
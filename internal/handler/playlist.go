@@ -0,0 +1,337 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	botpkg "github.com/artur/solid-spoon/internal/bot"
+	"github.com/artur/solid-spoon/internal/database/models"
+	"github.com/artur/solid-spoon/internal/downloader"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// playlistCallbackPrefix - префикс callback data кнопок качества плейлиста: pl:<batchID>:<quality>
+const playlistCallbackPrefix = "pl:"
+
+// maxPlaylistItems - сколько видео плейлиста можно скачать за один раз
+const maxPlaylistItems = 50
+
+// playlistQualities are offered for a whole playlist. Formats differ from
+// video to video, each one is downloaded in the best quality up to the chosen.
+var playlistQualities = []downloader.Quality{
+	downloader.QualityLow,
+	downloader.QualityMedium,
+	downloader.QualityHigh,
+	downloader.QualityFull,
+	downloader.QualityAudio,
+}
+
+// playlistRangePattern matches the range of videos sent after the link, e.g. "1-10"
+var playlistRangePattern = regexp.MustCompile(`(?:^|\s)(\d+)\s*[-–—]\s*(\d+)(?:\s|$)`)
+
+// parsePlaylistRange returns the 1-based range of videos to download from a
+// playlist of count videos. Without a range in text the first videos are
+// taken; ok is false if the range is outside of the playlist.
+func parsePlaylistRange(text string, count int) (first, last int, ok bool) {
+	first, last = 1, count
+	if m := playlistRangePattern.FindStringSubmatch(text); m != nil {
+		first, _ = strconv.Atoi(m[1])
+		last, _ = strconv.Atoi(m[2])
+		if first > last {
+			first, last = last, first
+		}
+		if first < 1 || first > count {
+			return 0, 0, false
+		}
+		last = min(last, count)
+	}
+	last = min(last, first+maxPlaylistItems-1)
+	return first, last, true
+}
+
+// handlePlaylist shows the playlist and asks for the quality of its videos
+func (h *LinkHandler) handlePlaylist(ctx context.Context, bot botpkg.Sender, update tgbotapi.Update, link downloader.Link) {
+	chatID := update.Message.Chat.ID
+	playlistID := link.VideoID()
+
+	log.Printf("[LINK] Processing playlist %s for chat: %d", playlistID, chatID)
+
+	settings := userSettings(h.settingsRepo, update.Message.From.ID)
+	lang := settings.Language
+
+	fetcher, ok := h.downloader.(downloader.PlaylistFetcher)
+	if !ok {
+		bot.Send(tgbotapi.NewMessage(chatID, tr(lang, "playlist.unsupported")))
+		return
+	}
+
+	bot.Send(tgbotapi.NewChatAction(chatID, tgbotapi.ChatTyping))
+
+	ctx, cancel := context.WithTimeout(ctx, formatsTimeout)
+	defer cancel()
+	playlist, err := fetcher.GetPlaylist(ctx, playlistID)
+	if err != nil {
+		log.Printf("[LINK] Failed to get playlist: %v", err)
+		bot.Send(tgbotapi.NewMessage(chatID, downloadErrorText(lang, err)))
+		return
+	}
+
+	count := len(playlist.Entries)
+	first, last, ok := parsePlaylistRange(update.Message.Text, count)
+	if !ok {
+		bot.Send(tgbotapi.NewMessage(chatID, trf(lang, "playlist.out_of_range", count, count)))
+		return
+	}
+
+	log.Printf("[LINK] Playlist %s has %d videos, selected %d-%d", playlistID, count, first, last)
+
+	batch := &models.DownloadBatch{
+		TelegramUserID: update.Message.From.ID,
+		PlaylistID:     playlistID,
+		Title:          playlist.Title,
+		FirstItem:      first,
+		LastItem:       last,
+	}
+	if err := h.jobRepo.CreateBatch(batch); err != nil {
+		log.Printf("[LINK] Failed to persist batch: %v", err)
+		bot.Send(tgbotapi.NewMessage(chatID, tr(lang, "playlist.failed")))
+		return
+	}
+
+	var buttons [][]tgbotapi.InlineKeyboardButton
+	for _, quality := range playlistQualities {
+		label := string(quality)
+		if quality == downloader.QualityAudio {
+			label = tr(lang, "format.audio")
+		}
+		callbackData := fmt.Sprintf("%s%d:%s", playlistCallbackPrefix, batch.ID, quality)
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(label, callbackData)))
+	}
+
+	text := trf(lang, "playlist.info", playlistTitle(lang, batch), count, first, last)
+	if count > last-first+1 {
+		text += "\n\n" + tr(lang, "playlist.range_hint")
+	}
+	text += "\n\n" + tr(lang, "link.choose_quality")
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons...)
+	if _, err := bot.Send(msg); err != nil {
+		log.Printf("[LINK] Failed to send playlist quality selection: %v", err)
+	}
+
+	deleteLink(bot, update.Message, settings)
+}
+
+// handlePlaylistCallback creates a job for every selected video of the
+// playlist and downloads them one by one
+func (h *LinkHandler) handlePlaylistCallback(ctx context.Context, bot botpkg.Sender, callback *tgbotapi.CallbackQuery) {
+	batchID, quality, ok := parsePlaylistCallback(callback.Data)
+	if !ok {
+		log.Printf("[LINK] Invalid playlist callback data: %s", callback.Data)
+		return
+	}
+	lang := h.language(callback.From.ID)
+
+	batch, err := h.jobRepo.GetBatch(batchID)
+	if err != nil {
+		log.Printf("[LINK] Failed to load batch %d: %v", batchID, err)
+	}
+	if batch == nil {
+		bot.Send(tgbotapi.NewCallback(callback.ID, tr(lang, "link.stale_button")))
+		return
+	}
+	if batch.TelegramUserID != callback.From.ID {
+		bot.Send(tgbotapi.NewCallback(callback.ID, tr(lang, "playlist.not_owner")))
+		return
+	}
+	// Повторное нажатие не должно запускать плейлист второй раз
+	if progress, err := h.jobRepo.BatchProgress(batch.ID); err != nil || progress.Total > 0 {
+		bot.Send(tgbotapi.NewCallback(callback.ID, tr(lang, "playlist.started")))
+		return
+	}
+
+	log.Printf("[LINK] Callback: downloading playlist %s (%d-%d) in %s quality", batch.PlaylistID, batch.FirstItem, batch.LastItem, quality)
+
+	bot.Send(tgbotapi.NewCallback(callback.ID, trf(lang, "playlist.downloading", qualityLabel(lang, quality))))
+
+	chatID := callback.Message.Chat.ID
+	messageID := callback.Message.MessageID
+	bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, "📃 "+playlistTitle(lang, batch)+"\n\n"+tr(lang, "playlist.fetching")))
+
+	// Список видео запрашиваем заново: кнопку могли нажать сильно позже, чем прислали ссылку
+	fetchCtx, cancel := context.WithTimeout(ctx, formatsTimeout)
+	defer cancel()
+	fetcher, ok := h.downloader.(downloader.PlaylistFetcher)
+	if !ok {
+		bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, tr(lang, "playlist.unsupported")))
+		return
+	}
+	playlist, err := fetcher.GetPlaylist(fetchCtx, batch.PlaylistID)
+	if err != nil {
+		log.Printf("[LINK] Failed to get playlist: %v", err)
+		bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, downloadErrorText(lang, err)))
+		return
+	}
+
+	if batch.FirstItem > len(playlist.Entries) {
+		bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, downloadErrorText(lang, downloader.ErrEmptyPlaylist)))
+		return
+	}
+	entries := playlist.Entries[batch.FirstItem-1 : min(batch.LastItem, len(playlist.Entries))]
+
+	for _, entry := range entries {
+		job := &models.DownloadJob{
+			TelegramUserID: callback.From.ID,
+			ChatID:         chatID,
+			MessageID:      messageID,
+			VideoID:        entry.VideoID,
+			Quality:        string(quality),
+			BatchID:        batch.ID,
+		}
+		if err := h.jobRepo.Create(job); err != nil {
+			log.Printf("[LINK] Failed to persist playlist job %s: %v", entry.VideoID, err)
+		}
+	}
+
+	run := func() { h.runBatch(bot, batch, chatID, messageID) }
+	// Видео, не дождавшиеся воркера до остановки, остаются в очереди в БД
+	drop := func() {
+		bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, tr(lang, "job.interrupted")))
+	}
+	position, err := scheduleDownload(ctx, batch.TelegramUserID, run, drop)
+	if err != nil {
+		log.Printf("[LINK] Failed to schedule batch %d: %v", batch.ID, err)
+		if err := h.jobRepo.CancelBatch(batch.ID); err != nil {
+			log.Printf("[LINK] Failed to cancel batch %d: %v", batch.ID, err)
+		}
+		bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, tr(lang, "link.overloaded")))
+		return
+	}
+	if position > 0 {
+		log.Printf("[LINK] Batch %d queued at position %d", batch.ID, position)
+		text := "📃 " + playlistTitle(lang, batch) + "\n\n" + trf(lang, "link.queued", position)
+		bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, text))
+	}
+}
+
+// runBatch downloads queued videos of the batch one after another and sums up
+// the result in the status message. Videos left after a shutdown stay queued
+// and are picked up by Resume.
+func (h *LinkHandler) runBatch(bot botpkg.Sender, batch *models.DownloadBatch, chatID int64, messageID int) {
+	lang := h.language(batch.TelegramUserID)
+	for {
+		job, err := h.jobRepo.NextInBatch(batch.ID)
+		if err != nil {
+			log.Printf("[LINK] Failed to get next job of batch %d: %v", batch.ID, err)
+			break
+		}
+		if job == nil {
+			break
+		}
+
+		progress, err := h.jobRepo.BatchProgress(batch.ID)
+		if err != nil {
+			log.Printf("[LINK] Failed to count batch %d progress: %v", batch.ID, err)
+		}
+
+		ctx := h.jobs.track(job)
+		h.jobs.setHeader(job.ID, batchHeader(lang, batch, progress))
+		editStatus(bot, lang, job, h.statusText(job, trf(lang, "link.status", jobSubject(lang, job))))
+
+		h.runJob(ctx, bot, job)
+
+		switch job.Status {
+		case models.JobQueued:
+			log.Printf("[LINK] Batch %d interrupted by shutdown", batch.ID)
+			return
+		case models.JobCancelled:
+			// Кнопка отмены под видео плейлиста останавливает весь плейлист
+			log.Printf("[LINK] Batch %d cancelled", batch.ID)
+			if err := h.jobRepo.CancelBatch(batch.ID); err != nil {
+				log.Printf("[LINK] Failed to cancel batch %d: %v", batch.ID, err)
+			}
+		}
+	}
+
+	progress, err := h.jobRepo.BatchProgress(batch.ID)
+	if err != nil {
+		log.Printf("[LINK] Failed to count batch %d progress: %v", batch.ID, err)
+	}
+	log.Printf("[LINK] Batch %d finished: %d done, %d failed, %d cancelled", batch.ID, progress.Done, progress.Failed, progress.Cancelled)
+
+	bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, batchSummary(lang, batch, progress)))
+}
+
+// statusText prefixes text with the playlist header for jobs of a batch
+func (h *LinkHandler) statusText(job *models.DownloadJob, text string) string {
+	if header := h.jobs.header(job.ID); header != "" {
+		return header + "\n\n" + text
+	}
+	return text
+}
+
+// playlistOf returns the playlist the job downloads a video of, "" for single videos
+func (h *LinkHandler) playlistOf(job *models.DownloadJob) string {
+	if job.BatchID == 0 {
+		return ""
+	}
+	batch, err := h.jobRepo.GetBatch(job.BatchID)
+	if err != nil || batch == nil {
+		log.Printf("[LINK] Failed to load batch %d: %v", job.BatchID, err)
+		return ""
+	}
+	return batch.PlaylistID
+}
+
+// batchHeader describes which video of the playlist is being downloaded
+func batchHeader(lang string, batch *models.DownloadBatch, progress models.BatchProgress) string {
+	header := trf(lang, "playlist.header", playlistTitle(lang, batch), progress.Finished()+1, progress.Total)
+	if progress.Failed > 0 {
+		header += trf(lang, "playlist.header_failed", progress.Failed)
+	}
+	return header
+}
+
+// batchSummary is the final status of a playlist download
+func batchSummary(lang string, batch *models.DownloadBatch, progress models.BatchProgress) string {
+	status := tr(lang, "playlist.done")
+	if progress.Cancelled > 0 {
+		status = tr(lang, "playlist.cancelled")
+	}
+
+	text := trf(lang, "playlist.summary", playlistTitle(lang, batch), status, progress.Done, progress.Total)
+	if progress.Failed > 0 {
+		text += trf(lang, "playlist.summary_failed", progress.Failed)
+	}
+	return text
+}
+
+// playlistTitle returns the playlist title for status messages
+func playlistTitle(lang string, batch *models.DownloadBatch) string {
+	if batch.Title == "" {
+		return tr(lang, "playlist.untitled")
+	}
+	return batch.Title
+}
+
+// parsePlaylistCallback parses pl:<batchID>:<quality> callback data
+func parsePlaylistCallback(data string) (int64, downloader.Quality, bool) {
+	data, ok := strings.CutPrefix(data, playlistCallbackPrefix)
+	if !ok {
+		return 0, "", false
+	}
+	rawID, quality, ok := strings.Cut(data, ":")
+	if !ok || quality == "" {
+		return 0, "", false
+	}
+	batchID, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return batchID, downloader.Quality(quality), true
+}
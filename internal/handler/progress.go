@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	botpkg "github.com/artur/solid-spoon/internal/bot"
+	"github.com/artur/solid-spoon/internal/downloader"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// progressEditInterval - как часто можно редактировать статусное сообщение.
+// Telegram ограничивает частоту редактирования, чаще раза в пару секунд
+// начинаются ответы 429 Too Many Requests.
+const progressEditInterval = 3 * time.Second
+
+// progressBarWidth - количество символов в полоске прогресса
+const progressBarWidth = 10
+
+// progressReporter edits a status message with download progress, throttled
+// to respect Telegram edit rate limits: progress reported too early is shown
+// when the interval ends. Edits are sent from a goroutine of its own, so a
+// slow Telegram never holds up reading the downloader output.
+type progressReporter struct {
+	bot       botpkg.Sender
+	chatID    int64
+	messageID int
+	header    string
+	markup    *tgbotapi.InlineKeyboardMarkup
+	lang      string
+	interval  time.Duration
+
+	mu sync.Mutex
+	// pending - последний ещё не показанный прогресс, новый заменяет его
+	pending *downloader.Progress
+	stopped bool
+	wake    chan struct{}
+	done    chan struct{}
+
+	// Трогает только горутина отправки
+	nextEdit time.Time
+	lastText string
+}
+
+// newProgressReporter creates a reporter showing progress in lang; markup,
+// if not nil, is kept under the message on every edit. The caller stops it
+// with Stop.
+func newProgressReporter(bot botpkg.Sender, chatID int64, messageID int, lang, header string, markup *tgbotapi.InlineKeyboardMarkup) *progressReporter {
+	r := &progressReporter{
+		bot:       bot,
+		chatID:    chatID,
+		messageID: messageID,
+		header:    header,
+		markup:    markup,
+		lang:      lang,
+		interval:  progressEditInterval,
+		wake:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Update is a downloader.ProgressFunc. It never waits for Telegram: progress
+// reported while an edit is in flight replaces the pending one.
+func (r *progressReporter) Update(p downloader.Progress) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stopped {
+		return
+	}
+	// Смену этапа (сжатие, нарезка) не затираем обычным прогрессом, её надо показать
+	if r.pending != nil && r.pending.Stage != downloader.StageDownload && p.Stage == downloader.StageDownload {
+		return
+	}
+	r.pending = &p
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Stop drops progress that is not shown yet and waits for the edit in
+// flight, so it cannot overwrite the status the caller sets next
+func (r *progressReporter) Stop() {
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		return
+	}
+	r.stopped = true
+	r.pending = nil
+	close(r.wake)
+	r.mu.Unlock()
+
+	<-r.done
+}
+
+func (r *progressReporter) run() {
+	defer close(r.done)
+
+	// throttled срабатывает, когда можно показать прогресс, отложенный интервалом
+	var throttled <-chan time.Time
+	for {
+		select {
+		case _, ok := <-r.wake:
+			if !ok {
+				return
+			}
+		case <-throttled:
+			throttled = nil
+		}
+
+		r.mu.Lock()
+		p := r.pending
+		r.pending = nil
+		r.mu.Unlock()
+		if p == nil {
+			continue
+		}
+
+		if wait := r.edit(*p); wait > 0 {
+			// Прогресс не теряется: если новее не пришло, покажем этот, когда истечёт интервал
+			r.mu.Lock()
+			if r.pending == nil {
+				r.pending = p
+			}
+			r.mu.Unlock()
+			throttled = time.After(wait)
+		}
+	}
+}
+
+// edit shows p, unless the edit has to wait: then it returns how long
+func (r *progressReporter) edit(p downloader.Progress) time.Duration {
+	// Смена этапа (сжатие, нарезка) показывается сразу, обычный прогресс - не чаще интервала
+	stageChange := p.Stage != downloader.StageDownload
+	if wait := time.Until(r.nextEdit); !stageChange && wait > 0 {
+		return wait
+	}
+
+	text := r.header + "\n\n" + formatProgress(r.lang, p)
+	if text == r.lastText {
+		return 0
+	}
+
+	editMsg := tgbotapi.NewEditMessageText(r.chatID, r.messageID, text)
+	editMsg.ReplyMarkup = r.markup
+	if _, err := r.bot.Send(editMsg); err != nil {
+		var apiErr *tgbotapi.Error
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+			log.Printf("[PROGRESS] Rate limited, retry after %ds", apiErr.RetryAfter)
+			r.nextEdit = time.Now().Add(time.Duration(apiErr.RetryAfter) * time.Second)
+			return time.Until(r.nextEdit)
+		}
+		log.Printf("[PROGRESS] Failed to edit status message: %v", err)
+	}
+
+	r.lastText = text
+	r.nextEdit = time.Now().Add(r.interval)
+	return 0
+}
+
+// formatProgress renders progress as a bar with speed and ETA
+func formatProgress(lang string, p downloader.Progress) string {
+	switch p.Stage {
+	case downloader.StageCompress:
+		return tr(lang, "progress.compress")
+	case downloader.StageSplit:
+		return tr(lang, "progress.split")
+	case downloader.StageBurn:
+		return tr(lang, "progress.burn")
+	case downloader.StageWait:
+		return tr(lang, "progress.wait")
+	}
+
+	var lines []string
+	if p.TotalBytes > 0 {
+		lines = append(lines, fmt.Sprintf("%s %.0f%%", progressBar(p.Percent, progressBarWidth), p.Percent))
+		lines = append(lines, fmt.Sprintf("📦 %s / %s", formatBytes(lang, p.DownloadedBytes), formatBytes(lang, p.TotalBytes)))
+	} else {
+		lines = append(lines, "📦 "+formatBytes(lang, p.DownloadedBytes))
+	}
+
+	var details []string
+	if p.Speed > 0 {
+		details = append(details, "⚡ "+trf(lang, "progress.speed", formatBytes(lang, int64(p.Speed))))
+	}
+	if p.ETA > 0 {
+		details = append(details, "⏱ "+formatETA(p.ETA))
+	}
+	if len(details) > 0 {
+		lines = append(lines, strings.Join(details, " · "))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func progressBar(percent float64, width int) string {
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	filled := int(percent / 100 * float64(width))
+	return strings.Repeat("█", filled) + strings.Repeat("░", width-filled)
+}
+
+func formatBytes(lang string, n int64) string {
+	switch {
+	case n >= 1024*1024*1024:
+		return trf(lang, "unit.gb", float64(n)/(1024*1024*1024))
+	case n >= 1024*1024:
+		return trf(lang, "unit.mb", float64(n)/(1024*1024))
+	case n >= 1024:
+		return trf(lang, "unit.kb", float64(n)/1024)
+	default:
+		return trf(lang, "unit.b", n)
+	}
+}
+
+func formatETA(d time.Duration) string {
+	d = d.Round(time.Second)
+	h := int(d.Hours())
+	m := int(d.Minutes()) % 60
+	s := int(d.Seconds()) % 60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
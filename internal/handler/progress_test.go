@@ -0,0 +1,245 @@
+package handler
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/artur/solid-spoon/internal/database/models"
+	"github.com/artur/solid-spoon/internal/downloader"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestProgressBar(t *testing.T) {
+	tests := []struct {
+		percent  float64
+		expected string
+	}{
+		{0, "░░░░░░░░░░"},
+		{55, "█████░░░░░"},
+		{100, "██████████"},
+		{150, "██████████"},
+		{-5, "░░░░░░░░░░"},
+	}
+
+	for _, tt := range tests {
+		if got := progressBar(tt.percent, 10); got != tt.expected {
+			t.Errorf("progressBar(%v) = %q, want %q", tt.percent, got, tt.expected)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		bytes    int64
+		expected string
+	}{
+		{512, "512 Б"},
+		{2048, "2 КБ"},
+		{5 * 1024 * 1024, "5.0 МБ"},
+		{3 * 1024 * 1024 * 1024 / 2, "1.5 ГБ"},
+	}
+
+	for _, tt := range tests {
+		if got := formatBytes(models.LanguageRussian, tt.bytes); got != tt.expected {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.bytes, got, tt.expected)
+		}
+	}
+}
+
+func TestFormatETA(t *testing.T) {
+	tests := []struct {
+		eta      time.Duration
+		expected string
+	}{
+		{42 * time.Second, "0:42"},
+		{3*time.Minute + 5*time.Second, "3:05"},
+		{time.Hour + 2*time.Minute + 3*time.Second, "1:02:03"},
+	}
+
+	for _, tt := range tests {
+		if got := formatETA(tt.eta); got != tt.expected {
+			t.Errorf("formatETA(%v) = %q, want %q", tt.eta, got, tt.expected)
+		}
+	}
+}
+
+func TestFormatProgress(t *testing.T) {
+	tests := []struct {
+		name     string
+		lang     string
+		progress downloader.Progress
+		expected string
+	}{
+		{
+			name: "full progress",
+			progress: downloader.Progress{
+				Stage:           downloader.StageDownload,
+				Percent:         50,
+				DownloadedBytes: 5 * 1024 * 1024,
+				TotalBytes:      10 * 1024 * 1024,
+				Speed:           1024 * 1024,
+				ETA:             5 * time.Second,
+			},
+			expected: "█████░░░░░ 50%\n📦 5.0 МБ / 10.0 МБ\n⚡ 1.0 МБ/с · ⏱ 0:05",
+		},
+		{
+			name:     "unknown total",
+			progress: downloader.Progress{Stage: downloader.StageDownload, DownloadedBytes: 2048},
+			expected: "📦 2 КБ",
+		},
+		{
+			name:     "compression stage",
+			progress: downloader.Progress{Stage: downloader.StageCompress},
+			expected: "🗜 Сжимаю видео, чтобы оно поместилось в Telegram...",
+		},
+		{
+			name:     "waiting for disk space",
+			progress: downloader.Progress{Stage: downloader.StageWait},
+			expected: "💾 Жду, пока освободится место на диске...",
+		},
+		{
+			name: "english",
+			lang: models.LanguageEnglish,
+			progress: downloader.Progress{
+				Stage:           downloader.StageDownload,
+				Percent:         50,
+				DownloadedBytes: 5 * 1024 * 1024,
+				TotalBytes:      10 * 1024 * 1024,
+				Speed:           1024 * 1024,
+			},
+			expected: "█████░░░░░ 50%\n📦 5.0 MB / 10.0 MB\n⚡ 1.0 MB/s",
+		},
+		{
+			name:     "english compression stage",
+			lang:     models.LanguageEnglish,
+			progress: downloader.Progress{Stage: downloader.StageCompress},
+			expected: "🗜 Compressing the video to fit into Telegram...",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lang := tt.lang
+			if lang == "" {
+				lang = models.LanguageRussian
+			}
+			if got := formatProgress(lang, tt.progress); got != tt.expected {
+				t.Errorf("formatProgress() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+// slowSender blocks every Send until release is closed, like Telegram under load
+type slowSender struct {
+	release chan struct{}
+
+	mu    sync.Mutex
+	texts []string
+}
+
+func (s *slowSender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	<-s.release
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if edit, ok := c.(tgbotapi.EditMessageTextConfig); ok {
+		s.texts = append(s.texts, edit.Text)
+	}
+	return tgbotapi.Message{}, nil
+}
+
+func (s *slowSender) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	return &tgbotapi.APIResponse{Ok: true}, nil
+}
+
+func (s *slowSender) UploadFiles(endpoint string, params tgbotapi.Params, files []tgbotapi.RequestFile) (*tgbotapi.APIResponse, error) {
+	return &tgbotapi.APIResponse{Ok: true}, nil
+}
+
+func TestProgressReporter_SlowTelegramDoesNotBlock(t *testing.T) {
+	sender := &slowSender{release: make(chan struct{})}
+	r := newProgressReporter(sender, 1, 2, models.LanguageRussian, "header", nil)
+	r.interval = 0
+
+	updated := make(chan struct{})
+	go func() {
+		for i := 0; i <= 100; i++ {
+			r.Update(downloader.Progress{Stage: downloader.StageDownload, Percent: float64(i), TotalBytes: 100, DownloadedBytes: int64(i)})
+		}
+		close(updated)
+	}()
+
+	select {
+	case <-updated:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Update blocked on a slow Telegram")
+	}
+
+	close(sender.release)
+	want := "header\n\n" + formatProgress(models.LanguageRussian, downloader.Progress{Stage: downloader.StageDownload, Percent: 100, TotalBytes: 100, DownloadedBytes: 100})
+	lastText := func() (string, int) {
+		sender.mu.Lock()
+		defer sender.mu.Unlock()
+		if len(sender.texts) == 0 {
+			return "", 0
+		}
+		return sender.texts[len(sender.texts)-1], len(sender.texts)
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if last, _ := lastText(); last == want {
+			break
+		}
+	}
+	r.Stop()
+
+	// Пока висела первая правка, прогресс копился: вместо 100 правок показан только последний
+	last, edits := lastText()
+	if last != want {
+		t.Errorf("Expected the latest progress to be shown, got %q", last)
+	}
+	if edits > 2 {
+		t.Errorf("Expected at most two edits, got %d", edits)
+	}
+
+	// После Stop правок больше нет
+	r.Update(downloader.Progress{Stage: downloader.StageCompress})
+	if _, after := lastText(); after != edits {
+		t.Errorf("Expected no edits after Stop, got %d", after-edits)
+	}
+}
+
+func TestProgressReporter_ThrottledProgressIsShownLater(t *testing.T) {
+	sender := &slowSender{release: make(chan struct{})}
+	close(sender.release)
+	r := newProgressReporter(sender, 1, 2, models.LanguageRussian, "header", nil)
+	r.interval = 100 * time.Millisecond
+	defer r.Stop()
+
+	progress := func(percent int) downloader.Progress {
+		return downloader.Progress{Stage: downloader.StageDownload, Percent: float64(percent), TotalBytes: 100, DownloadedBytes: int64(percent)}
+	}
+	shown := func(p downloader.Progress) bool {
+		want := "header\n\n" + formatProgress(models.LanguageRussian, p)
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			sender.mu.Lock()
+			last := len(sender.texts) > 0 && sender.texts[len(sender.texts)-1] == want
+			sender.mu.Unlock()
+			if last {
+				return true
+			}
+		}
+		return false
+	}
+
+	r.Update(progress(10))
+	if !shown(progress(10)) {
+		t.Fatal("Expected the first progress to be shown")
+	}
+
+	// Прогресс внутри интервала, после него загрузчик молчит
+	r.Update(progress(50))
+	if !shown(progress(50)) {
+		t.Error("Expected the throttled progress to be shown after the interval")
+	}
+}
@@ -0,0 +1,788 @@
+package handler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode"
+
+	botpkg "github.com/artur/solid-spoon/internal/bot"
+	"github.com/artur/solid-spoon/internal/bot/bottest"
+	"github.com/artur/solid-spoon/internal/database"
+	"github.com/artur/solid-spoon/internal/database/models"
+	"github.com/artur/solid-spoon/internal/database/repository"
+	"github.com/artur/solid-spoon/internal/downloader"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	testVideoID = "dQw4w9WgXcQ"
+	testUserID  = 42
+)
+
+// fakeDownloader writes a small file instead of calling yt-dlp
+type fakeDownloader struct {
+	dir       string
+	formats   []downloader.VideoFormat
+	downloads []downloader.Quality
+	// clips - запрошенные фрагменты, nil для видео целиком
+	clips []*downloader.Clip
+	// subtitles - дорожки субтитров видео, chosen - выбранные в загрузках
+	subtitles []downloader.SubtitleTrack
+	chosen    []*downloader.Subtitles
+	// playlist возвращается для ссылок на плейлисты и каналы
+	playlist *downloader.Playlist
+	// err возвращается из всех загрузок, если задан
+	err error
+	// container - расширение скачанного видео, по умолчанию mp4
+	container string
+}
+
+func (d *fakeDownloader) file(name string) string {
+	path := filepath.Join(d.dir, name)
+	os.WriteFile(path, []byte("fake video content"), 0644)
+	return path
+}
+
+func (d *fakeDownloader) Download(ctx context.Context, videoID string) (string, func(), error) {
+	info, err := d.DownloadWithQualityInfo(ctx, videoID, downloader.QualityHigh, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	return info.FilePath, info.Cleanup, nil
+}
+
+func (d *fakeDownloader) DownloadWithQualityInfo(ctx context.Context, videoID string, quality downloader.Quality, opts *downloader.DownloadOptions) (*downloader.VideoInfo, error) {
+	d.downloads = append(d.downloads, quality)
+	if opts != nil {
+		d.clips = append(d.clips, opts.Clip)
+		d.chosen = append(d.chosen, opts.Subtitles)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	container := d.container
+	if container == "" {
+		container = "mp4"
+	}
+	info := &downloader.VideoInfo{
+		FilePath:    d.file("yt-" + videoID + "." + container),
+		Width:       1280,
+		Height:      720,
+		Duration:    212,
+		Title:       "Test Video",
+		Description: "Test description",
+	}
+	if opts != nil && opts.Thumbnail {
+		info.Thumbnail = d.file("yt-" + videoID + ".jpg")
+	}
+	if opts != nil && opts.Subtitles != nil && opts.Subtitles.Mode == downloader.SubtitlesFile {
+		info.Subtitles = d.file("yt-" + videoID + "." + opts.Subtitles.Lang + ".srt")
+	}
+	return info, nil
+}
+
+func (d *fakeDownloader) DownloadAudio(ctx context.Context, videoID string, opts *downloader.DownloadOptions) (*downloader.AudioInfo, error) {
+	d.downloads = append(d.downloads, downloader.QualityAudio)
+	return &downloader.AudioInfo{
+		FilePath:  d.file("yt-" + videoID + ".m4a"),
+		Title:     "Test Video",
+		Performer: "Test Channel",
+		Duration:  212,
+	}, nil
+}
+
+func (d *fakeDownloader) GetAvailableFormats(ctx context.Context, videoID string) ([]downloader.VideoFormat, error) {
+	return d.formats, nil
+}
+
+func (d *fakeDownloader) GetSubtitles(ctx context.Context, videoID string) ([]downloader.SubtitleTrack, error) {
+	return d.subtitles, nil
+}
+
+func (d *fakeDownloader) GetPlaylist(ctx context.Context, playlistID string) (*downloader.Playlist, error) {
+	if d.playlist == nil {
+		return nil, downloader.ErrEmptyPlaylist
+	}
+	return d.playlist, nil
+}
+
+// scenario wires the YouTube handler to the fake Bot API and an in-memory database
+type scenario struct {
+	t        *testing.T
+	srv      *bottest.Server
+	api      *tgbotapi.BotAPI
+	dl       *fakeDownloader
+	links    *LinkHandler
+	handle   botpkg.HandlerFunc
+	db       *database.DB
+	videos   *repository.VideoRepository
+	users    *repository.UserRepository
+	settings *repository.SettingsRepository
+	nextMsg  int
+	// ctx - контекст обновлений, в нём может быть планировщик загрузок
+	ctx context.Context
+}
+
+func newScenario(t *testing.T) *scenario {
+	t.Helper()
+
+	db, err := database.New(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	users := repository.NewUserRepository(db.DB)
+	videos := repository.NewVideoRepository(db.DB)
+	settings := repository.NewSettingsRepository(db.DB)
+	dl := &fakeDownloader{
+		dir: t.TempDir(),
+		formats: []downloader.VideoFormat{
+			{Quality: downloader.QualityLow, QualityNum: 360, Description: "📹 360p"},
+			{Quality: downloader.QualityHigh, QualityNum: 720, Description: "📹 720p"},
+			{Quality: downloader.QualityAudio, Description: "🎵 Аудио"},
+		},
+	}
+	h := NewLinkHandler(dl, downloader.DefaultRegistry(), users, videos, repository.NewJobRepository(db.DB), repository.NewFileCacheRepository(db.DB), settings)
+
+	srv := bottest.NewServer(t)
+	return &scenario{
+		t:        t,
+		srv:      srv,
+		api:      srv.API(t),
+		dl:       dl,
+		links:    h,
+		handle:   botpkg.Chain(h.Handle, botpkg.LoadUser(users)),
+		db:       db,
+		videos:   videos,
+		users:    users,
+		settings: settings,
+		nextMsg:  1,
+		ctx:      context.Background(),
+	}
+}
+
+// configure changes the test user's settings
+func (s *scenario) configure(change func(*models.UserSettings)) {
+	s.t.Helper()
+	settings, err := s.settings.Get(testUserID)
+	if err != nil {
+		s.t.Fatalf("Failed to load settings: %v", err)
+	}
+	change(settings)
+	if err := s.settings.Save(settings); err != nil {
+		s.t.Fatalf("Failed to save settings: %v", err)
+	}
+}
+
+var testUser = &tgbotapi.User{ID: testUserID, FirstName: "Test", UserName: "tester"}
+
+// sendText delivers a text message from the test user
+func (s *scenario) sendText(text string) {
+	s.nextMsg++
+	s.handle(s.ctx, s.api, tgbotapi.Update{
+		Message: &tgbotapi.Message{
+			MessageID: s.nextMsg,
+			Text:      text,
+			From:      testUser,
+			Chat:      &tgbotapi.Chat{ID: testUserID, Type: "private"},
+		},
+	})
+}
+
+// press delivers a press of the button with data on the bot message messageID
+func (s *scenario) press(messageID int, data string) {
+	s.handle(s.ctx, s.api, tgbotapi.Update{
+		CallbackQuery: &tgbotapi.CallbackQuery{
+			ID:   "cb",
+			From: testUser,
+			Data: data,
+			Message: &tgbotapi.Message{
+				MessageID: messageID,
+				Chat:      &tgbotapi.Chat{ID: testUserID, Type: "private"},
+			},
+		},
+	})
+}
+
+// qualityKeyboard sends the link and returns the ID of the quality selection message
+func (s *scenario) qualityKeyboard() int {
+	s.t.Helper()
+	s.sendText("https://youtu.be/" + testVideoID)
+
+	msg := s.srv.Last("sendMessage")
+	if msg == nil {
+		s.t.Fatal("Expected quality selection message")
+	}
+	return msg.MessageID
+}
+
+func TestScenario_LinkShowsQualityKeyboard(t *testing.T) {
+	s := newScenario(t)
+
+	s.sendText("Смотри https://www.youtube.com/watch?v=" + testVideoID)
+
+	msg := s.srv.Last("sendMessage")
+	if msg == nil {
+		t.Fatal("Expected quality selection message")
+	}
+	for _, data := range []string{"yt:" + testVideoID + ":360p", "yt:" + testVideoID + ":720p", "yt:" + testVideoID + ":audio"} {
+		if !strings.Contains(msg.Params["reply_markup"], data) {
+			t.Errorf("Expected button %q in keyboard: %s", data, msg.Params["reply_markup"])
+		}
+	}
+
+	deletions := s.srv.Deletions()
+	if len(deletions) != 1 || deletions[0].Int("message_id") != int64(s.nextMsg) {
+		t.Errorf("Expected the link message to be deleted, got %+v", deletions)
+	}
+}
+
+func TestScenario_PickQualityReceivesDocument(t *testing.T) {
+	s := newScenario(t)
+	keyboardID := s.qualityKeyboard()
+
+	s.press(keyboardID, "yt:"+testVideoID+":720p")
+
+	uploads := s.srv.Uploads()
+	if len(uploads) != 1 || uploads[0].Method != "sendDocument" {
+		t.Fatalf("Expected one uploaded document, got %+v", uploads)
+	}
+	if name := uploads[0].Files["document"].Name; name != "yt-"+testVideoID+".mp4" {
+		t.Errorf("Unexpected uploaded file name %q", name)
+	}
+	if caption := uploads[0].Params["caption"]; !strings.Contains(caption, "Test Video") {
+		t.Errorf("Expected title in caption, got %q", caption)
+	}
+	if text := s.srv.LastEditText(keyboardID); text != "✅ Видео отправлено (720p)" {
+		t.Errorf("Unexpected final status %q", text)
+	}
+	if len(s.dl.downloads) != 1 || s.dl.downloads[0] != downloader.QualityHigh {
+		t.Errorf("Expected one 720p download, got %v", s.dl.downloads)
+	}
+
+	user, err := s.users.GetByTelegramID(testUserID)
+	if err != nil || user == nil {
+		t.Fatalf("Expected user to be stored: %v", err)
+	}
+	if count, _ := s.videos.GetUserDownloadCount(user.ID); count != 1 {
+		t.Errorf("Expected 1 recorded download, got %d", count)
+	}
+
+	entries, _ := os.ReadDir(s.dl.dir)
+	if len(entries) != 0 {
+		t.Errorf("Expected downloaded file to be removed, %d left", len(entries))
+	}
+}
+
+func TestScenario_DownloadWaitsInQueue(t *testing.T) {
+	s := newScenario(t)
+	// Слот пользователя занят другой загрузкой
+	var queued func()
+	s.ctx = botpkg.WithSchedule(context.Background(), func(userID int64, task, onDrop func()) (int, error) {
+		queued = task
+		return 1, nil
+	})
+	keyboardID := s.qualityKeyboard()
+
+	s.press(keyboardID, "yt:"+testVideoID+":720p")
+
+	status := s.srv.Last("editMessageText")
+	if status == nil || status.Params["text"] != "⏳ Вы №1 в очереди, загрузка начнётся автоматически" {
+		t.Fatalf("Expected the place in the queue, got %+v", status)
+	}
+	if !strings.Contains(status.Params["reply_markup"], cancelCallbackPrefix) {
+		t.Errorf("Expected the cancel button under a queued download, got %q", status.Params["reply_markup"])
+	}
+
+	// Отмена работает, пока загрузка ждёт в очереди
+	s.press(keyboardID, "yt:cancel:1")
+	queued()
+
+	if uploads := s.srv.Uploads(); len(uploads) != 0 {
+		t.Errorf("Expected nothing to be uploaded, got %d", len(uploads))
+	}
+	if text := s.srv.LastEditText(keyboardID); text != "✖ Загрузка отменена" {
+		t.Errorf("Unexpected final status %q", text)
+	}
+}
+
+func TestScenario_EnglishUserSeesNoCyrillic(t *testing.T) {
+	s := newScenario(t)
+	s.configure(func(settings *models.UserSettings) { settings.Language = models.LanguageEnglish })
+	s.dl.subtitles = []downloader.SubtitleTrack{{Lang: "en", Name: "English"}}
+
+	messageID := s.qualityKeyboard()
+	s.press(messageID, "yt:"+testVideoID+":720p")
+	s.press(messageID, "sb:1:file:en")
+
+	if uploads := s.srv.Uploads(); len(uploads) != 2 {
+		t.Fatalf("Expected the video and the subtitles to be uploaded, got %+v", uploads)
+	}
+	if text := s.srv.LastEditText(messageID); text != "✅ Video sent (720p)" {
+		t.Errorf("Unexpected final status %q", text)
+	}
+	for _, r := range s.srv.Requests() {
+		for name, value := range r.Params {
+			if strings.ContainsFunc(value, func(c rune) bool { return unicode.Is(unicode.Cyrillic, c) }) {
+				t.Errorf("Russian text in %s %s: %q", r.Method, name, value)
+			}
+		}
+	}
+}
+
+func TestScenario_RepeatUsesCachedFile(t *testing.T) {
+	s := newScenario(t)
+	s.press(s.qualityKeyboard(), "yt:"+testVideoID+":720p")
+	s.srv.Reset()
+
+	keyboardID := s.qualityKeyboard()
+	s.press(keyboardID, "yt:"+testVideoID+":720p")
+
+	if uploads := s.srv.Uploads(); len(uploads) != 0 {
+		t.Errorf("Expected no upload for cached video, got %d", len(uploads))
+	}
+	doc := s.srv.Last("sendDocument")
+	if doc == nil || !strings.HasPrefix(doc.Params["document"], "file-") {
+		t.Fatalf("Expected document resent by file_id, got %+v", doc)
+	}
+	if len(s.dl.downloads) != 1 {
+		t.Errorf("Expected video to be downloaded once, got %d downloads", len(s.dl.downloads))
+	}
+	if text := s.srv.LastEditText(keyboardID); text != "✅ Отправлено (720p)" {
+		t.Errorf("Unexpected final status %q", text)
+	}
+}
+
+func TestScenario_VideoMode(t *testing.T) {
+	s := newScenario(t)
+	messageID := s.qualityKeyboard()
+	s.configure(func(settings *models.UserSettings) { settings.DeliveryMode = models.ModeVideo })
+
+	s.press(messageID, "yt:"+testVideoID+":720p")
+
+	video := s.srv.Last("sendVideo")
+	if video == nil {
+		t.Fatalf("Expected the video to be sent with sendVideo, got %+v", s.srv.Uploads())
+	}
+	if _, ok := video.Files["thumbnail"]; !ok {
+		t.Errorf("Expected a thumbnail to be uploaded, got %+v", video.Files)
+	}
+	for param, want := range map[string]string{"width": "1280", "height": "720", "duration": "212", "supports_streaming": "true"} {
+		if got := video.Params[param]; got != want {
+			t.Errorf("Expected %s=%s, got %q", param, want, got)
+		}
+	}
+	if !strings.Contains(video.Params["caption"], "Test Video") {
+		t.Errorf("Expected title in caption, got %q", video.Params["caption"])
+	}
+	if entries, _ := os.ReadDir(s.dl.dir); len(entries) != 0 {
+		t.Errorf("Expected the video and the thumbnail to be removed, got %d files", len(entries))
+	}
+
+	// Повтор переотправляет видео по file_id, а не документом
+	s.srv.Reset()
+	s.press(s.qualityKeyboard(), "yt:"+testVideoID+":720p")
+	if resent := s.srv.Last("sendVideo"); resent == nil || !strings.HasPrefix(resent.Params["video"], "file-") {
+		t.Errorf("Expected the video resent by file_id, got %+v", resent)
+	}
+	if len(s.dl.downloads) != 1 {
+		t.Errorf("Expected video to be downloaded once, got %d downloads", len(s.dl.downloads))
+	}
+}
+
+func TestScenario_VideoModeSendsMKVAsDocument(t *testing.T) {
+	s := newScenario(t)
+	s.dl.container = "mkv"
+	s.configure(func(settings *models.UserSettings) { settings.DeliveryMode = models.ModeVideo })
+
+	s.press(s.qualityKeyboard(), "yt:"+testVideoID+":720p")
+
+	uploads := s.srv.Uploads()
+	if len(uploads) != 1 || uploads[0].Method != "sendDocument" {
+		t.Fatalf("Expected MKV to be sent as a document, got %+v", uploads)
+	}
+	// В кэше файл записан документом, переотправка видео его не возьмёт
+	if cached, _ := s.links.fileRepo.Get(testVideoID, "720p", models.ModeVideo); cached != nil {
+		t.Errorf("Expected no cached video for a document, got %+v", cached)
+	}
+}
+
+func TestScenario_StaleFileIDIsReuploaded(t *testing.T) {
+	s := newScenario(t)
+	s.press(s.qualityKeyboard(), "yt:"+testVideoID+":720p")
+	s.srv.Reset()
+
+	s.srv.Fail("sendDocument", 400, "Bad Request: wrong file identifier/HTTP URL specified")
+	keyboardID := s.qualityKeyboard()
+	s.press(keyboardID, "yt:"+testVideoID+":720p")
+
+	if uploads := s.srv.Uploads(); len(uploads) != 1 {
+		t.Fatalf("Expected the video to be uploaded again, got %d uploads", len(uploads))
+	}
+	if len(s.dl.downloads) != 2 {
+		t.Errorf("Expected a second download, got %d", len(s.dl.downloads))
+	}
+	if text := s.srv.LastEditText(keyboardID); text != "✅ Видео отправлено (720p)" {
+		t.Errorf("Unexpected final status %q", text)
+	}
+}
+
+func TestScenario_UploadErrorIsNotShown(t *testing.T) {
+	s := newScenario(t)
+	s.srv.Fail("sendDocument", 413, "Request Entity Too Large")
+	keyboardID := s.qualityKeyboard()
+
+	s.press(keyboardID, "yt:"+testVideoID+":720p")
+
+	if text := s.srv.LastEditText(keyboardID); text != "❌ Не удалось отправить видео, попробуйте ещё раз позже" {
+		t.Errorf("Expected a fixed message without the Telegram error, got %q", text)
+	}
+}
+
+func TestScenario_PickAudio(t *testing.T) {
+	s := newScenario(t)
+	keyboardID := s.qualityKeyboard()
+
+	s.press(keyboardID, "yt:"+testVideoID+":audio")
+
+	audio := s.srv.Last("sendAudio")
+	if audio == nil || audio.Files["audio"].Size == 0 {
+		t.Fatalf("Expected uploaded audio, got %+v", audio)
+	}
+	if audio.Params["performer"] != "Test Channel" || audio.Params["duration"] != "212" {
+		t.Errorf("Unexpected audio metadata: %v", audio.Params)
+	}
+	if text := s.srv.LastEditText(keyboardID); text != "✅ Аудио отправлено" {
+		t.Errorf("Unexpected final status %q", text)
+	}
+}
+
+func TestScenario_DefaultQuality(t *testing.T) {
+	s := newScenario(t)
+	s.configure(func(settings *models.UserSettings) {
+		settings.DefaultQuality = string(downloader.QualityMedium)
+		settings.DeleteLink = false
+	})
+
+	s.sendText("https://youtu.be/" + testVideoID)
+
+	// 480p у видео нет - берётся ближайшее меньшее, без клавиатуры
+	status := s.srv.Last("sendMessage")
+	if status == nil || strings.Contains(status.Params["reply_markup"], "yt:") {
+		t.Fatalf("Expected a status message instead of the quality keyboard, got %+v", status)
+	}
+	if len(s.dl.downloads) != 1 || s.dl.downloads[0] != downloader.QualityLow {
+		t.Errorf("Expected one 360p download, got %v", s.dl.downloads)
+	}
+	if uploads := s.srv.Uploads(); len(uploads) != 1 {
+		t.Errorf("Expected one uploaded document, got %d", len(uploads))
+	}
+	if text := s.srv.LastEditText(status.MessageID); text != "✅ Видео отправлено (360p)" {
+		t.Errorf("Unexpected final status %q", text)
+	}
+	if deletions := s.srv.Deletions(); len(deletions) != 0 {
+		t.Errorf("Expected the link message to be kept, got %+v", deletions)
+	}
+}
+
+func TestScenario_AudioMode(t *testing.T) {
+	s := newScenario(t)
+	s.configure(func(settings *models.UserSettings) { settings.DeliveryMode = models.ModeAudio })
+
+	s.sendText("https://youtu.be/" + testVideoID)
+
+	if audio := s.srv.Last("sendAudio"); audio == nil {
+		t.Fatalf("Expected the audio to be sent right away, got %+v", s.srv.Uploads())
+	}
+	if len(s.dl.downloads) != 1 || s.dl.downloads[0] != downloader.QualityAudio {
+		t.Errorf("Expected one audio download, got %v", s.dl.downloads)
+	}
+	if deletions := s.srv.Deletions(); len(deletions) != 1 {
+		t.Errorf("Expected the link message to be deleted, got %+v", deletions)
+	}
+}
+
+func TestScenario_CaptionStyle(t *testing.T) {
+	s := newScenario(t)
+	s.configure(func(settings *models.UserSettings) { settings.Caption = models.CaptionTitle })
+
+	s.press(s.qualityKeyboard(), "yt:"+testVideoID+":720p")
+	if caption := s.srv.Last("sendDocument").Params["caption"]; caption != "Test Video" {
+		t.Errorf("Expected the title only, got %q", caption)
+	}
+
+	// В кэше полная подпись, при переотправке она урезается по настройкам
+	s.configure(func(settings *models.UserSettings) { settings.Caption = models.CaptionNone })
+	s.press(s.qualityKeyboard(), "yt:"+testVideoID+":720p")
+	if resent := s.srv.Last("sendDocument"); resent.Params["caption"] != "" {
+		t.Errorf("Expected no caption, got %q", resent.Params["caption"])
+	}
+
+	s.configure(func(settings *models.UserSettings) { settings.Caption = models.CaptionFull })
+	s.press(s.qualityKeyboard(), "yt:"+testVideoID+":720p")
+	if caption := s.srv.Last("sendDocument").Params["caption"]; caption != "Test Video\n\nTest description" {
+		t.Errorf("Expected the title and description, got %q", caption)
+	}
+	if len(s.dl.downloads) != 1 {
+		t.Errorf("Expected video to be downloaded once, got %d downloads", len(s.dl.downloads))
+	}
+}
+
+func TestScenario_DownloadErrorIsExplained(t *testing.T) {
+	s := newScenario(t)
+	s.dl.err = &downloader.Error{
+		Kind:   downloader.ErrAgeRestricted,
+		Stderr: "ERROR: [youtube] dQw4w9WgXcQ: Sign in to confirm your age",
+	}
+	keyboardID := s.qualityKeyboard()
+
+	s.press(keyboardID, "yt:"+testVideoID+":720p")
+
+	text := s.srv.LastEditText(keyboardID)
+	if !strings.Contains(text, "возрастным ограничением") {
+		t.Errorf("Expected age restriction to be explained, got %q", text)
+	}
+	for _, r := range s.srv.Requests() {
+		if strings.Contains(r.Params["text"], "Sign in") {
+			t.Errorf("Raw yt-dlp output leaked to user in %s: %q", r.Method, r.Params["text"])
+		}
+	}
+	if len(s.srv.Uploads()) != 0 {
+		t.Error("Nothing should be uploaded after a failed download")
+	}
+}
+
+func TestScenario_OtherSourceLink(t *testing.T) {
+	s := newScenario(t)
+
+	s.sendText("https://www.tiktok.com/@some.user/video/7301234567890123456")
+	keyboard := s.srv.Last("sendMessage")
+	if keyboard == nil || !strings.Contains(keyboard.Params["reply_markup"], "yt:tiktok:7301234567890123456:720p") {
+		t.Fatalf("Expected quality keyboard for the TikTok video, got %+v", keyboard)
+	}
+
+	s.press(keyboard.MessageID, "yt:tiktok:7301234567890123456:720p")
+
+	if uploads := s.srv.Uploads(); len(uploads) != 1 {
+		t.Fatalf("Expected one uploaded document, got %d", len(uploads))
+	}
+	if text := s.srv.LastEditText(keyboard.MessageID); text != "✅ Видео отправлено (720p)" {
+		t.Errorf("Unexpected final status %q", text)
+	}
+}
+
+func TestScenario_UnsupportedLinkIsIgnored(t *testing.T) {
+	s := newScenario(t)
+	h := NewLinkHandler(s.dl, downloader.DefaultRegistry(), s.users, s.videos, nil, nil, nil)
+
+	update := tgbotapi.Update{Message: &tgbotapi.Message{Text: "https://example.com/video/1", Chat: &tgbotapi.Chat{ID: 1}}}
+	if h.CanHandle(update) {
+		t.Error("Links of unknown sites must not be handled")
+	}
+}
+
+func TestScenario_Playlist(t *testing.T) {
+	s := newScenario(t)
+	s.dl.playlist = &downloader.Playlist{
+		Title: "Test Playlist",
+		Entries: []downloader.PlaylistEntry{
+			{VideoID: "aaaaaaaaaaa"},
+			{VideoID: "bbbbbbbbbbb"},
+			{VideoID: "ccccccccccc"},
+			{VideoID: "ddddddddddd"},
+		},
+	}
+
+	s.sendText("https://www.youtube.com/playlist?list=PLtest 2-3")
+
+	keyboard := s.srv.Last("sendMessage")
+	if keyboard == nil {
+		t.Fatal("Expected playlist quality selection message")
+	}
+	text := keyboard.Params["text"]
+	if !strings.Contains(text, "Test Playlist") || !strings.Contains(text, "Видео в плейлисте: 4") || !strings.Contains(text, "Будут скачаны: 2–3") {
+		t.Errorf("Unexpected playlist message %q", text)
+	}
+	if !strings.Contains(keyboard.Params["reply_markup"], `pl:1:720p`) {
+		t.Fatalf("Expected playlist quality buttons, got %s", keyboard.Params["reply_markup"])
+	}
+
+	s.press(keyboard.MessageID, "pl:1:720p")
+
+	uploads := s.srv.Uploads()
+	if len(uploads) != 2 {
+		t.Fatalf("Expected two uploaded videos, got %d", len(uploads))
+	}
+	if name := uploads[0].Files["document"].Name; name != "yt-bbbbbbbbbbb.mp4" {
+		t.Errorf("Expected the second video of the playlist first, got %q", name)
+	}
+
+	// Весь прогресс показывается в одном статусном сообщении
+	for _, edit := range s.srv.Edits() {
+		if edit.Int("message_id") != int64(keyboard.MessageID) {
+			t.Errorf("Unexpected edit of message %d", edit.Int("message_id"))
+		}
+	}
+	final := s.srv.LastEditText(keyboard.MessageID)
+	if !strings.Contains(final, "✅ Плейлист скачан") || !strings.Contains(final, "Отправлено: 2 из 2") {
+		t.Errorf("Unexpected final status %q", final)
+	}
+
+	var count int
+	s.db.QueryRow(`SELECT COUNT(*) FROM video_downloads WHERE playlist_id = ?`, "youtube-playlist:PLtest").Scan(&count)
+	if count != 2 {
+		t.Errorf("Expected 2 downloads recorded with the playlist, got %d", count)
+	}
+
+	// Повторное нажатие не запускает плейлист ещё раз
+	s.press(keyboard.MessageID, "pl:1:720p")
+	if len(s.srv.Uploads()) != 2 {
+		t.Error("Playlist must not be downloaded twice")
+	}
+}
+
+func TestScenario_PlaylistRangeOutOfBounds(t *testing.T) {
+	s := newScenario(t)
+	s.dl.playlist = &downloader.Playlist{Entries: []downloader.PlaylistEntry{{VideoID: "aaaaaaaaaaa"}}}
+
+	s.sendText("https://www.youtube.com/playlist?list=PLtest 5-10")
+
+	msg := s.srv.Last("sendMessage")
+	if msg == nil || !strings.Contains(msg.Params["text"], "всего 1 видео") {
+		t.Errorf("Expected range error, got %+v", msg)
+	}
+}
+
+func TestScenario_PlaylistResumedAfterRestart(t *testing.T) {
+	s := newScenario(t)
+	jobs := repository.NewJobRepository(s.db.DB)
+
+	batch := &models.DownloadBatch{TelegramUserID: testUserID, PlaylistID: "youtube-playlist:PLtest", Title: "Test Playlist", FirstItem: 1, LastItem: 3}
+	jobs.CreateBatch(batch)
+	var created []*models.DownloadJob
+	for _, videoID := range []string{"aaaaaaaaaaa", "bbbbbbbbbbb", "ccccccccccc"} {
+		job := &models.DownloadJob{TelegramUserID: testUserID, ChatID: testUserID, MessageID: 7, VideoID: videoID, Quality: "720p", BatchID: batch.ID}
+		jobs.Create(job)
+		created = append(created, job)
+	}
+	// Первое видео успели отправить, второе прервал перезапуск
+	jobs.MarkRunning(created[0])
+	jobs.Finish(created[0], models.JobDone, "")
+	jobs.MarkRunning(created[1])
+
+	var scheduled int
+	s.links.Resume(s.api, func(userID int64, task, onDrop func()) (int, error) {
+		scheduled++
+		task()
+		return 0, nil
+	})
+
+	if scheduled != 1 {
+		t.Errorf("Expected the playlist to be scheduled once, got %d", scheduled)
+	}
+	if uploads := s.srv.Uploads(); len(uploads) != 2 {
+		t.Fatalf("Expected the two remaining videos to be uploaded, got %d", len(uploads))
+	}
+	if text := s.srv.LastEditText(7); !strings.Contains(text, "Отправлено: 3 из 3") {
+		t.Errorf("Unexpected final status %q", text)
+	}
+}
+
+func TestScenario_Clip(t *testing.T) {
+	s := newScenario(t)
+
+	s.sendText("https://youtu.be/" + testVideoID + " 1:23-2:10")
+
+	keyboard := s.srv.Last("sendMessage")
+	if keyboard == nil || !strings.Contains(keyboard.Params["text"], "Фрагмент 1:23–2:10") {
+		t.Fatalf("Expected the fragment in the quality message, got %+v", keyboard)
+	}
+	data := "yt:" + testVideoID + "@83-130:720p"
+	if !strings.Contains(keyboard.Params["reply_markup"], data) {
+		t.Fatalf("Expected button %q, got %s", data, keyboard.Params["reply_markup"])
+	}
+
+	s.press(keyboard.MessageID, data)
+	// Фрагмент не должен попасть в кэш целого видео
+	s.press(s.qualityKeyboard(), "yt:"+testVideoID+":720p")
+
+	if len(s.dl.clips) != 2 || s.dl.clips[0] == nil || s.dl.clips[0].String() != "83-130" || s.dl.clips[1] != nil {
+		t.Errorf("Expected a clip and then the whole video to be downloaded, got %v", s.dl.clips)
+	}
+	if uploads := s.srv.Uploads(); len(uploads) != 2 || !strings.Contains(uploads[0].Params["caption"], "✂️ 1:23–2:10") {
+		t.Errorf("Expected the clip to be uploaded with its bounds in caption, got %+v", uploads)
+	}
+
+	var clip string
+	s.db.QueryRow(`SELECT clip FROM video_downloads ORDER BY id LIMIT 1`).Scan(&clip)
+	if clip != "83-130" {
+		t.Errorf("Expected clip bounds recorded, got %q", clip)
+	}
+}
+
+func TestScenario_SubtitlesFile(t *testing.T) {
+	s := newScenario(t)
+	s.dl.subtitles = []downloader.SubtitleTrack{
+		{Lang: "en", Name: "English"},
+		{Lang: "ru", Name: "Russian", Auto: true},
+	}
+
+	messageID := s.qualityKeyboard()
+	s.press(messageID, "yt:"+testVideoID+":720p")
+
+	if len(s.dl.downloads) != 0 {
+		t.Fatalf("Expected the download to wait for the subtitles choice, got %v", s.dl.downloads)
+	}
+	offer := s.srv.Last("editMessageText")
+	if offer == nil || !strings.Contains(offer.Params["text"], "субтитры") {
+		t.Fatalf("Expected subtitles to be offered, got %+v", offer)
+	}
+	markup := offer.Params["reply_markup"]
+	for _, data := range []string{"sb:1:file:en", "sb:1:burn:en", "sb:1:file:ru:auto", "sb:1:-"} {
+		if !strings.Contains(markup, data) {
+			t.Errorf("Expected button %q, got %s", data, markup)
+		}
+	}
+
+	s.press(messageID, "sb:1:file:en")
+
+	if len(s.dl.chosen) != 1 || s.dl.chosen[0] == nil || s.dl.chosen[0].String() != "file:en" {
+		t.Fatalf("Expected the video to be downloaded with English subtitles, got %v", s.dl.chosen)
+	}
+	uploads := s.srv.Uploads()
+	if len(uploads) != 2 {
+		t.Fatalf("Expected the video and the subtitles to be uploaded, got %+v", uploads)
+	}
+	if !strings.Contains(uploads[1].Params["caption"], "Субтитры (en)") {
+		t.Errorf("Expected subtitles caption, got %q", uploads[1].Params["caption"])
+	}
+
+	// Повторное нажатие устаревшей кнопки ничего не скачивает
+	s.press(messageID, "sb:1:file:en")
+	if len(s.dl.downloads) != 1 {
+		t.Errorf("Expected a stale button to be ignored, got %v", s.dl.downloads)
+	}
+}
+
+func TestScenario_WithoutSubtitles(t *testing.T) {
+	s := newScenario(t)
+	s.dl.subtitles = []downloader.SubtitleTrack{{Lang: "en", Name: "English"}}
+
+	messageID := s.qualityKeyboard()
+	s.press(messageID, "yt:"+testVideoID+":720p")
+	s.press(messageID, "sb:1:-")
+
+	if len(s.dl.chosen) != 1 || s.dl.chosen[0] != nil {
+		t.Fatalf("Expected the video to be downloaded without subtitles, got %v", s.dl.chosen)
+	}
+	if uploads := s.srv.Uploads(); len(uploads) != 1 {
+		t.Errorf("Expected only the video to be uploaded, got %+v", uploads)
+	}
+}
@@ -0,0 +1,248 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strings"
+
+	botpkg "github.com/artur/solid-spoon/internal/bot"
+	"github.com/artur/solid-spoon/internal/database/models"
+	"github.com/artur/solid-spoon/internal/database/repository"
+	"github.com/artur/solid-spoon/internal/downloader"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// settingsCallbackPrefix - префикс callback data меню настроек:
+// st:menu, st:open:<setting> и st:set:<setting>:<value>
+const settingsCallbackPrefix = "st:"
+
+// modeCallbackPrefix - префикс кнопок меню /mode до появления настроек: mode:<mode>.
+// Клавиатуры в старых сообщениях должны работать.
+const modeCallbackPrefix = "mode:"
+
+// Settings shown in the menu, they are part of callback data
+const (
+	settingQuality  = "quality"
+	settingMode     = "mode"
+	settingCaption  = "caption"
+	settingDelete   = "delete"
+	settingLanguage = "lang"
+)
+
+// settingOptions lists values of the settings chosen from a submenu
+var settingOptions = map[string][]string{
+	settingQuality: {"", string(downloader.QualityLow), string(downloader.QualityMedium), string(downloader.QualityHigh), string(downloader.QualityFull)},
+	settingMode:    {models.ModeDocument, models.ModeVideo, models.ModeAudio},
+	settingCaption: {models.CaptionFull, models.CaptionTitle, models.CaptionNone},
+	// Язык - настройка меню, подписи берутся из languageNames
+	settingLanguage: {models.LanguageRussian, models.LanguageEnglish},
+}
+
+// SettingsHandler shows the /settings menu. /mode opens its delivery mode
+// section directly.
+type SettingsHandler struct {
+	settingsRepo *repository.SettingsRepository
+}
+
+func NewSettingsHandler(settingsRepo *repository.SettingsRepository) *SettingsHandler {
+	return &SettingsHandler{settingsRepo: settingsRepo}
+}
+
+// CommandName is the name /settings and /mode are recorded under in command statistics
+func (h *SettingsHandler) CommandName() string {
+	return "settings"
+}
+
+func (h *SettingsHandler) CanHandle(update tgbotapi.Update) bool {
+	if update.Message != nil {
+		return update.Message.IsCommand() && (update.Message.Command() == "settings" || update.Message.Command() == "mode")
+	}
+	if update.CallbackQuery != nil {
+		data := update.CallbackQuery.Data
+		return strings.HasPrefix(data, settingsCallbackPrefix) || strings.HasPrefix(data, modeCallbackPrefix)
+	}
+	return false
+}
+
+func (h *SettingsHandler) Handle(ctx context.Context, bot botpkg.Sender, update tgbotapi.Update) {
+	if update.Message != nil {
+		settings := userSettings(h.settingsRepo, update.Message.From.ID)
+		text, keyboard := settingsMenu(settings)
+		if update.Message.Command() == "mode" {
+			text, keyboard = settingsSubmenu(settings, settingMode)
+		}
+		msg := tgbotapi.NewMessage(update.Message.Chat.ID, text)
+		msg.ReplyMarkup = keyboard
+		if _, err := bot.Send(msg); err != nil {
+			log.Printf("[SETTINGS] Failed to send message: %v", err)
+		}
+		return
+	}
+
+	callback := update.CallbackQuery
+	settings := userSettings(h.settingsRepo, callback.From.ID)
+
+	action, setting, value, ok := parseSettingsCallback(callback.Data)
+	if !ok {
+		log.Printf("[SETTINGS] Invalid callback data: %s", callback.Data)
+		return
+	}
+
+	var text string
+	var keyboard tgbotapi.InlineKeyboardMarkup
+	switch action {
+	case "menu":
+		bot.Send(tgbotapi.NewCallback(callback.ID, ""))
+		text, keyboard = settingsMenu(settings)
+
+	case "open":
+		bot.Send(tgbotapi.NewCallback(callback.ID, ""))
+		text, keyboard = settingsSubmenu(settings, setting)
+
+	case "set":
+		if !applySetting(settings, setting, value) {
+			log.Printf("[SETTINGS] Invalid value %q of %s", value, setting)
+			return
+		}
+		if err := h.settingsRepo.Save(settings); err != nil {
+			log.Printf("[SETTINGS] Failed to store settings: %v", err)
+			bot.Send(tgbotapi.NewCallback(callback.ID, tr(settings.Language, "settings.failed")))
+			return
+		}
+		log.Printf("[SETTINGS] User %d set %s to %q", callback.From.ID, setting, value)
+
+		// Ответ уже на новом языке, если меняли язык
+		bot.Send(tgbotapi.NewCallback(callback.ID, tr(settings.Language, "settings.saved")))
+		text, keyboard = settingsMenu(settings)
+	}
+
+	if callback.Message != nil {
+		editMsg := tgbotapi.NewEditMessageTextAndMarkup(callback.Message.Chat.ID, callback.Message.MessageID, text, keyboard)
+		bot.Send(editMsg)
+	}
+}
+
+// parseSettingsCallback parses menu callback data, the legacy mode:<mode> is
+// the same as st:set:mode:<mode>
+func parseSettingsCallback(data string) (action, setting, value string, ok bool) {
+	if mode, legacy := strings.CutPrefix(data, modeCallbackPrefix); legacy {
+		return "set", settingMode, mode, true
+	}
+	data, ok = strings.CutPrefix(data, settingsCallbackPrefix)
+	if !ok {
+		return "", "", "", false
+	}
+	parts := strings.SplitN(data, ":", 3)
+	switch {
+	case parts[0] == "menu" && len(parts) == 1:
+		return "menu", "", "", true
+	case parts[0] == "open" && len(parts) == 2:
+		_, known := settingOptions[parts[1]]
+		return "open", parts[1], "", known
+	case parts[0] == "set" && len(parts) == 3:
+		return "set", parts[1], parts[2], true
+	}
+	return "", "", "", false
+}
+
+// applySetting changes one setting, false if the value is not allowed
+func applySetting(settings *models.UserSettings, setting, value string) bool {
+	if setting == settingDelete {
+		if value != "on" && value != "off" {
+			return false
+		}
+		settings.DeleteLink = value == "on"
+		return true
+	}
+	if !slices.Contains(settingOptions[setting], value) {
+		return false
+	}
+	switch setting {
+	case settingQuality:
+		settings.DefaultQuality = value
+	case settingMode:
+		settings.DeliveryMode = value
+	case settingCaption:
+		settings.Caption = value
+	case settingLanguage:
+		settings.Language = value
+	}
+	return true
+}
+
+// settingsMenu shows current values, a button opens the section of a
+// setting, the link deletion is toggled right away
+func settingsMenu(settings *models.UserSettings) (string, tgbotapi.InlineKeyboardMarkup) {
+	lang := settings.Language
+	button := func(setting, value string) []tgbotapi.InlineKeyboardButton {
+		label := tr(lang, "settings."+setting) + ": " + optionLabel(lang, setting, value)
+		return tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(label, settingsCallbackPrefix+"open:"+setting))
+	}
+
+	toggle, deleteLabel := "on", tr(lang, "settings.off")
+	if settings.DeleteLink {
+		toggle, deleteLabel = "off", tr(lang, "settings.on")
+	}
+
+	return tr(lang, "settings.title"), tgbotapi.NewInlineKeyboardMarkup(
+		button(settingQuality, settings.DefaultQuality),
+		button(settingMode, settings.DeliveryMode),
+		button(settingCaption, settings.Caption),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			tr(lang, "settings.delete")+": "+deleteLabel, settingsCallbackPrefix+"set:"+settingDelete+":"+toggle)),
+		button(settingLanguage, settings.Language),
+	)
+}
+
+// settingsSubmenu lists values of a setting and marks the current one with a check
+func settingsSubmenu(settings *models.UserSettings, setting string) (string, tgbotapi.InlineKeyboardMarkup) {
+	lang := settings.Language
+	current := map[string]string{
+		settingQuality:  settings.DefaultQuality,
+		settingMode:     settings.DeliveryMode,
+		settingCaption:  settings.Caption,
+		settingLanguage: settings.Language,
+	}[setting]
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, value := range settingOptions[setting] {
+		label := optionLabel(lang, setting, value)
+		if value == current {
+			label = "✅ " + label
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, settingsCallbackPrefix+"set:"+setting+":"+value)))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(tr(lang, "settings.back"), settingsCallbackPrefix+"menu")))
+
+	return tr(lang, setting+".prompt"), tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// optionLabel returns the human readable value of a setting
+func optionLabel(lang, setting, value string) string {
+	switch setting {
+	case settingQuality:
+		if value == "" {
+			return tr(lang, "quality.ask")
+		}
+		return value
+	case settingLanguage:
+		return languageNames[value]
+	}
+	return tr(lang, setting+"."+value)
+}
+
+// userSettings loads settings of the user, defaults if they cannot be loaded
+func userSettings(repo *repository.SettingsRepository, telegramUserID int64) *models.UserSettings {
+	if repo == nil {
+		return models.DefaultSettings(telegramUserID)
+	}
+	settings, err := repo.Get(telegramUserID)
+	if err != nil {
+		log.Printf("[SETTINGS] Failed to load settings of %d: %v", telegramUserID, err)
+		return models.DefaultSettings(telegramUserID)
+	}
+	return settings
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/artur/solid-spoon/internal/bot/bottest"
+	"github.com/artur/solid-spoon/internal/database"
+	"github.com/artur/solid-spoon/internal/database/models"
+	"github.com/artur/solid-spoon/internal/database/repository"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// settingsScenario wires the settings handler to the fake Bot API and an in-memory database
+func settingsScenario(t *testing.T) (*SettingsHandler, *repository.SettingsRepository, *bottest.Server, *tgbotapi.BotAPI) {
+	t.Helper()
+
+	db, err := database.New(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	settings := repository.NewSettingsRepository(db.DB)
+
+	srv := bottest.NewServer(t)
+	return NewSettingsHandler(settings), settings, srv, srv.API(t)
+}
+
+func settingsCommand(command string) tgbotapi.Update {
+	return tgbotapi.Update{Message: &tgbotapi.Message{
+		MessageID: 1,
+		Text:      "/" + command,
+		From:      testUser,
+		Chat:      &tgbotapi.Chat{ID: testUserID, Type: "private"},
+		Entities:  []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command) + 1}},
+	}}
+}
+
+func settingsPress(messageID int, data string) tgbotapi.Update {
+	return tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:      "cb",
+		From:    testUser,
+		Data:    data,
+		Message: &tgbotapi.Message{MessageID: messageID, Chat: &tgbotapi.Chat{ID: testUserID, Type: "private"}},
+	}}
+}
+
+func TestSettingsHandler_ChangeSettings(t *testing.T) {
+	h, repo, srv, api := settingsScenario(t)
+
+	command := settingsCommand("settings")
+	if !h.CanHandle(command) {
+		t.Fatal("Expected /settings to be handled")
+	}
+	h.Handle(context.Background(), api, command)
+
+	menu := srv.Last("sendMessage")
+	if menu == nil || !strings.Contains(menu.Params["reply_markup"], "📦 Отправка: 📄 Файлом") {
+		t.Fatalf("Expected the menu with current values, got %+v", menu)
+	}
+
+	h.Handle(context.Background(), api, settingsPress(menu.MessageID, "st:open:quality"))
+	if edit := srv.Last("editMessageText"); edit == nil || !strings.Contains(edit.Params["reply_markup"], "✅ Спрашивать") {
+		t.Fatalf("Expected the quality section, got %+v", edit)
+	}
+
+	for _, data := range []string{"st:set:quality:720p", "st:set:caption:none", "st:set:delete:off"} {
+		press := settingsPress(menu.MessageID, data)
+		if !h.CanHandle(press) {
+			t.Fatalf("Expected %s to be handled", data)
+		}
+		h.Handle(context.Background(), api, press)
+	}
+
+	settings, err := repo.Get(testUserID)
+	if err != nil {
+		t.Fatalf("Failed to load settings: %v", err)
+	}
+	if settings.DefaultQuality != "720p" || settings.Caption != models.CaptionNone || settings.DeleteLink {
+		t.Errorf("Expected the settings to be stored, got %+v", settings)
+	}
+	if edit := srv.Last("editMessageText"); edit == nil || !strings.Contains(edit.Params["reply_markup"], "🗑 Удалять ссылку: нет") {
+		t.Errorf("Expected the menu to show the new values, got %+v", edit)
+	}
+
+	// Недопустимое значение не сохраняется
+	h.Handle(context.Background(), api, settingsPress(menu.MessageID, "st:set:mode:fax"))
+	if settings, _ := repo.Get(testUserID); settings.DeliveryMode != models.ModeDocument {
+		t.Errorf("Expected invalid mode to be ignored, got %q", settings.DeliveryMode)
+	}
+}
+
+func TestSettingsHandler_Language(t *testing.T) {
+	h, _, srv, api := settingsScenario(t)
+
+	h.Handle(context.Background(), api, settingsPress(10, "st:set:lang:en"))
+
+	if answer := srv.Last("answerCallbackQuery"); answer == nil || answer.Params["text"] != "Saved" {
+		t.Errorf("Expected the answer in the new language, got %+v", answer)
+	}
+	if edit := srv.Last("editMessageText"); edit == nil || !strings.HasPrefix(edit.Params["text"], "⚙️ Settings") {
+		t.Errorf("Expected the menu in English, got %+v", edit)
+	}
+}
+
+func TestSettingsHandler_LegacyMode(t *testing.T) {
+	h, repo, srv, api := settingsScenario(t)
+
+	command := settingsCommand("mode")
+	if !h.CanHandle(command) {
+		t.Fatal("Expected /mode to be handled")
+	}
+	h.Handle(context.Background(), api, command)
+
+	menu := srv.Last("sendMessage")
+	if menu == nil || !strings.Contains(menu.Params["reply_markup"], "✅ 📄 Файлом") {
+		t.Fatalf("Expected the delivery mode section, got %+v", menu)
+	}
+
+	// Кнопки старого меню /mode продолжают работать
+	press := settingsPress(menu.MessageID, modeCallbackPrefix+models.ModeVideo)
+	if !h.CanHandle(press) {
+		t.Fatal("Expected mode button to be handled")
+	}
+	h.Handle(context.Background(), api, press)
+
+	if settings, err := repo.Get(testUserID); err != nil || settings.DeliveryMode != models.ModeVideo {
+		t.Fatalf("Expected video delivery mode to be stored, got %+v (%v)", settings, err)
+	}
+}
@@ -3,11 +3,12 @@ package handler
 import (
 	"testing"
 
+	"github.com/artur/solid-spoon/internal/database/models"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 func TestStartHandler_CanHandle(t *testing.T) {
-	handler := NewStartHandler(nil, nil)
+	handler := NewStartHandler(nil)
 
 	tests := []struct {
 		name     string
@@ -162,7 +163,7 @@ func TestFormatGreeting_Various(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := formatGreeting(tt.userName)
+			result := formatGreeting(models.LanguageRussian, tt.userName)
 			if result != tt.expected {
 				t.Errorf("formatGreeting(%q) = %q, want %q",
 					tt.userName, result, tt.expected)
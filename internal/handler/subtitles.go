@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	botpkg "github.com/artur/solid-spoon/internal/bot"
+	"github.com/artur/solid-spoon/internal/database/models"
+	"github.com/artur/solid-spoon/internal/downloader"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// subtitlesCallbackPrefix - префикс callback data кнопок субтитров:
+// sb:<jobID>:<mode>:<lang>[:auto], а sb:<jobID>:- - без субтитров
+const subtitlesCallbackPrefix = "sb:"
+
+// noSubtitles - выбор "без субтитров" в callback data
+const noSubtitles = "-"
+
+// maxSubtitleTracks - сколько языков предлагаем, чтобы клавиатура не занимала весь экран
+const maxSubtitleTracks = 8
+
+// offerSubtitles asks whether the video of the job needs subtitles if it has
+// any. The job waits in pending state until the choice is made. It returns
+// false if there is nothing to choose and the job can start right away.
+func (h *LinkHandler) offerSubtitles(bot botpkg.Sender, job *models.DownloadJob) bool {
+	if job.ID == 0 || job.Quality == string(downloader.QualityAudio) {
+		return false
+	}
+	lister, ok := h.downloader.(downloader.SubtitleLister)
+	if !ok {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), formatsTimeout)
+	defer cancel()
+	tracks, err := lister.GetSubtitles(ctx, job.VideoID)
+	if err != nil {
+		// Без списка субтитров видео всё равно можно скачать
+		log.Printf("[LINK] Failed to get subtitles of %s: %v", job.VideoID, err)
+		return false
+	}
+	if len(tracks) == 0 {
+		return false
+	}
+	if len(tracks) > maxSubtitleTracks {
+		tracks = tracks[:maxSubtitleTracks]
+	}
+
+	if err := h.jobRepo.Finish(job, models.JobPending, ""); err != nil {
+		log.Printf("[LINK] Failed to mark job %d pending: %v", job.ID, err)
+		return false
+	}
+
+	log.Printf("[LINK] Offering %d subtitle tracks for job %d", len(tracks), job.ID)
+
+	lang := h.language(job.TelegramUserID)
+	editMsg := tgbotapi.NewEditMessageText(job.ChatID, job.MessageID, tr(lang, "subtitles.prompt"))
+	keyboard := subtitlesKeyboard(lang, job.ID, tracks)
+	editMsg.ReplyMarkup = &keyboard
+	bot.Send(editMsg)
+	return true
+}
+
+// subtitlesKeyboard offers a file and a burn-in button for every track
+func subtitlesKeyboard(lang string, jobID int64, tracks []downloader.SubtitleTrack) tgbotapi.InlineKeyboardMarkup {
+	prefix := fmt.Sprintf("%s%d:", subtitlesCallbackPrefix, jobID)
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, track := range tracks {
+		name := track.Name
+		if track.Auto {
+			name += " (" + tr(lang, "subtitles.auto") + ")"
+		}
+		file := downloader.Subtitles{Lang: track.Lang, Auto: track.Auto, Mode: downloader.SubtitlesFile}
+		burn := downloader.Subtitles{Lang: track.Lang, Auto: track.Auto, Mode: downloader.SubtitlesBurn}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📄 "+name, prefix+file.String()),
+			tgbotapi.NewInlineKeyboardButtonData("🔥 "+name, prefix+burn.String()),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(tr(lang, "subtitles.none"), prefix+noSubtitles),
+	))
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// handleSubtitlesCallback stores the chosen subtitles and starts the pending job
+func (h *LinkHandler) handleSubtitlesCallback(ctx context.Context, bot botpkg.Sender, callback *tgbotapi.CallbackQuery) {
+	jobID, choice, ok := parseSubtitlesCallback(callback.Data)
+	if !ok {
+		log.Printf("[LINK] Invalid subtitles callback data: %s", callback.Data)
+		return
+	}
+
+	lang := h.language(callback.From.ID)
+	job, err := h.jobRepo.GetByID(jobID)
+	if err != nil {
+		log.Printf("[LINK] Failed to load job %d: %v", jobID, err)
+	}
+	if job == nil || job.Status != models.JobPending {
+		bot.Send(tgbotapi.NewCallback(callback.ID, tr(lang, "link.stale_button")))
+		return
+	}
+	if job.TelegramUserID != callback.From.ID {
+		bot.Send(tgbotapi.NewCallback(callback.ID, tr(lang, "subtitles.not_owner")))
+		return
+	}
+
+	if choice != noSubtitles {
+		if err := h.jobRepo.SetSubtitles(job, choice); err != nil {
+			log.Printf("[LINK] Failed to store subtitles of job %d: %v", job.ID, err)
+		}
+	}
+	if err := h.jobRepo.Finish(job, models.JobQueued, ""); err != nil {
+		log.Printf("[LINK] Failed to queue job %d: %v", job.ID, err)
+	}
+
+	log.Printf("[LINK] Callback: job %d subtitles %q", job.ID, choice)
+
+	bot.Send(tgbotapi.NewCallback(callback.ID, trf(lang, "link.downloading", qualityLabel(lang, downloader.Quality(job.Quality)))))
+	h.startJob(ctx, bot, job)
+}
+
+// jobSubtitles returns the subtitles chosen for the job, nil if none
+func jobSubtitles(job *models.DownloadJob) *downloader.Subtitles {
+	if job.Subtitles == "" {
+		return nil
+	}
+	subs, ok := downloader.ParseSubtitles(job.Subtitles)
+	if !ok {
+		return nil
+	}
+	return &subs
+}
+
+// subtitlesLabel describes the chosen subtitles for users
+func subtitlesLabel(lang string, subs *downloader.Subtitles) string {
+	label := subs.Lang
+	if subs.Auto {
+		label += ", " + tr(lang, "subtitles.auto")
+	}
+	return label
+}
+
+// sendSubtitles sends the subtitles file downloaded with the video
+func sendSubtitles(bot botpkg.Sender, lang string, job *models.DownloadJob, path string) {
+	doc := tgbotapi.NewDocument(job.ChatID, tgbotapi.FilePath(path))
+	if subs := jobSubtitles(job); subs != nil {
+		doc.Caption = trf(lang, "subtitles.caption", subtitlesLabel(lang, subs))
+	}
+	if _, err := bot.Send(doc); err != nil {
+		log.Printf("[LINK] Failed to send subtitles: %v", err)
+	}
+}
+
+// parseSubtitlesCallback parses sb:<jobID>:<choice> callback data
+func parseSubtitlesCallback(data string) (int64, string, bool) {
+	data, ok := strings.CutPrefix(data, subtitlesCallbackPrefix)
+	if !ok {
+		return 0, "", false
+	}
+	rawID, choice, ok := strings.Cut(data, ":")
+	if !ok {
+		return 0, "", false
+	}
+	jobID, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	if choice != noSubtitles {
+		if _, valid := downloader.ParseSubtitles(choice); !valid {
+			return 0, "", false
+		}
+	}
+	return jobID, choice, true
+}
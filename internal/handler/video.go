@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	botpkg "github.com/artur/solid-spoon/internal/bot"
+	"github.com/artur/solid-spoon/internal/database/models"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// videoUpload is a video sent with sendVideo
+type videoUpload struct {
+	ChatID  int64
+	Path    string
+	Caption string
+	// Thumbnail - превью JPEG, пустая строка - Telegram сделает превью сам
+	Thumbnail string
+	Width     int
+	Height    int
+	Duration  int
+}
+
+// sendVideo uploads a video Telegram plays inline. tgbotapi.VideoConfig has no
+// width and height, without them vertical videos are shown as squares until
+// they are opened.
+func sendVideo(bot botpkg.Sender, v videoUpload) (tgbotapi.Message, error) {
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", v.ChatID)
+	params.AddNonEmpty("caption", v.Caption)
+	params.AddNonZero("width", v.Width)
+	params.AddNonZero("height", v.Height)
+	params.AddNonZero("duration", v.Duration)
+	params.AddBool("supports_streaming", true)
+
+	files := []tgbotapi.RequestFile{{Name: "video", Data: tgbotapi.FilePath(v.Path)}}
+	if v.Thumbnail != "" {
+		files = append(files, tgbotapi.RequestFile{Name: "thumbnail", Data: tgbotapi.FilePath(v.Thumbnail)})
+	}
+
+	resp, err := bot.UploadFiles("sendVideo", params, files)
+	if err != nil {
+		return tgbotapi.Message{}, err
+	}
+
+	var msg tgbotapi.Message
+	if err := json.Unmarshal(resp.Result, &msg); err != nil {
+		return tgbotapi.Message{}, fmt.Errorf("failed to parse sendVideo result: %w", err)
+	}
+	return msg, nil
+}
+
+// playsInline reports whether Telegram clients play the file in the chat.
+// Only MP4 gets the player; MKV, which VP9 and Opus downloads are merged
+// into, would be shown as a file without a preview anyway.
+func playsInline(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".mp4")
+}
+
+// deliveryMode returns how videos are sent to the user, documents by default.
+// In the audio mode links are downloaded as audio right away, videos the user
+// still asks for (e.g. from a playlist) are sent as documents.
+func deliveryMode(settings *models.UserSettings) string {
+	if settings.DeliveryMode == models.ModeVideo {
+		return models.ModeVideo
+	}
+	return models.ModeDocument
+}